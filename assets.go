@@ -6,6 +6,7 @@ import (
 	"image"
 	"io"
 	"log"
+	"log/slog"
 	"math"
 	"os"
 	"strconv"
@@ -180,7 +181,7 @@ func (a *AssetManager) Init(config_path string) {
 		a.CacheRotatedSprites(path, STEPS)
 	}
 
-	log.Println("succesfully loaded all stacked sprites")
+	slog.Debug("succesfully loaded all stacked sprites")
 
 	// TODO improve
 	a.new_level_font = a.LoadFont("assets/fonts/PressStart2P-Regular.ttf")
@@ -2,13 +2,6 @@ package game
 
 import "fmt"
 
-const (
-	BarrelStandard uint8 = iota + 1
-	BarrelHeavy
-	BarrelRubber
-	BarrelEnd
-)
-
 func DetermineAdditionalBounces(barrel_type uint8) int {
 	switch barrel_type {
 	case BarrelRubber:
@@ -29,19 +22,6 @@ func DetermineVelocityMultiplier(barrel_type uint8) float64 {
 	}
 }
 
-func DetermineBarrelName(barrel_type uint8) string {
-	switch barrel_type {
-	case BarrelStandard:
-		return "standard"
-	case BarrelHeavy:
-		return "heavy"
-	case BarrelRubber:
-		return "rubber"
-	default:
-		return "missing!"
-	}
-}
-
 func DetermineBarrelDesc(barrel_type uint8) string {
 	switch barrel_type {
 	case BarrelHeavy:
@@ -3,71 +3,23 @@ package game
 import (
 	"fmt"
 	"gotanks/shared"
+	"gotanks/sim"
 	"log"
 	"math"
-	"sync"
 )
 
-type StandardBulletTypeEnum uint8
-
-const (
-	StandardBulletTypeStandard StandardBulletTypeEnum = iota + 1
-	StandardBulletTypeFast
-	StandardBulletTypeEnd
-)
-
-const (
-	BULLET_WIDTH  = 8
-	BULLET_HEIGHT = 8
-)
-
-type Bullet interface {
-	Update(level *Level, g *Game) Bullet
-	GetDrawData(g *Game)
-	GetId() string
-	IsColliding(position, dimension Position) bool
-}
-
-type StandardBullet struct {
-	Position
-	ID          string
-	Rotation    float64
-	Bullet_type StandardBulletTypeEnum
-
-	Num_bounces int
-	Velocity    float64
-
-	grace_period int
-}
-
-type BulletHit struct {
-	Player    string
-	Bullet_ID string
-}
-
+// a sim.BulletManager that also draws its bullets and sends new ones to
+// the server
 type BulletManager struct {
 	Observer
-	mutex   sync.RWMutex
-	bullets map[string]Bullet
+	sim.BulletManager
 
 	network_manager  *NetworkManager
 	asset_manager    *AssetManager
 	particle_manager *ParticleManager
-	index            uint
 }
 
-func (bm *BulletManager) NewBulletId() string {
-	bm.index++
-	if bm.network_manager == nil ||
-		bm.network_manager.client == nil ||
-		!bm.network_manager.client.isConnected() {
-		return fmt.Sprintf("0:%d", bm.index)
-	}
-
-	return fmt.Sprintf("%x:%d", *bm.network_manager.client.Auth, bm.index)
-}
-
-func (bm *BulletManager) Shoot(bullet Bullet) {
+func (bm *BulletManager) Shoot(bullet StandardBullet) {
 	//bullet.ID = bm.NewBulletId()
 	// TODO
 	// deprecate
@@ -84,12 +36,6 @@ func (bm *BulletManager) Shoot(bullet Bullet) {
 	}
 }
 
-func (bm *BulletManager) Reset() {
-	for k := range bm.bullets {
-		delete(bm.bullets, k)
-	}
-}
-
 func InitBulletManager(nm *NetworkManager, am *AssetManager, pm *ParticleManager) *BulletManager {
 	if nm == nil || am == nil || pm == nil {
 		// this could be solved by not passing pointers
@@ -101,8 +47,6 @@ func InitBulletManager(nm *NetworkManager, am *AssetManager, pm *ParticleManager
 	bm.asset_manager = am
 	bm.particle_manager = pm
 
-	bm.bullets = make(map[string]Bullet)
-
 	return &bm
 }
 
@@ -117,29 +61,14 @@ func (am *AssetManager) GetSpriteFromBulletTypeEnum(bullet_type StandardBulletTy
 	}
 }
 
-func (bm *BulletManager) AddBullet(bullet Bullet) {
-	bm.mutex.Lock()
-	bm.bullets[bullet.GetId()] = bullet
-	bm.mutex.Unlock()
-}
-
 func (bm *BulletManager) OnEvent(event Event) {
 	switch event.Name {
 	case EventBulletFired:
-		bm.AddBullet(event.Data.(Bullet))
+		bm.AddBullet(event.Data.(StandardBullet))
 	case EventPlayerHit:
 	}
 }
 
-func (bm *BulletManager) DetermineGracePeriod(bullet_type StandardBulletTypeEnum) int {
-	switch bullet_type {
-	case StandardBulletTypeFast:
-		return 15
-	default:
-		return 30
-	}
-}
-
 func DetermineNumBounces(bullet_type StandardBulletTypeEnum) int {
 	switch bullet_type {
 	case StandardBulletTypeFast:
@@ -176,17 +105,6 @@ func DetermineBaseReloadSpeed(bullet_type StandardBulletTypeEnum) float64 {
 	}
 }
 
-func DetermineBulletName(bullet_type StandardBulletTypeEnum) string {
-	switch bullet_type {
-	case StandardBulletTypeFast:
-		return "sniper"
-	case StandardBulletTypeStandard:
-		return "standard"
-	default:
-		return "missing!"
-	}
-}
-
 func DetermineBulletDesc(bullet_type StandardBulletTypeEnum) string {
 	switch bullet_type {
 	case StandardBulletTypeFast:
@@ -206,131 +124,49 @@ func DetermineBulletStats(bullet_type StandardBulletTypeEnum) string {
 	}
 }
 
-func (b StandardBullet) GetId() string {
-	return b.ID
-}
-
-func (b StandardBullet) GetDrawData(g *Game) {
+func drawBullet(b StandardBullet, g *Game) {
 	x, y := g.camera.GetRelativePosition(b.X, b.Y)
 	g.context.draw_data = append(g.context.draw_data,
 		DrawData{
 			path:      g.am.GetSpriteFromBulletTypeEnum(b.Bullet_type),
-			position:  Position{x, y},
+			position:  Position{X: x, Y: y},
 			rotation:  -b.Rotation - g.camera.rotation + math.Pi,
 			intensity: 1,
-			offset:    Position{0, -TURRET_HEIGHT * 2},
+			offset:    Position{X: 0, Y: -TURRET_HEIGHT * 2},
 			opacity:   1,
 		})
 	g.context.draw_data = append(g.context.draw_data,
 		DrawData{
 			path:      g.am.GetSpriteFromBulletTypeEnum(b.Bullet_type),
-			position:  Position{x, y - 4},
+			position:  Position{X: x, Y: y - 4},
 			rotation:  -b.Rotation - g.camera.rotation + math.Pi,
 			intensity: 0,
-			offset:    Position{0, (-TURRET_HEIGHT * 2) + 8},
+			offset:    Position{X: 0, Y: (-TURRET_HEIGHT * 2) + 8},
 			opacity:   .3,
 		})
 }
 
-func (b StandardBullet) Update(level *Level, game *Game) Bullet {
-	x, y := math.Sin(b.Rotation)*b.Velocity, math.Cos(b.Rotation)*b.Velocity
-
-	b.Position.Y += y
-	collided_object := level.CheckObjectCollisionWithDimensions(b.Position, Position{4, 4})
-	if collided_object != nil {
-		b.Rotation = math.Pi - b.Rotation
-		if game != nil {
-			game.pm.AddParticle(
-				Particle{
-					particle_type: ParticleTypeGunSmoke,
-					Position:      b.Position,
-					Rotation:      b.Rotation,
-					velocity:      2,
-					sprite_path:   "assets/sprites/stacks/particle-cube-template.png",
-					max_t:         15,
-				})
-		}
-		if b.Num_bounces == 0 {
-			return nil
-		}
-		b.Num_bounces--
-		b.Position.Y -= y
-	}
-
-	b.Position.X += x
-	collided_object = level.CheckObjectCollisionWithDimensions(b.Position, Position{4, 4})
-	if collided_object != nil {
-		b.Rotation = -b.Rotation
-		if game != nil {
-			game.pm.AddParticle(
-				Particle{
-					particle_type: ParticleTypeGunSmoke,
-					Position:      b.Position,
-					Rotation:      b.Rotation,
-					velocity:      2,
-					sprite_path:   "assets/sprites/stacks/particle-cube-template.png",
-					max_t:         15,
-				})
-		}
-		if b.Num_bounces == 0 {
-			return nil
-		}
-		b.Num_bounces--
-		b.Position.X -= x
-	}
-
-	if game != nil {
-		level.gm.ApplyForce(b.X, b.Y)
-	}
-	b.grace_period = max(b.grace_period-1, 0)
-	return b
-}
-
 func (bm *BulletManager) GetDrawData(g *Game) {
-	bm.mutex.RLock()
-	defer bm.mutex.RUnlock()
-	for _, bullet := range bm.bullets {
-		bullet.GetDrawData(g)
-	}
-}
-
-func (bm *BulletManager) Update(level *Level, g *Game) {
-	bm.mutex.Lock()
-	defer bm.mutex.Unlock()
-	for key, bullet := range bm.bullets {
-		bullet := bullet.Update(level, g)
-		if bullet == nil {
-			delete(bm.bullets, key)
-		} else {
-			bm.bullets[key] = bullet
-		}
-	}
-}
-
-func (bullet StandardBullet) IsColliding(position, dimension Position) bool {
-	if bullet.grace_period > 0 {
-		return false
-	}
-
-	if bullet.X < position.X+dimension.X &&
-		bullet.X+BULLET_WIDTH > position.X &&
-		bullet.Y < position.Y+dimension.Y &&
-		bullet.Y+BULLET_HEIGHT > position.Y {
-		return true
-	}
-
-	return false
-}
-
-func (bm *BulletManager) IsColliding(position, dimension Position) *Bullet {
-	bm.mutex.RLock()
-	defer bm.mutex.RUnlock()
-	for _, bullet := range bm.bullets {
-		hit := bullet.IsColliding(position, dimension)
-		if hit {
-			return &bullet
-		}
-	}
-
-	return nil
+	bm.Each(func(bullet StandardBullet) {
+		drawBullet(bullet, g)
+	})
+}
+
+// advances every bullet by ticks physics ticks, kicking up smoke where they
+// bounce and pushing the grass they fly over
+func (bm *BulletManager) Update(level *Level, g *Game, ticks int) {
+	bm.BulletManager.Update(&level.Level, ticks, func(b StandardBullet) {
+		g.pm.AddParticle(
+			Particle{
+				particle_type: ParticleTypeGunSmoke,
+				Position:      b.Position,
+				Rotation:      b.Rotation,
+				velocity:      2,
+				sprite_path:   "assets/sprites/stacks/particle-cube-template.png",
+				max_t:         15,
+			})
+	})
+	bm.Each(func(b StandardBullet) {
+		level.gm.ApplyForce(b.X, b.Y)
+	})
 }
@@ -3,9 +3,12 @@ package main
 import (
 	"flag"
 	"gotanks"
+	"gotanks/shared"
+	"gotanks/sim"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 
 	"github.com/hajimehoshi/ebiten/v2"
 )
@@ -17,11 +20,23 @@ func main() {
 	start_server := flag.Bool("server", false, "start server")
 	force_new_id := flag.Bool("f", false, "force new id")
 	profiler := flag.Bool("p", false, "start profiler")
-	mediator_addr := flag.String("mediator", game.MEDIATOR_ADDR, "mediator server address")
+	mediator_list := flag.String("mediator", sim.MEDIATOR_ADDR, "comma separated mediator server addresses")
+	log_level := flag.String("log-level", shared.DEFAULT_LOG_LEVEL, "least severe log lines shown, debug, info, warn or error")
+	log_json := flag.Bool("log-json", false, "log json lines instead of key=value pairs")
 
 	flag.Parse()
 
-	g := game.GameInit(*mediator_addr)
+	logger, err := shared.SetupLogging(os.Stderr, *log_level, *log_json)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mediator_addrs, err := sim.ParseMediatorAddrs(*mediator_list)
+	if err != nil {
+		log.Fatal("error resolving mediator: ", err)
+	}
+
+	g := game.GameInit(mediator_addrs)
 
 	if g.SaveIsFresh() || *force_new_id {
 		g.GenerateNewPlayerId()
@@ -33,11 +48,13 @@ func main() {
 
 	if *profiler {
 		go func() {
-			log.Println(http.ListenAndServe("localhost:6060", nil))
+			logger.Error("profiler stopped", shared.LogErr(http.ListenAndServe("localhost:6060", nil)))
 		}()
 	}
 
-	if err := ebiten.RunGame(g); err != nil {
+	err = ebiten.RunGame(g)
+	g.Close()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -1,171 +1,70 @@
 package main
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
+	"flag"
 	"fmt"
+	"gotanks/mediator"
 	"gotanks/shared"
 	"log"
 	"net"
-	"sort"
-	"strconv"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
-type Host struct {
-	Time int64
-	shared.AvailableServer
-}
-type HostsMap map[string]Host
-const (
-	TIMEOUT_MS = 7000
-)
+func main() {
+	listen_addr := flag.String("addr", fmt.Sprintf(":%d", mediator.PORT), "address to listen on")
+	snapshot_path := flag.String("snapshot", "", "file to persist hosts in across restarts, empty to disable")
+	peer_list := flag.String("peers", "", "comma separated 'host:port' of other mediators to share hosts with")
+	secret := flag.String("secret", "", "signs gossip and lets servers keep their id and join code across restarts, peers need the same one. random if empty")
+	log_level := flag.String("log-level", shared.DEFAULT_LOG_LEVEL, "least severe log lines shown, debug, info, warn or error")
+	log_json := flag.Bool("log-json", false, "log json lines instead of key=value pairs")
 
-func timeoutStaleConnections(keyword_map *HostsMap) {
-	for key, value := range *keyword_map {
-		if time.Now().UnixMilli()-value.Time > TIMEOUT_MS {
-			fmt.Printf("%s:%d user timed out using '%s' connection key\n", value.Ip, value.Port, value.Name)
-			delete(*keyword_map, key)
-		}
-	}
-}
+	flag.Parse()
 
-func main() {
-	server_addr, err := net.ResolveUDPAddr("udp", ":8080")
+	logger, err := shared.SetupLogging(os.Stderr, *log_level, *log_json)
 	if err != nil {
-		fmt.Println("Error resolving address:", err)
-		return
+		log.Fatal(err)
 	}
 
-	host_map := make(HostsMap)
+	server_addr, err := net.ResolveUDPAddr("udp", *listen_addr)
+	if err != nil {
+		log.Fatal("error resolving address: ", err)
+	}
 
 	conn, err := net.ListenUDP("udp", server_addr)
 	if err != nil {
-		fmt.Println("Error listening:", err)
-		return
+		log.Fatal("error listening: ", err)
 	}
 
-	fmt.Println("mediator listening")
-	defer conn.Close()
-
-	packet_channel := make(chan shared.PacketData)
-
-	go func() {
-		for {
-			timeoutStaleConnections(&host_map)
-			time.Sleep(time.Second * 1)
+	peers := []*net.UDPAddr{}
+	for _, peer := range strings.Split(*peer_list, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer == "" {
+			continue
 		}
-	}()
-
-	go func() {
-		buf := make([]byte, 1024)
-		for {
-			n, addr, err := conn.ReadFromUDP(buf)
-			if err != nil {
-				fmt.Println("error reading", err)
-			}
-
-			packet, data, err := shared.DeserializePacket(buf[:n])
-			if err != nil {
-				fmt.Println("error reading", err)
-			}
-
-			packet_data := shared.PacketData{Packet: packet, Data: data, Addr: *addr}
-			packet_channel <- packet_data
+		peer_addr, err := net.ResolveUDPAddr("udp", peer)
+		if err != nil {
+			log.Fatal("error resolving peer: ", err)
 		}
-	}()
-
-	for {
-		select {
-		case packet_data := <-packet_channel:
-			dec := gob.NewDecoder(bytes.NewReader(packet_data.Data))
-			switch packet_data.Packet.PacketType {
-			case shared.PacketTypeAvailableHosts:
-				l := []shared.AvailableServer{}
-				for _, value := range host_map {
-					l = append(l, value.AvailableServer)
-				}
-				serialized_packet, err := shared.SerializePacket(packet_data.Packet, [16]byte{}, l)
-				if err != nil {
-					fmt.Println("error serializing packet", err)
-				}
-				sort.Slice(l, func(i, j int) bool {
-					return l[i].Name < l[j].Name
-				})
-
-				conn.WriteToUDP(serialized_packet, &packet_data.Addr)
-			case shared.PacketTypeUpdateMediator:
-				var server shared.AvailableServer
-				err := dec.Decode(&server)
-				if err != nil {
-					log.Panic("error during decoding", err)
-				}
-				val, ok := host_map[server.Name]
-				if !ok {
-					log.Panic("error during decoding", err)
-				}
-
-				val.Max_players = server.Max_players
-				val.Player_count = server.Player_count
-				host_map[server.Name] = val
-
-			case shared.PacketTypeKeepAlive:
-				// refreshing timeout
-				for key, value := range host_map {
-					if fmt.Sprintf("%s:%d", value.Ip, value.Port) == packet_data.Addr.String() {
-						value.Time = time.Now().UnixMilli()
-						host_map[key] = value
-					}
-				}
-			case shared.PacketTypeMatchConnect:
-				var inner_data shared.ReconcilliationData
-				err := dec.Decode(&inner_data)
-				if err != nil {
-					log.Panic("error during decoding", err)
-				}
-
-				val, ok := host_map[inner_data.Name]
-				if !ok {
-					fmt.Println("could not find match")
-					break
-				}
-				packet := shared.Packet{PacketType: shared.PacketTypeMatchConnect}
-				serialized_packet, err := shared.SerializePacket(packet, [16]byte{}, packet_data.Addr)
-
-				tar_addr := &net.UDPAddr{IP: net.ParseIP(val.Ip), Port: val.Port}
-				log.Printf("sending new player at %s to server at %s\n", &packet_data.Addr, tar_addr)
-				conn.WriteToUDP(serialized_packet, tar_addr)
-			case shared.PacketTypeMatchHost:
-				var inner_data shared.ReconcilliationData
-				err := dec.Decode(&inner_data)
-				if err != nil {
-					log.Panic("error during decoding", err)
-				}
+		peers = append(peers, peer_addr)
+	}
 
-				// if already exists
-				if host_map[inner_data.Name].Name != "" {
-					break
-				}
+	if len(peers) > 0 && *secret == "" {
+		log.Fatal("peers need a -secret to trust each other's gossip")
+	}
 
-				addr_str := strings.Split(packet_data.Addr.String(), ":")
-				port, err:= strconv.Atoi(addr_str[1])
-				if err != nil {
-					fmt.Println("error parsing addr to int")
-				}
-				host_map[inner_data.Name] = Host{Time: time.Now().UnixMilli(), AvailableServer: shared.AvailableServer{Ip: addr_str[0], Port: port, Name: inner_data.Name}}
-				fmt.Println("added new host: ", inner_data)
-			case shared.PacketTypeMatchStart:
-				var inner_data shared.ReconcilliationData
-				err := dec.Decode(&inner_data)
-				if err != nil {
-					fmt.Println("error during decoding", err)
-				}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-				fmt.Printf("%s's server has started, and has been removed from eligible lobbies\n", packet_data.Addr.String())
-				delete(host_map, inner_data.Name)
-			}
-		}
+	logger.Info("mediator listening", shared.LogAddr("addr", conn.LocalAddr()))
+	options := mediator.Options{Snapshot_path: *snapshot_path, Peers: peers, Secret: *secret, Log: logger}
+	err = mediator.New(conn, time.Now, options).Run(ctx)
+	if err != nil {
+		log.Fatal(err)
 	}
+	logger.Info("mediator shut down")
 }
-
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"gotanks/shared"
+	"gotanks/sim"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// sends admin commands to a running server, see sim.RoomHost.ServeRcon.
+// with a command as arguments it is run once, otherwise commands are read
+// from stdin
+func main() {
+	addr := flag.String("addr", fmt.Sprintf("127.0.0.1:%d", sim.RCON_PORT), "the server's rcon address")
+	password := flag.String("password", "", "rcon password, falls back to $GOTANKS_RCON_PASSWORD")
+
+	flag.Parse()
+
+	if *password == "" {
+		*password = os.Getenv("GOTANKS_RCON_PASSWORD")
+	}
+
+	conn, err := net.Dial("tcp", *addr)
+	if err != nil {
+		log.Fatal("error connecting: ", err)
+	}
+	defer conn.Close()
+	server := bufio.NewScanner(conn)
+
+	if !server.Scan() {
+		log.Fatal("server closed the connection")
+	}
+	challenge_hex, ok := strings.CutPrefix(server.Text(), "challenge ")
+	if !ok {
+		log.Fatal("unexpected greeting: ", server.Text())
+	}
+	challenge, err := hex.DecodeString(challenge_hex)
+	if err != nil {
+		log.Fatal("invalid challenge: ", err)
+	}
+	fmt.Fprintf(conn, "%x\n", shared.PasswordProof(*password, challenge, [16]byte{}))
+
+	if !server.Scan() || server.Text() != "ok" {
+		log.Fatal("not accepted: ", server.Text())
+	}
+
+	run := func(command string) {
+		fmt.Fprintln(conn, command)
+		for server.Scan() {
+			if server.Text() == "" {
+				return
+			}
+			fmt.Println(server.Text())
+		}
+		log.Fatal("server closed the connection")
+	}
+
+	if flag.NArg() > 0 {
+		run(strings.Join(flag.Args(), " "))
+		return
+	}
+
+	input := bufio.NewScanner(os.Stdin)
+	for input.Scan() {
+		if strings.TrimSpace(input.Text()) == "" {
+			continue
+		}
+		run(input.Text())
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"flag"
+	"fmt"
+	"gotanks/shared"
+	"gotanks/sim"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// prints what a server recorded with -replay-dir, one line per record.
+// the position updates sent every few ticks and pings are left out unless
+// -all is given
+func main() {
+	all := flag.Bool("all", false, "also print player position updates and pings")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: replay [-all] file.replay...")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, path := range flag.Args() {
+		err := dump(out, path, *all)
+		if err != nil {
+			out.Flush()
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+}
+
+func dump(out io.Writer, path string, all bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	replay, err := sim.OpenReplay(file)
+	if err != nil {
+		return err
+	}
+	header := replay.Header()
+	fmt.Fprintf(out, "%s: %s, match %s part %d, started %s\n", path, header.Server, header.Match_ID, header.Part, header.Started.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(out, "maps %v starting on %d, %d ticks per second\n", header.Maps, header.Level+1, header.Tick_rate)
+
+	names := map[string]string{}
+	for _, player := range header.Players {
+		names[player.Player_ID] = player.Name
+		fmt.Fprintf(out, "player %s %s\n", player.Player_ID, player.Name)
+	}
+	name := func(id string) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		return id
+	}
+
+	for {
+		record, err := replay.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			fmt.Fprintf(out, "%10s cut short\n", "")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		at := fmt.Sprintf("%10.3f", record.At.Seconds())
+		if record.Kind == sim.ReplayRecordState {
+			fmt.Fprintf(out, "%s state %s -> %s\n", at, record.From, record.To)
+			continue
+		}
+
+		dec := gob.NewDecoder(bytes.NewReader(record.Data))
+		switch record.Packet.PacketType {
+		case shared.PacketTypeUpdatePlayers:
+			players := []sim.PlayerUpdate{}
+			err = dec.Decode(&players)
+			if err != nil {
+				break
+			}
+			for _, player := range players {
+				if names[player.ID] != player.Name {
+					names[player.ID] = player.Name
+					fmt.Fprintf(out, "%s player %s %s\n", at, player.ID, player.Name)
+				}
+			}
+			if all {
+				for _, player := range players {
+					fmt.Fprintf(out, "%s update %s at %.0f,%.0f\n", at, name(player.ID), player.Tank.Position.X, player.Tank.Position.Y)
+				}
+			}
+		case shared.PacketTypeBulletShoot:
+			bullet := sim.StandardBullet{}
+			err = dec.Decode(&bullet)
+			if err == nil {
+				fmt.Fprintf(out, "%s %s fired a %s bullet\n", at, name(bullet.Owner), sim.DetermineBulletName(bullet.Bullet_type))
+			}
+		case shared.PacketTypePlayerHit:
+			hit := sim.BulletHit{}
+			err = dec.Decode(&hit)
+			if err == nil {
+				fmt.Fprintf(out, "%s %s hit %s\n", at, name(hit.Shooter), name(hit.Player))
+			}
+		case shared.PacketTypeNewRound:
+			event := sim.NewRoundEvent{}
+			err = dec.Decode(&event)
+			if err == nil {
+				fmt.Fprintf(out, "%s new round on map %d", at, event.Level+1)
+				if event.Winner != "" {
+					fmt.Fprintf(out, ", last won by %s", name(event.Winner))
+				}
+				fmt.Fprintln(out)
+			}
+		case shared.PacketTypeGameOver:
+			event := sim.GameOverEvent{}
+			err = dec.Decode(&event)
+			if err == nil {
+				scores := []string{}
+				for _, stats := range event.Scoreboard {
+					scores = append(scores, fmt.Sprintf("%s %d/%d", name(stats.Player_ID), stats.Kills, stats.Deaths))
+				}
+				fmt.Fprintf(out, "%s game over, won by %s (%s)\n", at, name(event.Winner), strings.Join(scores, ", "))
+			}
+		case shared.PacketTypeServerMessage:
+			message := shared.ServerMessageData{}
+			err = dec.Decode(&message)
+			if err == nil {
+				fmt.Fprintf(out, "%s message %q\n", at, message.Message)
+			}
+		case shared.PacketTypeServerClosing:
+			closing := shared.ServerClosingData{}
+			err = dec.Decode(&closing)
+			if err == nil {
+				fmt.Fprintf(out, "%s server closing: %s\n", at, closing.Reason)
+			}
+		case shared.PacketTypePing:
+			if all {
+				fmt.Fprintf(out, "%s ping\n", at)
+			}
+		case shared.PacketTypeServerStateChanged:
+			// the state record next to it says the same
+		default:
+			fmt.Fprintf(out, "%s %s, %d bytes\n", at, record.Packet.PacketType, len(record.Data))
+		}
+		if err != nil {
+			fmt.Fprintf(out, "%s unreadable %s: %v\n", at, record.Packet.PacketType, err)
+		}
+	}
+}
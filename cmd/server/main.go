@@ -1,15 +1,153 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"gotanks"
-	"net"
+	"fmt"
+	"gotanks/shared"
+	"gotanks/sim"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 )
 
 func main() {
-	mediator_addr := flag.String("mediator", game.MEDIATOR_ADDR, "mediator server address")
+	defaults := sim.DefaultServerConfig()
+
+	config_path := flag.String("config", "", "json config file, flags that are given override it")
+	name := flag.String("name", "", "name shown in the server list, random if empty")
+	port := flag.Int("port", defaults.Port, "port to listen on")
+	mediator_list := flag.String("mediator", sim.MEDIATOR_ADDR, "comma separated mediator server addresses")
+	password := flag.String("password", "", "password players need to join, empty for none")
+	private := flag.Bool("private", false, "hide the server from the server list, it can still be joined by name")
+	max_players := flag.Int("max-players", defaults.Max_players, "players allowed at once")
+	win_threshold := flag.Int("wins", defaults.Win_threshold, "round wins needed to win a match")
+	new_level_interval := flag.Int("new-level-interval", defaults.New_level_interval_s, "seconds between rounds")
+	game_over_interval := flag.Int("game-over-interval", defaults.Game_over_interval_s, "seconds the result of a match is shown")
+	state_change_grace := flag.Int("grace", defaults.State_change_grace_ms, "milliseconds before a state change is acted on")
+	tick_rate := flag.Int("tick-rate", defaults.Tick_rate, "server simulation ticks per second, one of 10, 12, 15, 20, 30 or 60")
+	send_rate := flag.Int("send-rate", defaults.Send_rate, "updates sent to players per second")
+	map_list := flag.String("maps", "", "comma separated levels to play in order, e.g. 2,1")
+	rooms := flag.Int("rooms", defaults.Rooms, "independent matches to host on the same port")
+	console := flag.Bool("console", defaults.Console, "read admin commands from stdin, type help for a list")
+	rcon_port := flag.Int("rcon-port", defaults.Rcon_port, fmt.Sprintf("tcp port for remote admin commands, usually %d, 0 for none", sim.RCON_PORT))
+	rcon_password := flag.String("rcon-password", "", "password for remote admin commands, see cmd/rcon")
+	rcon_host := flag.String("rcon-host", defaults.Rcon_host, "address rcon listens on, empty for every interface")
+	access_file := flag.String("access-file", "", "json file to keep bans and the allowlist in, empty to keep them in memory")
+	allowlist := flag.Bool("allowlist", false, "only let players on the allowlist join")
+	stats_store := flag.String("stats-store", defaults.Stats_store, fmt.Sprintf("where player and match stats are kept, %s or %s", sim.STATS_STORE_MEMORY, sim.STATS_STORE_SQLITE))
+	stats_path := flag.String("stats", "", "database file for the sqlite stats store")
+	metrics_port := flag.Int("metrics-port", defaults.Metrics_port, "tcp port serving /metrics for prometheus, 0 for none")
+	log_level := flag.String("log-level", defaults.Log_level, "least severe log lines shown, debug, info, warn or error")
+	log_json := flag.Bool("log-json", defaults.Log_json, "log json lines instead of key=value pairs")
+	replay_dir := flag.String("replay-dir", "", "directory to record every match to, see cmd/replay, empty for none")
+	replay_max_kb := flag.Int("replay-max-kb", defaults.Replay_max_kb, "kilobytes a replay grows to before going on in a new file")
+	replay_max_files := flag.Int("replay-max-files", defaults.Replay_max_files, "replays kept, older ones are removed")
 
 	flag.Parse()
 
-	game.StartServer(game.CreateServerName(), &net.UDPAddr{IP: net.ParseIP(*mediator_addr), Port: game.MEDIATOR_PORT})
+	config := defaults
+	if *config_path != "" {
+		var err error
+		config, err = sim.LoadServerConfig(*config_path)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var flag_err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			config.Name = *name
+		case "port":
+			config.Port = *port
+		case "mediator":
+			config.Mediators = strings.Split(*mediator_list, ",")
+		case "password":
+			config.Password = *password
+		case "private":
+			config.Private = *private
+		case "max-players":
+			config.Max_players = *max_players
+		case "wins":
+			config.Win_threshold = *win_threshold
+		case "new-level-interval":
+			config.New_level_interval_s = *new_level_interval
+		case "game-over-interval":
+			config.Game_over_interval_s = *game_over_interval
+		case "grace":
+			config.State_change_grace_ms = *state_change_grace
+		case "tick-rate":
+			config.Tick_rate = *tick_rate
+		case "send-rate":
+			config.Send_rate = *send_rate
+		case "rooms":
+			config.Rooms = *rooms
+		case "console":
+			config.Console = *console
+		case "rcon-port":
+			config.Rcon_port = *rcon_port
+		case "rcon-password":
+			config.Rcon_password = *rcon_password
+		case "rcon-host":
+			config.Rcon_host = *rcon_host
+		case "access-file":
+			config.Access_file = *access_file
+		case "allowlist":
+			config.Allowlist = *allowlist
+		case "stats-store":
+			config.Stats_store = *stats_store
+		case "stats":
+			config.Stats_path = *stats_path
+		case "metrics-port":
+			config.Metrics_port = *metrics_port
+		case "log-level":
+			config.Log_level = *log_level
+		case "log-json":
+			config.Log_json = *log_json
+		case "replay-dir":
+			config.Replay_dir = *replay_dir
+		case "replay-max-kb":
+			config.Replay_max_kb = *replay_max_kb
+		case "replay-max-files":
+			config.Replay_max_files = *replay_max_files
+		case "maps":
+			config.Maps = nil
+			for _, level := range strings.Split(*map_list, ",") {
+				n, err := strconv.Atoi(strings.TrimSpace(level))
+				if err != nil {
+					flag_err = fmt.Errorf("invalid map '%s'", level)
+					return
+				}
+				config.Maps = append(config.Maps, n)
+			}
+		}
+	})
+	if flag_err != nil {
+		log.Fatal(flag_err)
+	}
+	if config.Name == "" {
+		config.Name = sim.CreateServerName()
+	}
+
+	err := config.Validate()
+	if err != nil {
+		log.Fatal("invalid config:\n", err)
+	}
+	_, err = shared.SetupLogging(os.Stderr, config.Log_level, config.Log_json)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = sim.StartServer(ctx, config)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
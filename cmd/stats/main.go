@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gotanks/sim"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// dumps the history a server kept with -stats-store sqlite, see sim.HistoryFilter.
+// json lines carry a Type so matches, rounds and kills can share a stream,
+// csv has one kind of record per file
+func main() {
+	db_path := flag.String("db", "", "sqlite stats database of a server, see cmd/server -stats")
+	format := flag.String("format", "jsonl", "jsonl or csv")
+	what := flag.String("what", "all", "matches, rounds, kills, or all of them (jsonl only)")
+	from := flag.String("from", "", "only what happened from this date on, e.g. 2026-01-31 or RFC 3339")
+	to := flag.String("to", "", "only what happened before this date")
+	map_number := flag.Int("map", 0, "only this map, as in cmd/server -maps, 0 for all")
+	player := flag.String("player", "", "only matches this player, given by id or name, took part in")
+
+	flag.Parse()
+
+	if *db_path == "" {
+		log.Fatal("-db is required")
+	}
+	if *format != "jsonl" && *format != "csv" {
+		log.Fatalf("unknown format '%s', use jsonl or csv", *format)
+	}
+	if *what != "all" && *what != "matches" && *what != "rounds" && *what != "kills" {
+		log.Fatalf("unknown records '%s', use matches, rounds, kills or all", *what)
+	}
+	if *format == "csv" && *what == "all" {
+		log.Fatal("csv needs one of -what matches, rounds or kills")
+	}
+
+	filter := sim.HistoryFilter{Map: *map_number, Player: *player}
+	var err error
+	filter.From, err = parseDate(*from)
+	if err != nil {
+		log.Fatal("-from: ", err)
+	}
+	filter.To, err = parseDate(*to)
+	if err != nil {
+		log.Fatal("-to: ", err)
+	}
+
+	// a server may be writing to it, it is left as it is
+	stats, err := sim.OpenSQLiteStatsReadOnly(*db_path)
+	if err != nil {
+		log.Fatal("error opening stats: ", err)
+	}
+	defer stats.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	export := exportJSONLines
+	if *format == "csv" {
+		export = exportCSV
+	}
+	for _, kind := range []string{"matches", "rounds", "kills"} {
+		if *what != "all" && *what != kind {
+			continue
+		}
+		err := export(out, stats, kind, filter)
+		if err != nil {
+			out.Flush()
+			log.Fatalf("error exporting %s: %s", kind, err)
+		}
+	}
+}
+
+// empty is no date, dates without a time are midnight in the local zone
+func parseDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, date, time.Local)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, date)
+}
+
+func exportJSONLines(out *bufio.Writer, stats *sim.SQLiteStats, kind string, filter sim.HistoryFilter) error {
+	enc := json.NewEncoder(out)
+	switch kind {
+	case "matches":
+		records, err := stats.MatchHistory(filter)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			err := enc.Encode(struct {
+				Type string
+				sim.MatchRecord
+			}{"match", record})
+			if err != nil {
+				return err
+			}
+		}
+	case "rounds":
+		records, err := stats.RoundHistory(filter)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			err := enc.Encode(struct {
+				Type string
+				sim.RoundRecord
+			}{"round", record})
+			if err != nil {
+				return err
+			}
+		}
+	case "kills":
+		records, err := stats.KillHistory(filter)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			err := enc.Encode(struct {
+				Type string
+				sim.KillRecord
+			}{"kill", record})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func exportCSV(out *bufio.Writer, stats *sim.SQLiteStats, kind string, filter sim.HistoryFilter) error {
+	w := csv.NewWriter(out)
+	defer w.Flush()
+
+	switch kind {
+	case "matches":
+		records, err := stats.MatchHistory(filter)
+		if err != nil {
+			return err
+		}
+		w.Write([]string{"match_id", "start_time", "end_time", "winner_id", "winner_name", "players", "rounds"})
+		for _, r := range records {
+			end_time := ""
+			if r.End_time != nil {
+				end_time = formatTime(*r.End_time)
+			}
+			w.Write([]string{r.Match_ID, formatTime(r.Start_time), end_time, r.Winner_ID, r.Winner_name,
+				strconv.Itoa(r.Players), strconv.Itoa(r.Rounds)})
+		}
+	case "rounds":
+		records, err := stats.RoundHistory(filter)
+		if err != nil {
+			return err
+		}
+		w.Write([]string{"round_id", "match_id", "map", "winner_id", "winner_name", "kills"})
+		for _, r := range records {
+			w.Write([]string{r.Round_ID, r.Match_ID, strconv.Itoa(r.Map), r.Winner_ID, r.Winner_name, strconv.Itoa(r.Kills)})
+		}
+	case "kills":
+		records, err := stats.KillHistory(filter)
+		if err != nil {
+			return err
+		}
+		w.Write([]string{"kill_id", "round_id", "match_id", "map", "time", "killer_id", "killer_name", "victim_id", "victim_name",
+			"loader", "barrel", "loadout_bullet", "tracks", "bullet"})
+		for _, r := range records {
+			loadout := r.Killer_loadout
+			w.Write([]string{r.Kill_ID, r.Round_ID, r.Match_ID, strconv.Itoa(r.Map), formatTime(r.Time),
+				r.Killer_ID, r.Killer_name, r.Victim_ID, r.Victim_name,
+				loadout.Loader, loadout.Barrel, loadout.Bullet, loadout.Tracks, r.Bullet})
+		}
+	default:
+		return fmt.Errorf("unknown records '%s'", kind)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -1,13 +1,17 @@
 package game
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"gotanks/shared"
+	"gotanks/sim"
 	"image"
 	"image/color"
 	"log"
 	"math"
+	"net"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -23,15 +27,9 @@ const (
 	SCREEN_WIDTH  = 1280
 	SCREEN_HEIGHT = 960
 
-	SPRITE_SIZE = 16
-
 	AMOUNT_OF_STRIPES = 22
 )
 
-type Position struct {
-	X, Y float64
-}
-
 type DrawData struct {
 	sprite *ebiten.Image
 	// will override sprite stack caching
@@ -58,6 +56,7 @@ const (
 	GameStateServerPicking
 	GameStateMainMenu
 	GameStateTankLoadout
+	GameStateLeaderboard
 )
 
 type GameContext struct {
@@ -71,13 +70,24 @@ type GameContext struct {
 	// TODO refactor
 	new_level_time time.Time
 	game_over_time time.Time
+	// how the last match went, shown until we are back in the lobby
+	scoreboard []PlayerMatchStats
 
 	available_servers []shared.AvailableServer
+	browser           ServerBrowser
+	leaderboard       LeaderboardView
+	// picking a name in the main menu
+	name_input        TextInput
+	editing_name      bool
+	name_error        string
 	current_state     GameStateEnum
 	current_selection int
 	isReady           bool
 	background_time   int
 	current_level     int
+	// watching a match we joined late, our own tank is not in play
+	spectating bool
+	kill_feed  []KillFeedEntry
 
 	current_server *shared.AvailableServer
 }
@@ -93,6 +103,14 @@ type Game struct {
 	time   float64
 
 	context GameContext
+	server  HostedServer
+}
+
+// the server started from the main menu, if any
+type HostedServer struct {
+	sync.Mutex
+	stop context.CancelFunc
+	done chan struct{}
 }
 
 func (g *Game) OnEvent(event Event) {
@@ -101,15 +119,30 @@ func (g *Game) OnEvent(event Event) {
 	case EventBackToLobby:
 		ctx.current_state = GameStateLobby
 	case EventGameOver:
-		server_event := event.Data.(NewRoundEvent)
+		server_event := event.Data.(GameOverEvent)
 		ctx.game_over_time = server_event.Timestamp
+		ctx.scoreboard = server_event.Scoreboard
 		go func() {
 			time.Sleep(server_event.Timestamp.Sub(time.Now()))
 			ctx.current_state = GameStateLobby
+			ctx.spectating = false
 			g.Reset()
 		}()
 	case EventNewMatch:
 		g.Reset()
+	case EventDisconnected:
+		g.StopServer()
+	case EventServerClosed:
+		g.StopServer()
+		ctx.current_state = GameStateServerPicking
+		ctx.current_selection = 0
+		ctx.spectating = false
+		g.Reset()
+	case EventServerResolved:
+		if ctx.browser.prompt == ServerBrowserPromptResolving {
+			server := event.Data.(shared.AvailableServer)
+			ctx.browser.resolved = &server
+		}
 	case EventNewRound:
 		server_event := event.Data.(NewRoundEvent)
 		ctx.new_level_time = server_event.Timestamp
@@ -121,9 +154,16 @@ func (g *Game) OnEvent(event Event) {
 			time.Sleep(server_event.Timestamp.Sub(time.Now()))
 			g.context.current_state = GameStatePlaying
 			g.context.current_level = int(server_event.Level)
+			g.context.spectating = false
 			g.tank.Respawn(spawn)
 			g.Reset()
 		}()
+	case EventSpectate:
+		server_event := event.Data.(SpectateEvent)
+		ctx.current_level = int(server_event.Level)
+		ctx.spectating = true
+		ctx.current_state = GameStatePlaying
+		g.Reset()
 	}
 }
 
@@ -242,6 +282,8 @@ func SplitSprites(source *ebiten.Image) []*ebiten.Image {
 // TODO move to UI drawing
 // TODO refactor
 func (g *Game) DrawGameOver(screen *ebiten.Image) {
+	g.DrawScoreboard(screen)
+
 	textOp := text.DrawOptions{}
 	t := g.context.game_over_time.Sub(time.Now())
 	msg := fmt.Sprintf("Back to lobby in %.2f.", max(t.Seconds(), 0))
@@ -251,6 +293,29 @@ func (g *Game) DrawGameOver(screen *ebiten.Image) {
 	text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
 }
 
+func (g *Game) DrawSpectating(screen *ebiten.Image) {
+	textOp := text.DrawOptions{}
+	msg := "Spectating, you join next round."
+	fontSize := 8.
+	textOp.GeoM.Translate(RENDER_WIDTH/2, RENDER_HEIGHT-fontSize*2)
+	textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, 0)
+	text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
+}
+
+// the last message from the server admin, while it is fresh
+func (g *Game) DrawServerMessage(screen *ebiten.Image) {
+	client := g.nm.client
+	if client.server_message == "" || time.Since(client.server_message_time) > SERVER_MESSAGE_DURATION {
+		return
+	}
+	textOp := text.DrawOptions{}
+	msg := fmt.Sprintf("[server] %s", client.server_message)
+	fontSize := 8.
+	textOp.GeoM.Translate(RENDER_WIDTH/2, fontSize*3)
+	textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, 0)
+	text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
+}
+
 // TODO refactor
 func (g *Game) DrawNewLevelTimer(screen *ebiten.Image) {
 	textOp := text.DrawOptions{}
@@ -262,6 +327,21 @@ func (g *Game) DrawNewLevelTimer(screen *ebiten.Image) {
 	text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
 }
 
+// what the camera follows, our own tank or when spectating the first player still alive
+func (g *Game) CameraSubject() Position {
+	if !g.context.spectating {
+		return g.tank.Position
+	}
+
+	for _, player := range g.context.player_updates {
+		if g.nm.client.isSelf(player.ID) || NetBoolify(player.Spectating) || !player.Tank.Alive() {
+			continue
+		}
+		return player.Tank.Position
+	}
+	return g.tank.Position
+}
+
 func (g *Game) GetTargetCameraPosition() Position {
 	// TODO should perhaps offset by relative mouse position to give the illusion of 'zoom' or 'focus'
 	targetX := float64(RENDER_WIDTH) / 2
@@ -272,18 +352,66 @@ func (g *Game) GetTargetCameraPosition() Position {
 	rotated_y := targetX*math.Sin(g.camera.rotation) + targetY*math.Cos(g.camera.rotation)
 
 	// Step 3: Calculate the final camera position by adding the rotated offset to the tank's position
+	subject := g.CameraSubject()
 	return Position{
-		X: g.tank.X - rotated_x,
-		Y: g.tank.Y - rotated_y,
+		X: subject.X - rotated_x,
+		Y: subject.Y - rotated_y,
 	}
 }
 
 func (g *Game) HostServer() {
-	name := CreateServerName()
-	go StartServer(name, g.nm.mediator_addr)
+	config := sim.DefaultServerConfig()
+	config.Mediators = nil
+	for _, mediator := range g.nm.mediator_addrs {
+		config.Mediators = append(config.Mediators, mediator.String())
+	}
+	g.StopServer()
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	g.server.Lock()
+	g.server.stop = stop
+	g.server.done = done
+	g.server.Unlock()
+	go func() {
+		defer close(done)
+		err := sim.StartServer(ctx, config)
+		if err != nil {
+			g.nm.log.Error("error hosting server", shared.LogErr(err))
+		}
+	}()
 	g.context.current_state = GameStateLobby
-	g.context.current_server = &shared.AvailableServer{Ip: "127.0.0.1", Port: SERVERPORT, Name: name, Player_count: 0, Max_players: 2}
-	g.nm.Connect(*g.context.current_server)
+	g.context.current_server = &shared.AvailableServer{Ip: "127.0.0.1", Port: config.Port, Name: config.Name, Player_count: 0, Max_players: config.Max_players}
+	g.nm.Connect(*g.context.current_server, "")
+	g.rememberServer(*g.context.current_server)
+}
+
+// shuts down the server we host, if any, and waits for it to have told
+// its players and mediators.
+func (g *Game) StopServer() {
+	g.server.Lock()
+	stop, done := g.server.stop, g.server.done
+	g.server.stop, g.server.done = nil, nil
+	g.server.Unlock()
+	if stop == nil {
+		return
+	}
+	stop()
+	<-done
+}
+
+// leaves the server we are on and stops the one we host.
+// called when the game exits
+func (g *Game) Close() {
+	if g.nm.client.isConnected() {
+		g.nm.client.Disconnect()
+	}
+	g.StopServer()
+}
+
+// the server the main menu shows the leaderboard of
+func (g *Game) rememberServer(server shared.AvailableServer) {
+	g.sm.data.Last_server = server
+	g.sm.Save()
 }
 
 func (g *Game) DrawPlayerUI(screen *ebiten.Image, player PlayerUpdate, num_players int, wins int, count int, font *text.GoTextFaceSource) {
@@ -296,11 +424,7 @@ func (g *Game) DrawPlayerUI(screen *ebiten.Image, player PlayerUpdate, num_playe
 	vector.DrawFilledRect(screen, float32(width*count), 0, float32(width), float32(fontSize)*2, clr, true)
 
 	textOp := text.DrawOptions{}
-	name := player.ID
-	if len(player.ID) > 6 {
-		name = player.ID[0:6]
-	}
-	msg := fmt.Sprintf("%-6s | %d", name, wins)
+	msg := fmt.Sprintf("%s | %d", PlayerName(player), wins)
 
 	textOp.GeoM.Translate(float64(width*count+(width/2)), fontSize*2)
 	textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, -fontSize*1.5)
@@ -337,12 +461,25 @@ func (g *Game) Update() error {
 		err = g.UpdateMainMenu()
 	case GameStateServerPicking:
 		err = g.UpdateServerPicking()
+	case GameStateLeaderboard:
+		err = g.UpdateLeaderboard()
 	default:
 		err = errors.New("invalid state")
 	}
 	return err
 }
 
+// the name a player picked, servers which do not send names only have ids
+func PlayerName(player PlayerUpdate) string {
+	if player.Name != "" {
+		return player.Name
+	}
+	if len(player.ID) > 8 {
+		return player.ID[0:8]
+	}
+	return player.ID
+}
+
 func PlayerReadyString(n uint) string {
 	if NetBoolify(n) {
 		return "R"
@@ -375,6 +512,8 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		g.DrawServerPicking(screen)
 	case GameStateTankLoadout:
 		g.DrawTankLoadout(screen)
+	case GameStateLeaderboard:
+		g.DrawLeaderboard(screen)
 	}
 }
 
@@ -395,7 +534,7 @@ func (g *Game) InitStripeTexture() {
 	vector.DrawFilledRect(stripe_texture, 0, 0, float32(SCREEN_WIDTH/AMOUNT_OF_STRIPES/2), SCREEN_HEIGHT, STRIPE_COLOR, true)
 }
 
-func GameInit(mediator_addr string) *Game {
+func GameInit(mediator_addrs []*net.UDPAddr) *Game {
 	am := &AssetManager{}
 	am.Init("temp.json")
 
@@ -425,7 +564,7 @@ func GameInit(mediator_addr string) *Game {
 	game.camera.rotation = -46 * math.Pi / 180
 
 	game.sm = InitSaveManager()
-	game.nm = InitNetworkManager(mediator_addr)
+	game.nm = InitNetworkManager(mediator_addrs)
 	game.pm = InitParticleManager(game.am)
 	game.bm = InitBulletManager(game.nm, game.am, game.pm)
 
@@ -433,6 +572,7 @@ func GameInit(mediator_addr string) *Game {
 	game.nm.client.Register(game.pm)
 	game.nm.client.Register(&game)
 	game.nm.client.Auth = &game.sm.data.Player_ID
+	game.nm.client.Username = &game.sm.data.Username
 
 	for i := range LEVEL_COUNT {
 		level_path := fmt.Sprintf("assets/tiled/level_%d.tmx", i+1)
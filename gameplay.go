@@ -1,17 +1,72 @@
 package game
 
 import (
+	"fmt"
 	"sort"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
 )
 
+const (
+	KILL_FEED_DURATION = 5 * time.Second
+	// the oldest kills are dropped past this
+	KILL_FEED_LENGTH = 4
+)
+
+type KillFeedEntry struct {
+	msg  string
+	time time.Time
+}
+
+// the name of the player with id, as the last player update had it
+func (g *Game) playerName(id string) string {
+	for _, player := range g.context.player_updates {
+		if player.ID == id {
+			return PlayerName(player)
+		}
+	}
+	return PlayerName(PlayerUpdate{ID: id})
+}
+
+func (g *Game) AddKill(hit BulletHit) {
+	victim := g.playerName(hit.Player)
+	msg := fmt.Sprintf("%s was hit", victim)
+	if hit.Shooter == hit.Player {
+		msg = fmt.Sprintf("%s hit themselves", victim)
+	} else if hit.Shooter != "" {
+		msg = fmt.Sprintf("%s hit %s", g.playerName(hit.Shooter), victim)
+	}
+
+	feed := append(g.context.kill_feed, KillFeedEntry{msg: msg, time: time.Now()})
+	g.context.kill_feed = feed[max(0, len(feed)-KILL_FEED_LENGTH):]
+}
+
+// recent kills, newest at the bottom, below the server message
+func (g *Game) DrawKillFeed(screen *ebiten.Image) {
+	fontSize := 8.
+	line := 0
+	for _, kill := range g.context.kill_feed {
+		if time.Since(kill.time) > KILL_FEED_DURATION {
+			continue
+		}
+		textOp := text.DrawOptions{}
+		textOp.GeoM.Translate(RENDER_WIDTH-float64(len(kill.msg)+1)*fontSize, fontSize*5+float64(line)*(fontSize+2))
+		text.Draw(screen, kill.msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
+		line++
+	}
+}
+
 func (g *Game) UpdateGameplay() error {
-	g.tank.Update(g)
+	if !g.context.spectating {
+		g.tank.Update(g)
+	}
 	g.camera.Update(g.GetTargetCameraPosition())
 	level := g.CurrentLevel()
 	level.gm.Update(g)
-	g.bm.Update(level, g)
+	// a frame is one physics tick
+	g.bm.Update(level, g, 1)
 	g.pm.Update(g)
 	g.time += 0.01
 
@@ -29,6 +84,8 @@ func (g *Game) UpdateGameplay() error {
 }
 
 func (g *Game) DrawUI(screen *ebiten.Image) {
+	g.DrawServerMessage(screen)
+	g.DrawKillFeed(screen)
 	for count, player := range g.context.player_updates {
 		g.DrawPlayerUI(screen, player, len(g.context.player_updates), g.nm.client.wins[player.ID], count, g.am.new_level_font)
 	}
@@ -40,13 +97,19 @@ func (g *Game) DrawUI(screen *ebiten.Image) {
 		defer g.DrawGameOver(screen)
 	}
 
+	if g.context.spectating {
+		g.DrawSpectating(screen)
+		return
+	}
 	g.DrawAmmo(screen)
 }
 
 func (g *Game) DrawGameplay(screen *ebiten.Image) {
 	level := g.CurrentLevel()
 	level.GetDrawData(screen, g, g.camera)
-	g.tank.GetDrawData(screen, g, g.camera, PLAYER_COLOR)
+	if !g.context.spectating {
+		g.tank.GetDrawData(screen, g, g.camera, PLAYER_COLOR)
+	}
 	g.bm.GetDrawData(g)
 	g.pm.GetDrawData(g)
 	if g.nm.client.isConnected() {
@@ -60,10 +123,10 @@ func (g *Game) DrawGameplay(screen *ebiten.Image) {
 		opacity := float32(track.lifetime) / float32(TRACK_LIFETIME)
 		g.context.draw_data = append(g.context.draw_data, DrawData{
 			sprite:    g.tank.track_sprite,
-			position:  Position{x, y - offset},
+			position:  Position{X: x, Y: y - offset},
 			rotation:  track.rotation - g.camera.rotation,
 			intensity: 1,
-			offset:    Position{0, offset},
+			offset:    Position{X: 0, Y: offset},
 			opacity:   opacity})
 	}
 
@@ -35,7 +35,7 @@ func (g *Grass) GetDrawData(camera Camera, gm *GrassManager) DrawData {
 	intensity := max(1/1-float32(math.Sqrt(g.rotation*g.rotation)), 0.8)
 	return DrawData{
 		sprite:    g.sprite,
-		position:  Position{x, y},
+		position:  Position{X: x, Y: y},
 		rotation:  g.rotation + rotation,
 		intensity: intensity,
 		offset:    Position{},
@@ -0,0 +1,137 @@
+package game
+
+import (
+	"fmt"
+	"gotanks/shared"
+	"net"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+)
+
+const (
+	// frames between asking again, answers can get lost
+	LEADERBOARD_RETRY_INTERVAL = 60
+	// frames before giving up on the server
+	LEADERBOARD_TIMEOUT = 300
+)
+
+// the leaderboard of the last server we played on, see SaveData.Last_server
+type LeaderboardView struct {
+	server shared.AvailableServer
+	board  *shared.Leaderboard
+	opened int
+}
+
+func (g *Game) OpenLeaderboard() {
+	g.context.leaderboard = LeaderboardView{server: g.sm.data.Last_server, opened: g.context.background_time}
+	g.nm.client.leaderboard = nil
+	g.context.current_state = GameStateLeaderboard
+	if g.sm.data.Last_server.Ip != "" {
+		g.nm.RequestLeaderboard(g.sm.data.Last_server)
+	}
+}
+
+// asks server for its best players, the answer is handled in Client.HandlePacket
+func (nm *NetworkManager) RequestLeaderboard(server shared.AvailableServer) {
+	query := shared.LeaderboardQuery{Padding: make([]byte, shared.LEADERBOARD_QUERY_PADDING)}
+	data_bytes, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeLeaderboard}, *nm.client.Auth, query)
+	if err != nil {
+		nm.log.Error("unable to serialize leaderboard query", shared.LogErr(err))
+		return
+	}
+	addr := &net.UDPAddr{IP: net.ParseIP(server.Ip), Port: server.Port}
+	nm.client.leaderboard_from = addr.String()
+	nm.client.conn.WriteToUDP(data_bytes, addr)
+}
+
+func (g *Game) UpdateLeaderboard() error {
+	g.context.background_time++
+	view := &g.context.leaderboard
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.context.current_state = GameStateMainMenu
+		return nil
+	}
+
+	if view.server.Ip == "" || view.board != nil {
+		return nil
+	}
+	if g.nm.client.leaderboard != nil {
+		view.board = g.nm.client.leaderboard
+		return nil
+	}
+	waited := g.context.background_time - view.opened
+	if waited < LEADERBOARD_TIMEOUT && waited%LEADERBOARD_RETRY_INTERVAL == 0 {
+		g.nm.RequestLeaderboard(view.server)
+	}
+	return nil
+}
+
+// wins per match played, as a percentage
+func FormatWinRate(entry shared.LeaderboardEntry) string {
+	if entry.Matches == 0 {
+		return "--"
+	}
+	return fmt.Sprintf("%d%%", entry.Wins*100/entry.Matches)
+}
+
+// kills per death, players who never died have their kills
+func FormatKillDeathRatio(entry shared.LeaderboardEntry) string {
+	return fmt.Sprintf("%.2f", float64(entry.Kills)/float64(max(entry.Deaths, 1)))
+}
+
+func (g *Game) DrawLeaderboard(screen *ebiten.Image) {
+	g.DrawStripes(screen)
+
+	fontSize := 8.
+	font_face := &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}
+	view := g.context.leaderboard
+	left := RENDER_WIDTH/2 - 25*fontSize
+
+	textOp := text.DrawOptions{}
+	msg := fmt.Sprintf("leaderboard of '%s'", view.server.Name)
+	waited := g.context.background_time - view.opened
+	switch {
+	case view.server.Ip == "":
+		msg = "join a server to see its leaderboard"
+	case view.board == nil && waited >= LEADERBOARD_TIMEOUT:
+		msg = fmt.Sprintf("'%s' did not answer", view.server.Name)
+	case view.board == nil:
+		msg = fmt.Sprintf("asking '%s'...", view.server.Name)
+	case len(view.board.Entries) == 0:
+		msg = fmt.Sprintf("nobody has finished a match on '%s' yet", view.server.Name)
+	}
+	textOp.GeoM.Translate(1, 1)
+	text.Draw(screen, msg, font_face, &textOp)
+
+	if view.board != nil && len(view.board.Entries) > 0 {
+		textOp = text.DrawOptions{}
+		msg = fmt.Sprintf("%3s %-*s| %-7s| %-5s| %-5s| %s", "#", shared.USERNAME_MAX_LENGTH, "name", "rating", "win", "k/d", "matches")
+		textOp.GeoM.Translate(left, fontSize*3)
+		text.Draw(screen, msg, font_face, &textOp)
+
+		for i, entry := range view.board.Entries {
+			textOp := text.DrawOptions{}
+			msg := fmt.Sprintf("%3d %-*s| %-7d| %-5s| %-5s| %d", i+1, shared.USERNAME_MAX_LENGTH, entry.Username, entry.Rating,
+				FormatWinRate(entry), FormatKillDeathRatio(entry), entry.Matches)
+			textOp.GeoM.Translate(left, float64(i+4)*(fontSize+2))
+			text.Draw(screen, msg, font_face, &textOp)
+		}
+	}
+
+	textOp = text.DrawOptions{}
+	msg = "* back to menu"
+	textOp.GeoM.Translate(RENDER_WIDTH/2, RENDER_HEIGHT-(fontSize*3))
+	textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, fontSize)
+	text.Draw(screen, msg, font_face, &textOp)
+}
+
+// answers from servers we did not ask are dropped
+func (c *Client) acceptLeaderboard(addr net.UDPAddr, board shared.Leaderboard) {
+	if addr.String() != c.leaderboard_from {
+		return
+	}
+	c.leaderboard = &board
+}
@@ -2,13 +2,6 @@ package game
 
 import "fmt"
 
-const (
-	LoaderAutoloader uint8 = iota + 1 // Starts at 1 to avoid GOB's zero-value issue
-	LoaderFastReload
-	LoaderManualReload
-	LoaderEnd
-)
-
 func DetermineMaxMagMultiplier(loader_type uint8) float64 {
 	switch loader_type {
 	case LoaderAutoloader:
@@ -29,19 +22,6 @@ func DetermineReloadSpeedMultiplier(loader_type uint8) float64 {
 	}
 }
 
-func DetermineLoaderName(loader_type uint8) string {
-	switch loader_type {
-	case LoaderAutoloader:
-		return "autoloader"
-	case LoaderFastReload:
-		return "standard"
-	case LoaderManualReload:
-		return "manual"
-	default:
-		return "missing!"
-	}
-}
-
 func DetermineLoaderDesc(loader_type uint8) string {
 	switch loader_type {
 	case LoaderAutoloader:
@@ -20,6 +20,9 @@ func (g *Game) DrawLobby(screen *ebiten.Image) {
 
 	textOp := text.DrawOptions{}
 	msg := fmt.Sprintf("server: '%s'", g.context.current_server.Name)
+	if g.context.current_server.Join_code != "" {
+		msg = fmt.Sprintf("server: '%s' code: %s", g.context.current_server.Name, g.context.current_server.Join_code)
+	}
 	textOp.GeoM.Translate(1, 1)
 	font_face := &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}
 
@@ -38,8 +41,8 @@ func (g *Game) DrawLobby(screen *ebiten.Image) {
 	for i := range 4 {
 		clr := player_palette[i%len(player_palette)]
 		padding := 5
-		// padding + player name truncated + spacing + is ready + padding
-		width := 8 * (padding + 8 + 1 + 1 + padding)
+		// padding + player name + spacing + is ready + padding
+		width := 8 * (padding + shared.USERNAME_MAX_LENGTH + 1 + 1 + padding)
 		// padding + font size + padding
 		height := padding + 8 + padding
 
@@ -65,12 +68,17 @@ func (g *Game) DrawLobby(screen *ebiten.Image) {
 			}
 
 			vector.StrokeRect(screen, (RENDER_WIDTH/2)-float32(width/2), (RENDER_HEIGHT/2)+float32(i)*float32(fontSize+float64(margin*2)+stroke_width), float32(width), float32(height), float32(stroke_width), clr, true)
-			msg = fmt.Sprintf("%s %s", player.ID[0:8], PlayerReadyString(player.Ready))
+			msg = fmt.Sprintf("%-*s %s", shared.USERNAME_MAX_LENGTH, PlayerName(player), PlayerReadyString(player.Ready))
+			if NetBoolify(player.Spectating) {
+				msg = fmt.Sprintf("%-*s S", shared.USERNAME_MAX_LENGTH, PlayerName(player))
+			}
 			textOp.ColorScale.Reset()
 			text.Draw(screen, msg, font_face, &textOp)
 		}
 	}
 
+	g.DrawServerMessage(screen)
+
 	// TODO draw time until start when all are ready
 }
 
@@ -78,6 +86,9 @@ func (g *Game) UpdateLobby() error {
 	g.context.background_time++
 
 	g.nm.client.KeepAlive(g)
+	if g.context.background_time%30 == 0 {
+		g.nm.client.Negotiate()
+	}
 
 	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
 		g.nm.client.Send(shared.PacketTypeClientToggleReady, []byte{})
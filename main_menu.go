@@ -1,6 +1,9 @@
 package game
 
 import (
+	"fmt"
+	"gotanks/shared"
+
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text/v2"
@@ -27,21 +30,80 @@ func (g *Game) DrawMainMenu(screen *ebiten.Image) {
 	textOp.GeoM.Translate(RENDER_WIDTH/2, RENDER_HEIGHT/2+fontSize*5)
 	textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, fontSize)
 	text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
+
+	textOp = text.DrawOptions{}
+	name := g.nm.client.username()
+	if g.context.editing_name {
+		name = g.context.name_input.Display()
+	}
+	msg = fmt.Sprintf("  name: %s", name)
+	if g.context.current_selection == 2 {
+		msg = fmt.Sprintf("* name: %s", name)
+	}
+	textOp.GeoM.Translate(RENDER_WIDTH/2, RENDER_HEIGHT/2+fontSize*7)
+	textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, fontSize)
+	text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
+
+	textOp = text.DrawOptions{}
+	msg = "  leaderboard"
+	if g.context.current_selection == 3 {
+		msg = "* leaderboard"
+	}
+	textOp.GeoM.Translate(RENDER_WIDTH/2, RENDER_HEIGHT/2+fontSize*9)
+	textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, fontSize)
+	text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
+
+	if g.context.name_error != "" {
+		textOp = text.DrawOptions{}
+		msg = g.context.name_error
+		textOp.GeoM.Translate(RENDER_WIDTH/2, RENDER_HEIGHT/2+fontSize*11)
+		textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, fontSize)
+		text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
+	}
+}
+
+// typing a new name, enter keeps it if it is valid and escape gives up
+func (g *Game) UpdateNameInput() {
+	ctx := &g.context
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		ctx.editing_name = false
+		ctx.name_error = ""
+		return
+	}
+	if !ctx.name_input.Update() {
+		return
+	}
+
+	name := ctx.name_input.String()
+	if err := shared.ValidateUsername(name); err != nil {
+		ctx.name_error = err.Error()
+		return
+	}
+	g.sm.data.Username = name
+	g.sm.Save()
+	ctx.editing_name = false
+	ctx.name_error = ""
 }
 
 func (g *Game) UpdateMainMenu() error {
 	g.context.background_time++
 
+	// the keys below are typed into the name instead
+	if g.context.editing_name {
+		g.UpdateNameInput()
+		return nil
+	}
+
 	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
 		g.context.current_selection++
-		if g.context.current_selection >= 2 {
+		if g.context.current_selection >= 4 {
 			g.context.current_selection = 0
 		}
 	}
 	if inpututil.IsKeyJustPressed(ebiten.KeyW) {
 		g.context.current_selection--
 		if g.context.current_selection < 0 {
-			g.context.current_selection = 1
+			g.context.current_selection = 3
 		}
 	}
 	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
@@ -51,6 +113,13 @@ func (g *Game) UpdateMainMenu() error {
 		if g.context.current_selection == 1 {
 			g.HostServer()
 		}
+		if g.context.current_selection == 2 {
+			g.context.name_input = TextInput{max_length: shared.USERNAME_MAX_LENGTH}
+			g.context.editing_name = true
+		}
+		if g.context.current_selection == 3 {
+			g.OpenLeaderboard()
+		}
 	}
 	return nil
 }
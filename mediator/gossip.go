@@ -0,0 +1,151 @@
+package mediator
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"net"
+	"time"
+)
+
+// has to stay well below TIMEOUT, peers forget hosts they stop hearing about
+const GOSSIP_INTERVAL = time.Second * 2
+
+// the largest gossip packet, leaving room below BUFFER_SIZE for the header
+const GOSSIP_PACKET_SIZE = BUFFER_SIZE - 256
+
+// older gossip is dropped, so recorded packets can not be replayed later.
+// peers' clocks have to be this close to ours
+const GOSSIP_MAX_AGE = TIMEOUT
+
+var ErrBadGossip = errors.New("gossip is not signed with our secret")
+
+// what peers send each other, Mac signs the rest with Options.Secret.
+// the source address of udp is easily forged, the secret is not
+type GossipData struct {
+	Hosts   []Host
+	Sent_at int64
+	Mac     []byte
+}
+
+func gossipMac(secret string, hosts []Host, sent_at int64) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(GossipData{Hosts: hosts, Sent_at: sent_at})
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(buf.Bytes())
+	return mac.Sum(nil), nil
+}
+
+func signGossip(secret string, hosts []Host, now time.Time) (GossipData, error) {
+	gossip := GossipData{Hosts: hosts, Sent_at: now.UnixMilli()}
+	mac, err := gossipMac(secret, hosts, gossip.Sent_at)
+	gossip.Mac = mac
+	return gossip, err
+}
+
+// whether gossip was signed with secret, recently
+func verifyGossip(secret string, gossip GossipData, now time.Time) bool {
+	if secret == "" {
+		return false
+	}
+	age := now.Sub(time.UnixMilli(gossip.Sent_at))
+	if age > GOSSIP_MAX_AGE || age < -GOSSIP_MAX_AGE {
+		return false
+	}
+	mac, err := gossipMac(secret, gossip.Hosts, gossip.Sent_at)
+	return err == nil && hmac.Equal(mac, gossip.Mac)
+}
+
+func (m *Mediator) isPeer(addr net.UDPAddr) bool {
+	for _, peer := range m.options.Peers {
+		if peer.IP.Equal(addr.IP) && peer.Port == addr.Port {
+			return true
+		}
+	}
+	return false
+}
+
+// splits hosts into chunks which each fit in a single gossip packet
+func gossipChunks(hosts []Host) ([][]Host, error) {
+	chunks := [][]Host{}
+	chunk := []Host{}
+	for _, host := range hosts {
+		candidate := append(chunk, host)
+		// the mac is as large whatever the secret
+		signed, err := signGossip("", candidate, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		serialized_packet, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeMediatorGossip}, [16]byte{}, signed)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(serialized_packet) <= GOSSIP_PACKET_SIZE {
+			chunk = candidate
+			continue
+		}
+		if len(chunk) == 0 {
+			return nil, fmt.Errorf("host '%s' is too large to gossip", host.Name)
+		}
+		chunks = append(chunks, chunk)
+		chunk = []Host{host}
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// tells every peer about the hosts registered here.
+// hosts learned from peers are not passed on, so peers have to know about
+// each other directly
+func (m *Mediator) gossip() error {
+	if len(m.options.Peers) == 0 {
+		return nil
+	}
+
+	chunks, err := gossipChunks(m.registry.Local())
+	if err != nil {
+		return err
+	}
+
+	for _, peer := range m.options.Peers {
+		for _, chunk := range chunks {
+			signed, err := signGossip(m.options.Secret, chunk, m.registry.clock())
+			if err != nil {
+				return err
+			}
+			err = m.send(shared.PacketTypeMediatorGossip, signed, peer)
+			if err != nil {
+				return fmt.Errorf("error gossiping to %s: %w", peer, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Mediator) handleGossip(packet_data shared.PacketData) error {
+	if !m.isPeer(packet_data.Addr) {
+		return fmt.Errorf("gossip from %s, which is not a peer", &packet_data.Addr)
+	}
+
+	var gossip GossipData
+	err := gob.NewDecoder(bytes.NewReader(packet_data.Data)).Decode(&gossip)
+	if err != nil {
+		return fmt.Errorf("error decoding gossip: %w", err)
+	}
+	if !verifyGossip(m.options.Secret, gossip, m.registry.clock()) {
+		return ErrBadGossip
+	}
+
+	m.registry.Merge(packet_data.Addr.String(), gossip.Hosts)
+	return nil
+}
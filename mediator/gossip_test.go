@@ -0,0 +1,147 @@
+package mediator
+
+import (
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"net"
+	"testing"
+	"time"
+)
+
+func gossipHost(id, ip string, port int) Host {
+	return Host{AvailableServer: shared.AvailableServer{Host_ID: id, Name: id, Ip: ip, Port: port}}
+}
+
+func newGossipMediator(peer net.UDPAddr) (*Mediator, *fakeConn, *fakeClock) {
+	m, conn, clock := newTestMediator()
+	m.options.Peers = []*net.UDPAddr{&peer}
+	return m, conn, clock
+}
+
+func TestGossipIsMerged(t *testing.T) {
+	peer := udpAddr("10.0.0.9", 8080)
+	m, _, clock := newGossipMediator(peer)
+
+	gossip, err := signGossip(m.options.Secret, []Host{gossipHost("remote", "10.0.1.1", 7707)}, clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.HandlePacket(packetFrom(t, peer, shared.PacketTypeMediatorGossip, gossip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, ok := m.Registry().Get("remote")
+	if !ok || host.Origin != peer.String() {
+		t.Fatalf("gossiped host was not merged: %+v", host)
+	}
+}
+
+func TestGossipNeedsSecret(t *testing.T) {
+	peer := udpAddr("10.0.0.9", 8080)
+	m, _, clock := newGossipMediator(peer)
+	hosts := []Host{gossipHost("forged", "10.0.1.1", 7707)}
+
+	unsigned := GossipData{Hosts: hosts, Sent_at: clock.Now().UnixMilli()}
+	forged, _ := signGossip("guessed", hosts, clock.Now())
+	stale, _ := signGossip(m.options.Secret, hosts, clock.Now().Add(-GOSSIP_MAX_AGE-time.Second))
+	for name, gossip := range map[string]GossipData{"unsigned": unsigned, "another secret": forged, "stale": stale} {
+		err := m.HandlePacket(packetFrom(t, peer, shared.PacketTypeMediatorGossip, gossip))
+		if !errors.Is(err, ErrBadGossip) {
+			t.Errorf("%s: expected ErrBadGossip, got %v", name, err)
+		}
+	}
+
+	// tampering with signed gossip
+	signed, _ := signGossip(m.options.Secret, hosts, clock.Now())
+	signed.Hosts[0].Ip = "10.6.6.6"
+	err := m.HandlePacket(packetFrom(t, peer, shared.PacketTypeMediatorGossip, signed))
+	if !errors.Is(err, ErrBadGossip) {
+		t.Errorf("tampered: expected ErrBadGossip, got %v", err)
+	}
+
+	if m.Registry().Len() != 0 {
+		t.Fatal("unauthenticated gossip was merged")
+	}
+}
+
+func TestGossipFromStranger(t *testing.T) {
+	m, _, clock := newGossipMediator(udpAddr("10.0.0.9", 8080))
+
+	gossip, _ := signGossip(m.options.Secret, []Host{gossipHost("remote", "10.0.1.1", 7707)}, clock.Now())
+	err := m.HandlePacket(packetFrom(t, udpAddr("10.0.0.10", 8080), shared.PacketTypeMediatorGossip, gossip))
+	if err == nil || m.Registry().Len() != 0 {
+		t.Fatal("gossip from an address that is not a peer was merged")
+	}
+}
+
+func TestGossipHostsPerIp(t *testing.T) {
+	peer := udpAddr("10.0.0.9", 8080)
+	m, _, clock := newGossipMediator(peer)
+	limit := DefaultOptions().Max_hosts_per_ip
+
+	hosts := []Host{}
+	for port := range limit + 5 {
+		hosts = append(hosts, gossipHost(fmt.Sprintf("victim-%d", port), "10.0.1.1", 7707+port))
+	}
+	hosts = append(hosts, gossipHost("no address", "", 0))
+	gossip, _ := signGossip(m.options.Secret, hosts, clock.Now())
+	err := m.HandlePacket(packetFrom(t, peer, shared.PacketTypeMediatorGossip, gossip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Registry().Len() != limit {
+		t.Fatalf("expected %d merged hosts, got %d", limit, m.Registry().Len())
+	}
+	if _, ok := m.Registry().Get("no address"); ok {
+		t.Fatal("a host without an address was merged")
+	}
+
+	// refreshing what is already known is not held against the limit
+	clock.Advance(GOSSIP_INTERVAL)
+	gossip, _ = signGossip(m.options.Secret, hosts[:limit], clock.Now())
+	m.HandlePacket(packetFrom(t, peer, shared.PacketTypeMediatorGossip, gossip))
+	for _, host := range hosts[:limit] {
+		merged, ok := m.Registry().Get(host.Host_ID)
+		if !ok || !merged.Last_seen.Equal(clock.Now()) {
+			t.Fatalf("%s was not refreshed", host.Host_ID)
+		}
+	}
+}
+
+func TestGossipChunksAreSigned(t *testing.T) {
+	peer := udpAddr("10.0.0.9", 8080)
+	sender, conn, clock := newGossipMediator(peer)
+	for i := range 40 {
+		_, _, err := sender.Registry().Add(shared.ReconcilliationData{Name: "a rather long server name to need chunks"}, udpAddr(fmt.Sprintf("10.0.2.%d", i+1), 7707))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := sender.gossip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := conn.take()
+	if len(sent) < 2 {
+		t.Fatalf("expected the hosts to be split into chunks, got %d packets", len(sent))
+	}
+
+	receiver, _, _ := newGossipMediator(udpAddr("10.0.0.8", 8080))
+	merged := 0
+	for _, chunk := range sent {
+		if chunk.packet.TotalSize > BUFFER_SIZE {
+			t.Fatalf("a chunk of %d bytes does not fit the buffer", chunk.packet.TotalSize)
+		}
+		var gossip GossipData
+		decode(t, chunk, &gossip)
+		if !verifyGossip(receiver.options.Secret, gossip, clock.Now()) {
+			t.Fatal("a chunk is not signed")
+		}
+		merged += len(gossip.Hosts)
+	}
+	if merged != sender.Registry().Len() {
+		t.Fatalf("%d of %d hosts were gossiped", merged, sender.Registry().Len())
+	}
+}
@@ -0,0 +1,428 @@
+package mediator
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	PORT        = 8080
+	BUFFER_SIZE = 2048
+
+	TIMEOUT                = time.Millisecond * 7000
+	TIMEOUT_CHECK_INTERVAL = time.Second
+)
+
+// Conn is the part of *net.UDPConn the mediator depends on,
+// so that a fake socket can be used in its place
+type Conn interface {
+	ReadFromUDP(b []byte) (int, *net.UDPAddr, error)
+	WriteToUDP(b []byte, addr *net.UDPAddr) (int, error)
+	Close() error
+}
+
+var (
+	ErrRateLimited      = errors.New("rate limited")
+	ErrResponseTooLarge = errors.New("response would be larger than the request")
+)
+
+type Options struct {
+	// where the registry is persisted, so a restart does not lose every host.
+	// empty disables snapshots
+	Snapshot_path string
+
+	// zero values are replaced by the defaults below
+	Max_hosts_per_ip int
+	// registrations
+	Host_limit RateLimit
+	// keepalives and updates from registered servers
+	Server_limit RateLimit
+	// server lists and connects from players
+	Query_limit RateLimit
+
+	// other mediators to share hosts with, every peer needs this one in its
+	// own list as well
+	Peers []*net.UDPAddr
+	// signs gossip and the tokens servers reclaim their id and join code
+	// with after a restart, see Registry.Add. peers have to share it, as
+	// servers keep the same code with every mediator.
+	// empty picks a random one, so tokens only last until the next restart
+	// and gossip is never accepted
+	Secret string
+
+	// nil logs to slog.Default
+	Log *slog.Logger
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Max_hosts_per_ip: 16,
+		Host_limit:       RateLimit{Rate: 1, Burst: 5},
+		Server_limit:     RateLimit{Rate: 10, Burst: 20},
+		Query_limit:      RateLimit{Rate: 5, Burst: 20},
+	}
+}
+
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.Max_hosts_per_ip <= 0 {
+		o.Max_hosts_per_ip = defaults.Max_hosts_per_ip
+	}
+	if o.Host_limit.Rate <= 0 {
+		o.Host_limit = defaults.Host_limit
+	}
+	if o.Server_limit.Rate <= 0 {
+		o.Server_limit = defaults.Server_limit
+	}
+	if o.Query_limit.Rate <= 0 {
+		o.Query_limit = defaults.Query_limit
+	}
+	if o.Log == nil {
+		o.Log = slog.Default()
+	}
+	return o
+}
+
+type Mediator struct {
+	conn     Conn
+	registry *Registry
+	options  Options
+
+	host_limiter   *RateLimiter
+	server_limiter *RateLimiter
+	query_limiter  *RateLimiter
+
+	snapshot_version uint64
+
+	log *slog.Logger
+}
+
+func New(conn Conn, clock Clock, options Options) *Mediator {
+	options = options.withDefaults()
+	m := Mediator{conn: conn, registry: NewRegistry(clock), options: options, log: options.Log}
+	m.registry.max_hosts_per_ip = options.Max_hosts_per_ip
+	if options.Secret != "" {
+		m.registry.secret = []byte(options.Secret)
+	}
+	m.host_limiter = NewRateLimiter(options.Host_limit, clock)
+	m.server_limiter = NewRateLimiter(options.Server_limit, clock)
+	m.query_limiter = NewRateLimiter(options.Query_limit, clock)
+	return &m
+}
+
+func (m *Mediator) Registry() *Registry {
+	return m.registry
+}
+
+// saves the registry if it changed since the last snapshot
+func (m *Mediator) snapshot() {
+	if m.options.Snapshot_path == "" {
+		return
+	}
+
+	version := m.registry.Version()
+	if version == m.snapshot_version {
+		return
+	}
+
+	err := SaveSnapshot(m.options.Snapshot_path, m.registry)
+	if err != nil {
+		m.log.Error("error saving snapshot", shared.LogErr(err))
+		return
+	}
+	m.snapshot_version = version
+}
+
+// Run handles packets and times out stale hosts until ctx is cancelled.
+// the connection is closed when Run returns
+func (m *Mediator) Run(ctx context.Context) error {
+	defer m.conn.Close()
+
+	if m.options.Snapshot_path != "" {
+		restored, err := LoadSnapshot(m.options.Snapshot_path, m.registry)
+		if err != nil {
+			return fmt.Errorf("error loading snapshot: %w", err)
+		}
+		m.log.Info("restored hosts", "hosts", restored, "path", m.options.Snapshot_path)
+		m.snapshot_version = m.registry.Version()
+		// the final snapshot happens once the packet loop has stopped
+		defer func() {
+			m.snapshot_version = 0
+			m.snapshot()
+		}()
+	}
+
+	packet_channel := make(chan shared.PacketData)
+	errs := make(chan error, 1)
+	go m.listen(ctx, packet_channel, errs)
+
+	ticker := time.NewTicker(TIMEOUT_CHECK_INTERVAL)
+	defer ticker.Stop()
+	gossip_ticker := time.NewTicker(GOSSIP_INTERVAL)
+	defer gossip_ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			return err
+		case <-ticker.C:
+			for _, host := range m.registry.TimeoutStale(TIMEOUT) {
+				m.log.Info("host timed out", "host_id", host.Host_ID, "name", host.Name, "addr", net.JoinHostPort(host.Ip, strconv.Itoa(host.Port)))
+			}
+			m.snapshot()
+			m.host_limiter.Prune()
+			m.server_limiter.Prune()
+			m.query_limiter.Prune()
+		case <-gossip_ticker.C:
+			err := m.gossip()
+			if err != nil {
+				m.log.Warn("error gossiping", shared.LogErr(err))
+			}
+		case packet_data := <-packet_channel:
+			err := m.HandlePacket(packet_data)
+			if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrResponseTooLarge) {
+				// logging every dropped packet would make flooding the log just as easy
+				continue
+			}
+			if err != nil {
+				m.log.Warn("error handling packet", "type", packet_data.Packet.PacketType, shared.LogAddr("addr", &packet_data.Addr), shared.LogErr(err))
+			}
+		}
+	}
+}
+
+func (m *Mediator) listen(ctx context.Context, packet_channel chan<- shared.PacketData, errs chan<- error) {
+	buf := make([]byte, BUFFER_SIZE)
+	for {
+		n, addr, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				errs <- err
+			}
+			return
+		}
+
+		packet, data, err := shared.DeserializePacket(buf[:n])
+		if err != nil {
+			m.log.Debug("dropped unreadable packet", shared.LogAddr("addr", addr), shared.LogErr(err))
+			continue
+		}
+
+		select {
+		case packet_channel <- shared.PacketData{Packet: packet, Data: data, Addr: *addr}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Mediator) send(packet_type shared.PacketType, data interface{}, addr *net.UDPAddr) error {
+	serialized_packet, err := shared.SerializePacket(shared.Packet{PacketType: packet_type}, [16]byte{}, data)
+	if err != nil {
+		return fmt.Errorf("error serializing packet: %w", err)
+	}
+
+	_, err = m.conn.WriteToUDP(serialized_packet, addr)
+	return err
+}
+
+// answers the sender of request.
+// nobody has proven who they are at this point, and the sender address of
+// udp is easily forged, so the answer is never larger than the request to
+// keep the mediator from being used to amplify floods
+func (m *Mediator) reply(request shared.PacketData, packet_type shared.PacketType, data interface{}) error {
+	serialized_packet, err := shared.SerializePacket(shared.Packet{PacketType: packet_type}, [16]byte{}, data)
+	if err != nil {
+		return fmt.Errorf("error serializing packet: %w", err)
+	}
+
+	if len(serialized_packet) > int(request.Packet.TotalSize) {
+		return ErrResponseTooLarge
+	}
+
+	_, err = m.conn.WriteToUDP(serialized_packet, &request.Addr)
+	return err
+}
+
+// the largest page of servers starting at offset whose reply fits in size bytes
+func hostsPage(servers []shared.AvailableServer, offset int, size int) shared.HostsPage {
+	page := shared.HostsPage{Offset: offset, Total: len(servers)}
+	if offset < 0 || offset >= len(servers) {
+		page.Offset = 0
+		return page
+	}
+
+	for end := offset + 1; end <= len(servers); end++ {
+		candidate := shared.HostsPage{Servers: servers[offset:end], Offset: offset, Total: len(servers)}
+		serialized_packet, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeAvailableHosts}, [16]byte{}, candidate)
+		if err != nil || len(serialized_packet) > size {
+			break
+		}
+		page = candidate
+	}
+	return page
+}
+
+func (m *Mediator) limiterFor(packet_type shared.PacketType) *RateLimiter {
+	switch packet_type {
+	case shared.PacketTypeMatchHost:
+		return m.host_limiter
+	case shared.PacketTypeKeepAlive, shared.PacketTypeUpdateMediator, shared.PacketTypeMatchStart, shared.PacketTypeUnregisterHost:
+		return m.server_limiter
+	default:
+		return m.query_limiter
+	}
+}
+
+// finds the host a player wants to join, by id when picked from the server
+// list and by join code or name otherwise
+func (m *Mediator) resolve(request shared.ReconcilliationData) (Host, error) {
+	if request.Host_ID != "" {
+		host, ok := m.registry.Get(request.Host_ID)
+		if !ok {
+			return Host{}, ErrUnknownHost
+		}
+		return host, nil
+	}
+
+	if request.Join_code != "" {
+		return m.registry.FindByJoinCode(request.Join_code)
+	}
+
+	return m.registry.FindByName(request.Name)
+}
+
+func (m *Mediator) HandlePacket(packet_data shared.PacketData) error {
+	// peers prove who they are, and send as much as they need to
+	if packet_data.Packet.PacketType == shared.PacketTypeMediatorGossip {
+		return m.handleGossip(packet_data)
+	}
+
+	if !m.limiterFor(packet_data.Packet.PacketType).Allow(packet_data.Addr.IP.String()) {
+		return ErrRateLimited
+	}
+
+	dec := gob.NewDecoder(bytes.NewReader(packet_data.Data))
+	switch packet_data.Packet.PacketType {
+	case shared.PacketTypeAvailableHosts:
+		var query shared.HostsQuery
+		err := dec.Decode(&query)
+		if err != nil {
+			return fmt.Errorf("error decoding hosts query: %w", err)
+		}
+
+		page := hostsPage(m.registry.List(), query.Offset, int(packet_data.Packet.TotalSize))
+		return m.reply(packet_data, shared.PacketTypeAvailableHosts, page)
+	case shared.PacketTypeUpdateMediator:
+		var server shared.AvailableServer
+		err := dec.Decode(&server)
+		if err != nil {
+			return fmt.Errorf("error decoding server update: %w", err)
+		}
+
+		err = m.registry.Update(server, packet_data.Addr)
+		if errors.Is(err, ErrUnknownHost) {
+			return m.reply(packet_data, shared.PacketTypeUnknownHost, shared.ReconcilliationData{Host_ID: server.Host_ID, Room: server.Room})
+		}
+		if err != nil {
+			return fmt.Errorf("could not update '%s': %w", server.Host_ID, err)
+		}
+	case shared.PacketTypeKeepAlive:
+		var inner_data shared.ReconcilliationData
+		err := dec.Decode(&inner_data)
+		if err != nil {
+			return fmt.Errorf("error decoding keepalive: %w", err)
+		}
+
+		err = m.registry.KeepAlive(inner_data.Host_ID, packet_data.Addr)
+		if errors.Is(err, ErrUnknownHost) {
+			// most likely we restarted or timed it out, so it should register again
+			return m.reply(packet_data, shared.PacketTypeUnknownHost, shared.ReconcilliationData{Host_ID: inner_data.Host_ID, Room: inner_data.Room})
+		}
+		if err != nil {
+			return fmt.Errorf("could not keep '%s' alive: %w", inner_data.Host_ID, err)
+		}
+	case shared.PacketTypeMatchConnect:
+		var inner_data shared.ReconcilliationData
+		err := dec.Decode(&inner_data)
+		if err != nil {
+			return fmt.Errorf("error decoding connect request: %w", err)
+		}
+
+		host, err := m.resolve(inner_data)
+		if err != nil {
+			return fmt.Errorf("could not find match: %w", err)
+		}
+
+		tar_addr := &net.UDPAddr{IP: net.ParseIP(host.Ip), Port: host.Port}
+		m.log.Info("sending new player to server", shared.LogAddr("addr", &packet_data.Addr), "host_id", host.Host_ID, shared.LogAddr("server", tar_addr))
+		err = m.send(shared.PacketTypeMatchConnect, packet_data.Addr, tar_addr)
+		if err != nil {
+			return err
+		}
+
+		// players joining by name do not know where the server is yet
+		return m.reply(packet_data, shared.PacketTypeMatchConnect, host.AvailableServer)
+	case shared.PacketTypeMatchHost:
+		var inner_data shared.ReconcilliationData
+		err := dec.Decode(&inner_data)
+		if err != nil {
+			return fmt.Errorf("error decoding host request: %w", err)
+		}
+
+		if inner_data.Name == "" {
+			return errors.New("can not host without a name")
+		}
+
+		id, fresh, err := m.registry.Add(inner_data, packet_data.Addr)
+		if err != nil {
+			return fmt.Errorf("could not add '%s': %w", inner_data.Name, err)
+		}
+		host, _ := m.registry.Get(id)
+		if fresh {
+			m.log.Info("added new host", "host_id", id, "name", inner_data.Name, shared.LogAddr("addr", &packet_data.Addr), "join_code", host.Join_code)
+		}
+
+		// the server learns its id from this reply, so it is sent again
+		// for repeated registrations in case the first one got lost
+		reply := shared.ReconcilliationData{Name: inner_data.Name, Host_ID: id, Join_code: host.Join_code, Room: host.Room, Token: m.registry.Token(id, host.Join_code)}
+		return m.reply(packet_data, shared.PacketTypeMatchHost, reply)
+	case shared.PacketTypeMatchStart:
+		var inner_data shared.ReconcilliationData
+		err := dec.Decode(&inner_data)
+		if err != nil {
+			return fmt.Errorf("error decoding match start: %w", err)
+		}
+
+		// running matches stay listed, players joining them spectate until the next round
+		err = m.registry.MarkStarted(inner_data.Host_ID, packet_data.Addr)
+		if err != nil {
+			return fmt.Errorf("could not mark '%s' as started: %w", inner_data.Host_ID, err)
+		}
+		m.log.Info("server has started a match", "host_id", inner_data.Host_ID, shared.LogAddr("addr", &packet_data.Addr))
+	case shared.PacketTypeUnregisterHost:
+		var inner_data shared.ReconcilliationData
+		err := dec.Decode(&inner_data)
+		if err != nil {
+			return fmt.Errorf("error decoding unregistration: %w", err)
+		}
+
+		err = m.registry.Remove(inner_data.Host_ID, packet_data.Addr)
+		if err != nil {
+			return fmt.Errorf("could not remove '%s': %w", inner_data.Host_ID, err)
+		}
+		m.log.Info("host unregistered", "host_id", inner_data.Host_ID, "name", inner_data.Name, shared.LogAddr("addr", &packet_data.Addr))
+	}
+
+	return nil
+}
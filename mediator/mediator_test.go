@@ -0,0 +1,403 @@
+package mediator
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"gotanks/shared"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a packet the mediator wrote to fakeConn
+type sentPacket struct {
+	packet shared.Packet
+	data   []byte
+	addr   net.UDPAddr
+}
+
+// stands in for the udp socket, keeping whatever is written to it
+type fakeConn struct {
+	sync.Mutex
+	sent   []sentPacket
+	closed chan struct{}
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{closed: make(chan struct{})}
+}
+
+func (c *fakeConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	<-c.closed
+	return 0, nil, net.ErrClosed
+}
+
+func (c *fakeConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	packet, data, err := shared.DeserializePacket(b)
+	if err != nil {
+		return 0, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.sent = append(c.sent, sentPacket{packet: packet, data: data, addr: *addr})
+	return len(b), nil
+}
+
+func (c *fakeConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+// everything written since the last call
+func (c *fakeConn) take() []sentPacket {
+	c.Lock()
+	defer c.Unlock()
+	sent := c.sent
+	c.sent = nil
+	return sent
+}
+
+// a clock which only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func udpAddr(ip string, port int) net.UDPAddr {
+	return net.UDPAddr{IP: net.ParseIP(ip).To4(), Port: port}
+}
+
+// what the mediator would read off the socket if addr sent data
+func packetFrom(t *testing.T, addr net.UDPAddr, packet_type shared.PacketType, data interface{}) shared.PacketData {
+	t.Helper()
+	raw_data, err := shared.SerializePacket(shared.Packet{PacketType: packet_type}, [16]byte{}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, payload, err := shared.DeserializePacket(raw_data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shared.PacketData{Packet: packet, Data: payload, Addr: addr}
+}
+
+func decode(t *testing.T, sent sentPacket, v interface{}) {
+	t.Helper()
+	err := gob.NewDecoder(bytes.NewReader(sent.data)).Decode(v)
+	if err != nil {
+		t.Fatalf("error decoding %s: %v", sent.packet.PacketType, err)
+	}
+}
+
+// expects exactly one packet of packet_type to have been sent to addr
+func expectReply(t *testing.T, conn *fakeConn, packet_type shared.PacketType, addr net.UDPAddr) sentPacket {
+	t.Helper()
+	sent := conn.take()
+	if len(sent) != 1 {
+		t.Fatalf("expected one packet, got %d", len(sent))
+	}
+	if sent[0].packet.PacketType != packet_type {
+		t.Fatalf("expected %s, got %s", packet_type, sent[0].packet.PacketType)
+	}
+	if sent[0].addr.String() != addr.String() {
+		t.Fatalf("expected a packet to %s, it went to %s", &addr, &sent[0].addr)
+	}
+	return sent[0]
+}
+
+func newTestMediator() (*Mediator, *fakeConn, *fakeClock) {
+	conn := newFakeConn()
+	clock := newFakeClock()
+	return New(conn, clock.Now, Options{Secret: "shared by peers", Log: slog.New(slog.NewTextHandler(io.Discard, nil))}), conn, clock
+}
+
+// registers a server called name from addr and returns its id and join code
+func register(t *testing.T, m *Mediator, conn *fakeConn, addr net.UDPAddr, name string) (string, string) {
+	t.Helper()
+	request := shared.ReconcilliationData{Name: name, Padding: make([]byte, shared.QUERY_PADDING)}
+	err := m.HandlePacket(packetFrom(t, addr, shared.PacketTypeMatchHost, request))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reply shared.ReconcilliationData
+	decode(t, expectReply(t, conn, shared.PacketTypeMatchHost, addr), &reply)
+	if reply.Host_ID == "" || reply.Join_code == "" {
+		t.Fatalf("registration reply lacks an id or join code: %+v", reply)
+	}
+	return reply.Host_ID, reply.Join_code
+}
+
+func TestMatchHostRegisters(t *testing.T) {
+	m, conn, _ := newTestMediator()
+	server := udpAddr("10.0.0.1", 7707)
+
+	id, code := register(t, m, conn, server, "alpha")
+
+	host, ok := m.Registry().Get(id)
+	if !ok {
+		t.Fatal("registered host is not in the registry")
+	}
+	if host.Name != "alpha" || host.Join_code != code || host.Ip != "10.0.0.1" || host.Port != 7707 {
+		t.Fatalf("unexpected host %+v", host)
+	}
+
+	again, _ := register(t, m, conn, server, "alpha")
+	if again != id {
+		t.Fatalf("repeated registration got id %s, expected %s", again, id)
+	}
+	if m.Registry().Len() != 1 {
+		t.Fatalf("expected 1 host, got %d", m.Registry().Len())
+	}
+}
+
+func TestMatchHostNeedsName(t *testing.T) {
+	m, conn, _ := newTestMediator()
+	request := shared.ReconcilliationData{Padding: make([]byte, shared.QUERY_PADDING)}
+
+	err := m.HandlePacket(packetFrom(t, udpAddr("10.0.0.1", 7707), shared.PacketTypeMatchHost, request))
+	if err == nil {
+		t.Fatal("registering without a name succeeded")
+	}
+	if len(conn.take()) != 0 {
+		t.Fatal("a nameless registration was answered")
+	}
+}
+
+func TestMatchHostReplyIsNotLargerThanRequest(t *testing.T) {
+	m, conn, _ := newTestMediator()
+
+	// no padding, the reply with an id and join code would be larger
+	err := m.HandlePacket(packetFrom(t, udpAddr("10.0.0.1", 7707), shared.PacketTypeMatchHost, shared.ReconcilliationData{Name: "alpha"}))
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("expected ErrResponseTooLarge, got %v", err)
+	}
+	if len(conn.take()) != 0 {
+		t.Fatal("an unpadded registration was answered")
+	}
+}
+
+func TestKeepAliveKeepsHost(t *testing.T) {
+	m, conn, clock := newTestMediator()
+	server := udpAddr("10.0.0.1", 7707)
+	id, _ := register(t, m, conn, server, "alpha")
+
+	for range 3 {
+		clock.Advance(TIMEOUT - time.Second)
+		err := m.HandlePacket(packetFrom(t, server, shared.PacketTypeKeepAlive, shared.ReconcilliationData{Host_ID: id}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed := m.Registry().TimeoutStale(TIMEOUT); len(removed) != 0 {
+			t.Fatalf("host kept alive timed out: %+v", removed)
+		}
+	}
+	if len(conn.take()) != 0 {
+		t.Fatal("keepalives of a known host were answered")
+	}
+
+	clock.Advance(TIMEOUT + time.Second)
+	removed := m.Registry().TimeoutStale(TIMEOUT)
+	if len(removed) != 1 || removed[0].Host_ID != id {
+		t.Fatalf("expected %s to time out, got %+v", id, removed)
+	}
+}
+
+func TestKeepAliveUnknownHost(t *testing.T) {
+	m, conn, _ := newTestMediator()
+	server := udpAddr("10.0.0.1", 7707)
+
+	err := m.HandlePacket(packetFrom(t, server, shared.PacketTypeKeepAlive, shared.ReconcilliationData{Host_ID: "gone", Room: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reply shared.ReconcilliationData
+	decode(t, expectReply(t, conn, shared.PacketTypeUnknownHost, server), &reply)
+	if reply.Host_ID != "gone" || reply.Room != 2 {
+		t.Fatalf("unexpected unknown host reply %+v", reply)
+	}
+}
+
+func TestKeepAliveFromAnotherAddress(t *testing.T) {
+	m, conn, clock := newTestMediator()
+	id, _ := register(t, m, conn, udpAddr("10.0.0.1", 7707), "alpha")
+
+	clock.Advance(TIMEOUT - time.Second)
+	err := m.HandlePacket(packetFrom(t, udpAddr("10.0.0.2", 7707), shared.PacketTypeKeepAlive, shared.ReconcilliationData{Host_ID: id}))
+	if !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected ErrNotOwner, got %v", err)
+	}
+
+	clock.Advance(2 * time.Second)
+	if removed := m.Registry().TimeoutStale(TIMEOUT); len(removed) != 1 {
+		t.Fatal("a keepalive from someone else kept the host alive")
+	}
+}
+
+func TestUpdateMediator(t *testing.T) {
+	m, conn, _ := newTestMediator()
+	server := udpAddr("10.0.0.1", 7707)
+	id, _ := register(t, m, conn, server, "alpha")
+
+	update := shared.AvailableServer{Host_ID: id, Player_count: 3, Max_players: 4, State: shared.ServerListingInMatch, Round: 2}
+	err := m.HandlePacket(packetFrom(t, server, shared.PacketTypeUpdateMediator, update))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.take()) != 0 {
+		t.Fatal("an update of a known host was answered")
+	}
+
+	list := m.Registry().List()
+	if len(list) != 1 {
+		t.Fatalf("expected 1 listed server, got %d", len(list))
+	}
+	if list[0].Player_count != 3 || list[0].Max_players != 4 || !list[0].InProgress() || list[0].Round != 2 {
+		t.Fatalf("update was not applied: %+v", list[0])
+	}
+
+	update.Player_count = 0
+	err = m.HandlePacket(packetFrom(t, udpAddr("10.0.0.2", 7707), shared.PacketTypeUpdateMediator, update))
+	if !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("expected ErrNotOwner, got %v", err)
+	}
+	if host, _ := m.Registry().Get(id); host.Player_count != 3 {
+		t.Fatal("an update from someone else was applied")
+	}
+}
+
+func TestUpdateMediatorUnknownHost(t *testing.T) {
+	m, conn, _ := newTestMediator()
+	server := udpAddr("10.0.0.1", 7707)
+
+	err := m.HandlePacket(packetFrom(t, server, shared.PacketTypeUpdateMediator, shared.AvailableServer{Host_ID: "gone", Room: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reply shared.ReconcilliationData
+	decode(t, expectReply(t, conn, shared.PacketTypeUnknownHost, server), &reply)
+	if reply.Host_ID != "gone" || reply.Room != 1 {
+		t.Fatalf("unexpected unknown host reply %+v", reply)
+	}
+}
+
+func TestMatchConnectForwards(t *testing.T) {
+	m, conn, _ := newTestMediator()
+	server := udpAddr("10.0.0.1", 7707)
+	id, code := register(t, m, conn, server, "alpha")
+
+	requests := map[string]shared.ReconcilliationData{
+		"by id":        {Host_ID: id},
+		"by join code": {Join_code: code},
+		"by name":      {Name: "alpha"},
+	}
+	for how, request := range requests {
+		t.Run(how, func(t *testing.T) {
+			player := udpAddr("192.168.1.5", 40000)
+			request.Padding = make([]byte, shared.QUERY_PADDING)
+			err := m.HandlePacket(packetFrom(t, player, shared.PacketTypeMatchConnect, request))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sent := conn.take()
+			if len(sent) != 2 {
+				t.Fatalf("expected a packet to the server and one to the player, got %d", len(sent))
+			}
+
+			to_server, to_player := sent[0], sent[1]
+			if to_server.packet.PacketType != shared.PacketTypeMatchConnect || to_server.addr.String() != server.String() {
+				t.Fatalf("expected the server to be told first, got %s to %s", to_server.packet.PacketType, &to_server.addr)
+			}
+			var forwarded net.UDPAddr
+			decode(t, to_server, &forwarded)
+			if forwarded.String() != player.String() {
+				t.Fatalf("server was told about %s instead of %s", &forwarded, &player)
+			}
+
+			if to_player.packet.PacketType != shared.PacketTypeMatchConnect || to_player.addr.String() != player.String() {
+				t.Fatalf("expected the player to be answered, got %s to %s", to_player.packet.PacketType, &to_player.addr)
+			}
+			var found shared.AvailableServer
+			decode(t, to_player, &found)
+			if found.Host_ID != id || found.Ip != "10.0.0.1" || found.Port != 7707 {
+				t.Fatalf("player was sent %+v", found)
+			}
+		})
+	}
+}
+
+func TestMatchConnectUnknownHost(t *testing.T) {
+	m, conn, _ := newTestMediator()
+	request := shared.ReconcilliationData{Join_code: "ZZZZZZ", Padding: make([]byte, shared.QUERY_PADDING)}
+
+	err := m.HandlePacket(packetFrom(t, udpAddr("192.168.1.5", 40000), shared.PacketTypeMatchConnect, request))
+	if !errors.Is(err, ErrUnknownHost) {
+		t.Fatalf("expected ErrUnknownHost, got %v", err)
+	}
+	if len(conn.take()) != 0 {
+		t.Fatal("a connect to an unknown host sent something")
+	}
+}
+
+func TestHostsAreRateLimited(t *testing.T) {
+	m, conn, _ := newTestMediator()
+	server := udpAddr("10.0.0.1", 7707)
+	request := shared.ReconcilliationData{Name: "alpha", Padding: make([]byte, shared.QUERY_PADDING)}
+
+	limited := false
+	for range int(DefaultOptions().Host_limit.Burst) + 1 {
+		err := m.HandlePacket(packetFrom(t, server, shared.PacketTypeMatchHost, request))
+		if errors.Is(err, ErrRateLimited) {
+			limited = true
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !limited {
+		t.Fatal("registrations beyond the burst were not limited")
+	}
+	conn.take()
+}
+
+func TestMatchHostReplyCarriesToken(t *testing.T) {
+	m, conn, clock := newTestMediator()
+	server := udpAddr("10.0.0.1", 7707)
+	request := shared.ReconcilliationData{Name: "alpha", Padding: make([]byte, shared.QUERY_PADDING)}
+	m.HandlePacket(packetFrom(t, server, shared.PacketTypeMatchHost, request))
+	var reply shared.ReconcilliationData
+	decode(t, expectReply(t, conn, shared.PacketTypeMatchHost, server), &reply)
+	if reply.Token == "" {
+		t.Fatal("registration reply has no token")
+	}
+
+	clock.Advance(TIMEOUT + time.Second)
+	m.Registry().TimeoutStale(TIMEOUT)
+
+	request.Host_ID, request.Join_code, request.Token = reply.Host_ID, reply.Join_code, reply.Token
+	m.HandlePacket(packetFrom(t, server, shared.PacketTypeMatchHost, request))
+	var again shared.ReconcilliationData
+	decode(t, expectReply(t, conn, shared.PacketTypeMatchHost, server), &again)
+	if again.Host_ID != reply.Host_ID || again.Join_code != reply.Join_code || again.Token != reply.Token {
+		t.Fatalf("registering again with the token got %+v, expected %+v", again, reply)
+	}
+}
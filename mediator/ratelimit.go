@@ -0,0 +1,75 @@
+package mediator
+
+import (
+	"sync"
+	"time"
+)
+
+type RateLimit struct {
+	// tokens added per second
+	Rate float64
+	// the most tokens a bucket can hold, i.e. how many packets can arrive at once
+	Burst float64
+}
+
+type TokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps a token bucket per ip
+type RateLimiter struct {
+	sync.Mutex
+	limit   RateLimit
+	buckets map[string]*TokenBucket
+	clock   Clock
+}
+
+func NewRateLimiter(limit RateLimit, clock Clock) *RateLimiter {
+	if clock == nil {
+		clock = time.Now
+	}
+	return &RateLimiter{limit: limit, buckets: make(map[string]*TokenBucket), clock: clock}
+}
+
+// expects the limiter to be locked
+func (l *RateLimiter) refill(bucket *TokenBucket, now time.Time) {
+	elapsed := now.Sub(bucket.last).Seconds()
+	bucket.tokens = min(bucket.tokens+elapsed*l.limit.Rate, l.limit.Burst)
+	bucket.last = now
+}
+
+// Allow takes a token from the bucket of ip, returns false if it is empty
+func (l *RateLimiter) Allow(ip string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.clock()
+	bucket, ok := l.buckets[ip]
+	if !ok {
+		bucket = &TokenBucket{tokens: l.limit.Burst, last: now}
+		l.buckets[ip] = bucket
+	}
+	l.refill(bucket, now)
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// Prune forgets every bucket that has filled up again,
+// they are indistinguishable from a new one
+func (l *RateLimiter) Prune() {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.clock()
+	for ip, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= l.limit.Burst {
+			delete(l.buckets, ip)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package mediator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiter(RateLimit{Rate: 1, Burst: 3}, clock.Now)
+
+	for i := range 3 {
+		if !l.Allow("10.0.0.1") {
+			t.Fatalf("packet %d of the burst was limited", i+1)
+		}
+	}
+	if l.Allow("10.0.0.1") {
+		t.Fatal("a packet beyond the burst was allowed")
+	}
+	if !l.Allow("10.0.0.2") {
+		t.Fatal("another ip was limited")
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiter(RateLimit{Rate: 2, Burst: 2}, clock.Now)
+	l.Allow("10.0.0.1")
+	l.Allow("10.0.0.1")
+
+	clock.Advance(time.Millisecond * 400)
+	if l.Allow("10.0.0.1") {
+		t.Fatal("allowed before a whole token was added")
+	}
+	clock.Advance(time.Millisecond * 100)
+	if !l.Allow("10.0.0.1") {
+		t.Fatal("limited after a token was added")
+	}
+	if l.Allow("10.0.0.1") {
+		t.Fatal("one token was used twice")
+	}
+
+	// waiting longer does not save up more than the burst
+	clock.Advance(time.Hour)
+	for range 2 {
+		if !l.Allow("10.0.0.1") {
+			t.Fatal("limited after refilling")
+		}
+	}
+	if l.Allow("10.0.0.1") {
+		t.Fatal("tokens were saved up beyond the burst")
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiter(RateLimit{Rate: 1, Burst: 2}, clock.Now)
+	l.Allow("10.0.0.1")
+	l.Allow("10.0.0.2")
+	l.Allow("10.0.0.2")
+
+	clock.Advance(time.Second)
+	l.Prune()
+	if _, ok := l.buckets["10.0.0.1"]; ok {
+		t.Fatal("a full bucket was kept")
+	}
+	if _, ok := l.buckets["10.0.0.2"]; !ok {
+		t.Fatal("a bucket that is still filling up was forgotten")
+	}
+
+	clock.Advance(time.Second)
+	l.Prune()
+	if len(l.buckets) != 0 {
+		t.Fatalf("%d full buckets are left", len(l.buckets))
+	}
+}
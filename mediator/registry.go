@@ -0,0 +1,450 @@
+package mediator
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gotanks/shared"
+	"math/big"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownHost   = errors.New("unknown host")
+	ErrNotOwner      = errors.New("host is registered from another address")
+	ErrAmbiguousName = errors.New("more than one host has that name")
+	ErrTooManyHosts  = errors.New("too many hosts registered from that ip")
+)
+
+const (
+	JOIN_CODE_LENGTH = 6
+	// leaves out characters that are easily mistaken for each other, like 0 and O
+	JOIN_CODE_ALPHABET = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+)
+
+type Host struct {
+	Last_seen time.Time
+	Private   bool
+	// the peer mediator which told us about the host, empty if the host
+	// registered here
+	Origin string
+	shared.AvailableServer
+}
+
+// Clock returns the current time, it is injected so timeouts can be driven
+// deterministically instead of by the wall clock
+type Clock func() time.Time
+
+// Registry holds every host currently advertised by the mediator, keyed by
+// the host id handed out on registration.
+// all methods are safe to call from multiple goroutines
+type Registry struct {
+	sync.RWMutex
+	hosts map[string]Host
+	clock Clock
+
+	// bumped on every change worth persisting, keepalives are not
+	version uint64
+
+	// 0 means no limit
+	max_hosts_per_ip int
+
+	// signs the tokens servers get their id and join code back with,
+	// random unless set to one shared with peers, see Options.Secret
+	secret []byte
+}
+
+func NewRegistry(clock Clock) *Registry {
+	if clock == nil {
+		clock = time.Now
+	}
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		panic(err)
+	}
+	return &Registry{hosts: make(map[string]Host), clock: clock, secret: secret}
+}
+
+// Token is what a server has to show to get id and join_code back,
+// see shared.ReconcilliationData.Token
+func (r *Registry) Token(id, join_code string) string {
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte(id))
+	mac.Write([]byte{0})
+	mac.Write([]byte(join_code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// whether registration is allowed to ask for its id and join code back
+func (r *Registry) reclaims(registration shared.ReconcilliationData) bool {
+	if registration.Host_ID == "" || registration.Token == "" {
+		return false
+	}
+	token := r.Token(registration.Host_ID, shared.NormalizeJoinCode(registration.Join_code))
+	return hmac.Equal([]byte(token), []byte(registration.Token))
+}
+
+func ownedBy(host Host, addr net.UDPAddr) bool {
+	return host.Port == addr.Port && host.Ip == addr.IP.String()
+}
+
+func generateJoinCode() string {
+	code := make([]byte, JOIN_CODE_LENGTH)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(JOIN_CODE_ALPHABET))))
+		if err != nil {
+			panic(err)
+		}
+		code[i] = JOIN_CODE_ALPHABET[n.Int64()]
+	}
+	return string(code)
+}
+
+// expects the registry to be locked
+func (r *Registry) uniqueJoinCode() string {
+	for {
+		code := generateJoinCode()
+		if _, ok := r.findByJoinCode(code); !ok {
+			return code
+		}
+	}
+}
+
+// expects the registry to be locked
+func (r *Registry) findByJoinCode(code string) (Host, bool) {
+	for _, host := range r.hosts {
+		if host.Join_code == code {
+			return host, true
+		}
+	}
+	return Host{}, false
+}
+
+// Add registers a new host and returns its id.
+// a server repeating its registration from the same address with the same
+// name gets its existing id back, and fresh is false.
+// a server that was registered before, e.g. with a mediator that has since
+// restarted, can ask for its old id and join code back with the token it
+// was given, which it gets as long as nobody else has taken them.
+// without a token anyone could take over the code of a server that timed out
+func (r *Registry) Add(registration shared.ReconcilliationData, addr net.UDPAddr) (id string, fresh bool, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	for key, host := range r.hosts {
+		same_host := key == registration.Host_ID || (host.Name == registration.Name && host.Room == registration.Room)
+		if same_host && ownedBy(host, addr) {
+			host.Last_seen = r.clock()
+			host.Origin = ""
+			host.Private = registration.Private
+			host.Password_protected = registration.Password_protected
+			r.hosts[key] = host
+			r.version++
+			return key, false, nil
+		}
+	}
+
+	if r.max_hosts_per_ip > 0 {
+		from_ip := 0
+		for _, host := range r.hosts {
+			if host.Ip == addr.IP.String() && host.Origin == "" {
+				from_ip++
+			}
+		}
+		if from_ip >= r.max_hosts_per_ip {
+			return "", false, ErrTooManyHosts
+		}
+	}
+
+	id = uuid.NewString()
+	join_code := r.uniqueJoinCode()
+	if r.reclaims(registration) {
+		if _, taken := r.hosts[registration.Host_ID]; !taken {
+			id = registration.Host_ID
+		}
+		requested := shared.NormalizeJoinCode(registration.Join_code)
+		if _, taken := r.findByJoinCode(requested); !taken && len(requested) == JOIN_CODE_LENGTH {
+			join_code = requested
+		}
+	}
+
+	r.version++
+	r.hosts[id] = Host{
+		Last_seen: r.clock(),
+		Private:   registration.Private,
+		AvailableServer: shared.AvailableServer{
+			Host_ID:            id,
+			Join_code:          join_code,
+			Ip:                 addr.IP.String(),
+			Port:               addr.Port,
+			Name:               registration.Name,
+			Room:               registration.Room,
+			Password_protected: registration.Password_protected,
+			State:              shared.ServerListingLobby,
+		},
+	}
+	return id, true, nil
+}
+
+func (r *Registry) Get(id string) (Host, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	host, ok := r.hosts[id]
+	return host, ok
+}
+
+// FindByJoinCode looks up a host by its join code, private hosts included
+func (r *Registry) FindByJoinCode(code string) (Host, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	host, ok := r.findByJoinCode(shared.NormalizeJoinCode(code))
+	if !ok {
+		return Host{}, ErrUnknownHost
+	}
+	return host, nil
+}
+
+// FindByName looks up a host by its display name, private hosts included.
+// names are not unique, so this fails if several hosts share the name
+func (r *Registry) FindByName(name string) (Host, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	found := []Host{}
+	for _, host := range r.hosts {
+		if host.Name == name {
+			found = append(found, host)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return Host{}, ErrUnknownHost
+	case 1:
+		return found[0], nil
+	default:
+		return Host{}, ErrAmbiguousName
+	}
+}
+
+// Remove deletes the host with id, as long as it was registered from addr
+func (r *Registry) Remove(id string, addr net.UDPAddr) error {
+	r.Lock()
+	defer r.Unlock()
+
+	host, ok := r.hosts[id]
+	if !ok {
+		return ErrUnknownHost
+	}
+	if !ownedBy(host, addr) {
+		return ErrNotOwner
+	}
+
+	delete(r.hosts, id)
+	r.version++
+	return nil
+}
+
+// Update copies the player counts reported by a server onto its entry
+func (r *Registry) Update(server shared.AvailableServer, addr net.UDPAddr) error {
+	r.Lock()
+	defer r.Unlock()
+
+	host, ok := r.hosts[server.Host_ID]
+	if !ok {
+		return ErrUnknownHost
+	}
+	if !ownedBy(host, addr) {
+		return ErrNotOwner
+	}
+
+	host.Origin = ""
+	host.Max_players = server.Max_players
+	host.Player_count = server.Player_count
+	host.State = server.State
+	host.Round = server.Round
+	r.hosts[server.Host_ID] = host
+	r.version++
+	return nil
+}
+
+// MarkStarted flags a host as being in a match, until its next update says otherwise
+func (r *Registry) MarkStarted(id string, addr net.UDPAddr) error {
+	r.Lock()
+	defer r.Unlock()
+
+	host, ok := r.hosts[id]
+	if !ok {
+		return ErrUnknownHost
+	}
+	if !ownedBy(host, addr) {
+		return ErrNotOwner
+	}
+
+	host.State = shared.ServerListingInMatch
+	r.hosts[id] = host
+	r.version++
+	return nil
+}
+
+// KeepAlive refreshes the timeout of the host with id
+func (r *Registry) KeepAlive(id string, addr net.UDPAddr) error {
+	r.Lock()
+	defer r.Unlock()
+
+	host, ok := r.hosts[id]
+	if !ok {
+		return ErrUnknownHost
+	}
+	if !ownedBy(host, addr) {
+		return ErrNotOwner
+	}
+
+	host.Last_seen = r.clock()
+	host.Origin = ""
+	r.hosts[id] = host
+	return nil
+}
+
+// TimeoutStale removes every host which has not been seen within timeout
+// and returns the removed hosts
+func (r *Registry) TimeoutStale(timeout time.Duration) []Host {
+	r.Lock()
+	defer r.Unlock()
+
+	now := r.clock()
+	removed := []Host{}
+	for key, host := range r.hosts {
+		if now.Sub(host.Last_seen) > timeout {
+			removed = append(removed, host)
+			delete(r.hosts, key)
+			if host.Origin == "" {
+				r.version++
+			}
+		}
+	}
+	return removed
+}
+
+// List returns the public servers sorted by name.
+// ties are broken by id so the order is stable between requests
+func (r *Registry) List() []shared.AvailableServer {
+	r.RLock()
+	defer r.RUnlock()
+
+	l := make([]shared.AvailableServer, 0, len(r.hosts))
+	for _, host := range r.hosts {
+		if host.Private {
+			continue
+		}
+		l = append(l, host.AvailableServer)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Name == l[j].Name {
+			return l[i].Host_ID < l[j].Host_ID
+		}
+		return l[i].Name < l[j].Name
+	})
+	return l
+}
+
+func (r *Registry) Len() int {
+	r.RLock()
+	defer r.RUnlock()
+
+	return len(r.hosts)
+}
+
+func (r *Registry) Version() uint64 {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.version
+}
+
+// Local copies every host which registered here, private ones included.
+// hosts learned from peers are left out
+func (r *Registry) Local() []Host {
+	r.RLock()
+	defer r.RUnlock()
+
+	hosts := make([]Host, 0, len(r.hosts))
+	for _, host := range r.hosts {
+		if host.Origin != "" {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// Snapshot copies the hosts worth persisting, peers tell us about
+// their own hosts again soon enough
+func (r *Registry) Snapshot() []Host {
+	return r.Local()
+}
+
+// expects the registry to be locked
+func (r *Registry) hostsFrom(ip string) int {
+	n := 0
+	for _, host := range r.hosts {
+		if host.Ip == ip {
+			n++
+		}
+	}
+	return n
+}
+
+// Merge adds or refreshes the hosts a peer mediator told us about.
+// hosts which registered here directly are left alone, what they told us
+// is more recent than anything a peer knows.
+// players are sent to whatever address a host has, so peers are held to
+// the same hosts per ip as registrations.
+// like keepalives, merges do not bump the version
+func (r *Registry) Merge(origin string, hosts []Host) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := r.clock()
+	for _, host := range hosts {
+		if host.Host_ID == "" || net.ParseIP(host.Ip) == nil || host.Port <= 0 || host.Port > 65535 {
+			continue
+		}
+		existing, ok := r.hosts[host.Host_ID]
+		if ok && existing.Origin == "" {
+			continue
+		}
+		if r.max_hosts_per_ip > 0 && (!ok || existing.Ip != host.Ip) && r.hostsFrom(host.Ip) >= r.max_hosts_per_ip {
+			continue
+		}
+		host.Origin = origin
+		host.Last_seen = now
+		r.hosts[host.Host_ID] = host
+	}
+}
+
+// Restore adds hosts from a snapshot.
+// they count as just seen, giving them a full timeout to send a keepalive
+func (r *Registry) Restore(hosts []Host) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := r.clock()
+	for _, host := range hosts {
+		if host.Host_ID == "" {
+			continue
+		}
+		host.Last_seen = now
+		r.hosts[host.Host_ID] = host
+	}
+}
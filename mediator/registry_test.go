@@ -0,0 +1,224 @@
+package mediator
+
+import (
+	"errors"
+	"gotanks/shared"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryTimeoutStale(t *testing.T) {
+	clock := newFakeClock()
+	r := NewRegistry(clock.Now)
+
+	old, _, err := r.Add(shared.ReconcilliationData{Name: "old"}, udpAddr("10.0.0.1", 7707))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(TIMEOUT / 2)
+	recent, _, err := r.Add(shared.ReconcilliationData{Name: "recent"}, udpAddr("10.0.0.2", 7707))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(TIMEOUT/2 + time.Millisecond)
+	removed := r.TimeoutStale(TIMEOUT)
+	if len(removed) != 1 || removed[0].Host_ID != old {
+		t.Fatalf("expected only %s to time out, got %+v", old, removed)
+	}
+	if _, ok := r.Get(old); ok {
+		t.Fatal("timed out host is still registered")
+	}
+	if _, ok := r.Get(recent); !ok {
+		t.Fatal("recent host timed out")
+	}
+
+	clock.Advance(TIMEOUT)
+	removed = r.TimeoutStale(TIMEOUT)
+	if len(removed) != 1 || removed[0].Host_ID != recent {
+		t.Fatalf("expected %s to time out, got %+v", recent, removed)
+	}
+	if r.Len() != 0 {
+		t.Fatalf("expected an empty registry, %d hosts are left", r.Len())
+	}
+}
+
+func TestRegistryTimeoutStaleKeepsMergedHostsFromVersion(t *testing.T) {
+	clock := newFakeClock()
+	r := NewRegistry(clock.Now)
+
+	r.Merge("10.0.0.9:8080", []Host{{AvailableServer: shared.AvailableServer{Host_ID: "peer-host", Name: "remote", Ip: "10.0.1.1", Port: 7707}}})
+	version := r.Version()
+
+	clock.Advance(TIMEOUT + time.Second)
+	if removed := r.TimeoutStale(TIMEOUT); len(removed) != 1 {
+		t.Fatalf("expected the merged host to time out, got %+v", removed)
+	}
+	if r.Version() != version {
+		t.Fatal("timing out a host learned from a peer changed the version, it is never persisted")
+	}
+}
+
+func TestRegistryAddSameHost(t *testing.T) {
+	r := NewRegistry(newFakeClock().Now)
+	addr := udpAddr("10.0.0.1", 7707)
+
+	id, fresh, err := r.Add(shared.ReconcilliationData{Name: "alpha", Room: 1}, addr)
+	if err != nil || !fresh {
+		t.Fatalf("first registration: fresh %v, err %v", fresh, err)
+	}
+
+	again, fresh, err := r.Add(shared.ReconcilliationData{Name: "alpha", Room: 1, Private: true}, addr)
+	if err != nil || fresh || again != id {
+		t.Fatalf("repeated registration: id %s fresh %v err %v, expected %s", again, fresh, err, id)
+	}
+	if host, _ := r.Get(id); !host.Private {
+		t.Fatal("repeated registration did not update the host")
+	}
+
+	other_room, fresh, err := r.Add(shared.ReconcilliationData{Name: "alpha", Room: 2}, addr)
+	if err != nil || !fresh || other_room == id {
+		t.Fatalf("another room of the same server: id %s fresh %v err %v", other_room, fresh, err)
+	}
+}
+
+func TestRegistryHostsPerIp(t *testing.T) {
+	r := NewRegistry(newFakeClock().Now)
+	r.max_hosts_per_ip = 2
+
+	for port := 7707; port < 7709; port++ {
+		_, _, err := r.Add(shared.ReconcilliationData{Name: "alpha"}, udpAddr("10.0.0.1", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err := r.Add(shared.ReconcilliationData{Name: "alpha"}, udpAddr("10.0.0.1", 7709))
+	if !errors.Is(err, ErrTooManyHosts) {
+		t.Fatalf("expected ErrTooManyHosts, got %v", err)
+	}
+	_, _, err = r.Add(shared.ReconcilliationData{Name: "alpha"}, udpAddr("10.0.0.2", 7707))
+	if err != nil {
+		t.Fatalf("another ip was limited: %v", err)
+	}
+}
+
+func TestRegistryOwnership(t *testing.T) {
+	r := NewRegistry(newFakeClock().Now)
+	owner := udpAddr("10.0.0.1", 7707)
+	stranger := udpAddr("10.0.0.1", 7708)
+	id, _, _ := r.Add(shared.ReconcilliationData{Name: "alpha"}, owner)
+
+	if err := r.KeepAlive(id, stranger); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("keepalive: expected ErrNotOwner, got %v", err)
+	}
+	if err := r.Update(shared.AvailableServer{Host_ID: id}, stranger); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("update: expected ErrNotOwner, got %v", err)
+	}
+	if err := r.MarkStarted(id, stranger); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("mark started: expected ErrNotOwner, got %v", err)
+	}
+	if err := r.Remove(id, stranger); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("remove: expected ErrNotOwner, got %v", err)
+	}
+
+	if err := r.Remove(id, owner); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.KeepAlive(id, owner); !errors.Is(err, ErrUnknownHost) {
+		t.Fatalf("expected ErrUnknownHost after removal, got %v", err)
+	}
+}
+
+func TestRegistryFind(t *testing.T) {
+	r := NewRegistry(newFakeClock().Now)
+	id, _, _ := r.Add(shared.ReconcilliationData{Name: "alpha", Private: true}, udpAddr("10.0.0.1", 7707))
+	r.Add(shared.ReconcilliationData{Name: "twin"}, udpAddr("10.0.0.2", 7707))
+	r.Add(shared.ReconcilliationData{Name: "twin"}, udpAddr("10.0.0.3", 7707))
+
+	host, _ := r.Get(id)
+	if len(host.Join_code) != JOIN_CODE_LENGTH {
+		t.Fatalf("unexpected join code '%s'", host.Join_code)
+	}
+	// players type codes in, so case and surrounding spaces do not matter
+	found, err := r.FindByJoinCode(" " + strings.ToLower(host.Join_code) + "\n")
+	if err != nil || found.Host_ID != id {
+		t.Fatalf("join code lookup: %+v, %v", found, err)
+	}
+	if _, err := r.FindByJoinCode("0000000"); !errors.Is(err, ErrUnknownHost) {
+		t.Fatalf("expected ErrUnknownHost, got %v", err)
+	}
+
+	found, err = r.FindByName("alpha")
+	if err != nil || found.Host_ID != id {
+		t.Fatalf("private hosts can be found by name: %+v, %v", found, err)
+	}
+	if _, err := r.FindByName("twin"); !errors.Is(err, ErrAmbiguousName) {
+		t.Fatalf("expected ErrAmbiguousName, got %v", err)
+	}
+
+	for _, server := range r.List() {
+		if server.Host_ID == id {
+			t.Fatal("private host is listed")
+		}
+	}
+}
+
+func TestRegistryReclaimNeedsToken(t *testing.T) {
+	clock := newFakeClock()
+	r := NewRegistry(clock.Now)
+	id, _, _ := r.Add(shared.ReconcilliationData{Name: "alpha", Private: true}, udpAddr("10.0.0.1", 7707))
+	host, _ := r.Get(id)
+	token := r.Token(id, host.Join_code)
+
+	clock.Advance(TIMEOUT + time.Second)
+	r.TimeoutStale(TIMEOUT)
+
+	// someone who only knows the shared code
+	impostor := shared.ReconcilliationData{Name: "alpha", Host_ID: id, Join_code: host.Join_code}
+	taken_id, _, err := r.Add(impostor, udpAddr("10.6.6.6", 7707))
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken, _ := r.Get(taken_id)
+	if taken_id == id || taken.Join_code == host.Join_code {
+		t.Fatal("a registration without a token got the id or join code of another server")
+	}
+	impostor.Token = r.Token("someone-else", host.Join_code)
+	forged_id, _, _ := r.Add(impostor, udpAddr("10.6.6.7", 7707))
+	if forged, _ := r.Get(forged_id); forged_id == id || forged.Join_code == host.Join_code {
+		t.Fatal("a token for another id got the join code")
+	}
+
+	// the server itself, from a new address after a restart
+	reclaim := shared.ReconcilliationData{Name: "alpha", Host_ID: id, Join_code: host.Join_code, Token: token}
+	reclaimed_id, fresh, err := r.Add(reclaim, udpAddr("10.0.0.1", 7708))
+	if err != nil || !fresh {
+		t.Fatalf("reclaiming: fresh %v, err %v", fresh, err)
+	}
+	reclaimed, _ := r.Get(reclaimed_id)
+	if reclaimed_id != id || reclaimed.Join_code != host.Join_code {
+		t.Fatalf("the token did not get the id and join code back: %+v", reclaimed)
+	}
+}
+
+func TestRegistryTokenNeedsSameSecret(t *testing.T) {
+	a := NewRegistry(newFakeClock().Now)
+	b := NewRegistry(newFakeClock().Now)
+	id, _, _ := a.Add(shared.ReconcilliationData{Name: "alpha"}, udpAddr("10.0.0.1", 7707))
+	host, _ := a.Get(id)
+
+	reclaim := shared.ReconcilliationData{Name: "alpha", Host_ID: id, Join_code: host.Join_code, Token: a.Token(id, host.Join_code)}
+	other_id, _, _ := b.Add(reclaim, udpAddr("10.0.0.1", 7707))
+	if other_id == id {
+		t.Fatal("a token signed with another secret was accepted")
+	}
+
+	// peers sharing a secret accept each other's tokens
+	b.secret = a.secret
+	reclaim.Name = "alpha-2"
+	shared_id, _, _ := b.Add(reclaim, udpAddr("10.0.0.1", 7708))
+	if shared_id != id {
+		t.Fatal("a token signed with the same secret was refused")
+	}
+}
@@ -0,0 +1,56 @@
+package mediator
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// SaveSnapshot writes every registered host to path.
+// the file is replaced in one go so a crash never leaves half a snapshot
+func SaveSnapshot(path string, registry *Registry) error {
+	data, err := json.MarshalIndent(registry.Snapshot(), "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot restores the hosts saved at path into registry.
+// a missing file is not an error, there is just nothing to restore
+func LoadSnapshot(path string, registry *Registry) (restored int, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	hosts := []Host{}
+	err = json.Unmarshal(data, &hosts)
+	if err != nil {
+		return 0, err
+	}
+
+	registry.Restore(hosts)
+	return len(hosts), nil
+}
@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"encoding/gob"
 	"errors"
+	"fmt"
 	"gotanks/shared"
 	"image/color"
 	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,15 +22,11 @@ import (
 )
 
 const (
-	SERVERPORT  = 7707
-	BUFFER_SIZE = 2048
-
-	MEDIATOR_PORT = 8080
-	MEDIATOR_ADDR = "84.215.22.166"
-
-	// update_interval = fps / desired ticks per second
-	// 3 = 60/20
-	UPDATE_INTERVAL = 3
+	// a mediator whose server list we have not heard from in this long is
+	// considered down, and its servers are dropped from the browser
+	MEDIATOR_TIMEOUT = time.Second * 7
+	// how long a message from the server stays on screen
+	SERVER_MESSAGE_DURATION = time.Second * 6
 )
 
 type Client struct {
@@ -40,32 +40,165 @@ type Client struct {
 	server_state   ServerGameStateEnum
 	wins           map[string]int
 	Auth           *[16]byte
+	Username       *string
 
 	time_last_packet time.Time
 
 	available_servers []shared.AvailableServer
+	server_lists      MediatorServerLists
+	pings             ServerPings
+
+	// the join handshake, see shared.NegotiateData
+	password   string
+	room       int
+	negotiated bool
+	// why the last server we tried to join turned us away
+	rejection string
+	// why the server we were on closed
+	closed_reason string
+
+	// the last message from whoever runs the server, see SERVER_MESSAGE_DURATION
+	server_message      string
+	server_message_time time.Time
+
+	// the answer to NetworkManager.RequestLeaderboard
+	leaderboard      *shared.Leaderboard
+	leaderboard_from string
+
+	log *slog.Logger
+}
+
+// round trip times to servers in the browser, keyed by 'ip:port'
+type ServerPings struct {
+	sync.RWMutex
+	m map[string]time.Duration
+}
+
+func ServerAddrKey(server shared.AvailableServer) string {
+	return net.JoinHostPort(server.Ip, strconv.Itoa(server.Port))
+}
+
+func (p *ServerPings) Get(server shared.AvailableServer) (time.Duration, bool) {
+	p.RLock()
+	defer p.RUnlock()
+	ping, ok := p.m[ServerAddrKey(server)]
+	return ping, ok
+}
+
+func (p *ServerPings) Set(key string, ping time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	p.m[key] = ping
+}
+
+// the server list as told by each mediator, keyed by mediator address
+type MediatorServerLists struct {
+	sync.Mutex
+	// pages of a list received so far, see shared.HostsPage
+	pending   map[string][]shared.AvailableServer
+	lists     map[string][]shared.AvailableServer
+	last_seen map[string]time.Time
+}
+
+// adds a page of the list of mediator.
+// returns the offset of the next page to ask for, or done once the list is complete
+func (l *MediatorServerLists) AddPage(mediator string, page shared.HostsPage) (next_offset int, done bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	pending := l.pending[mediator]
+	if page.Offset == 0 {
+		pending = nil
+	} else if page.Offset != len(pending) {
+		// a page of an older listing, wait for the next one
+		return 0, false
+	}
+	pending = append(pending, page.Servers...)
+
+	if len(page.Servers) > 0 && len(pending) < page.Total {
+		l.pending[mediator] = pending
+		return len(pending), false
+	}
+
+	delete(l.pending, mediator)
+	l.lists[mediator] = pending
+	l.last_seen[mediator] = time.Now()
+	return 0, true
+}
+
+// every server known to a mediator that is still answering.
+// a server registered with several mediators is only listed once
+func (l *MediatorServerLists) Merged(mediators []*net.UDPAddr) []shared.AvailableServer {
+	l.Lock()
+	defer l.Unlock()
+
+	merged := []shared.AvailableServer{}
+	seen := map[string]bool{}
+	for _, mediator := range mediators {
+		key := mediator.String()
+		if time.Since(l.last_seen[key]) > MEDIATOR_TIMEOUT {
+			delete(l.lists, key)
+			continue
+		}
+		for _, server := range l.lists[key] {
+			server_key := fmt.Sprintf("%s/%d", ServerAddrKey(server), server.Room)
+			if seen[server_key] {
+				continue
+			}
+			seen[server_key] = true
+			merged = append(merged, server)
+		}
+	}
+	return merged
 }
 
 type NetworkManager struct {
-	client        *Client
-	mediator_addr *net.UDPAddr
+	client         *Client
+	mediator_addrs []*net.UDPAddr
+	log            *slog.Logger
+}
+
+func (nm *NetworkManager) mediatorAt(addr net.UDPAddr) *net.UDPAddr {
+	for _, mediator := range nm.mediator_addrs {
+		if mediator.IP.Equal(addr.IP) && mediator.Port == addr.Port {
+			return mediator
+		}
+	}
+	return nil
+}
+
+// sends to every mediator, any of them being down is not an error
+func (nm *NetworkManager) sendToMediators(packet_type shared.PacketType, data interface{}) {
+	data_bytes, err := shared.SerializePacket(shared.Packet{PacketType: packet_type}, *nm.client.Auth, data)
+	if err != nil {
+		nm.log.Error("unable to serialize packet", "type", packet_type, shared.LogErr(err))
+		return
+	}
+	for _, mediator := range nm.mediator_addrs {
+		nm.client.conn.WriteToUDP(data_bytes, mediator)
+	}
 }
 
 func (c *Client) isConnected() bool {
 	return c.is_connected
 }
 
-func InitNetworkManager(mediator_addr string) *NetworkManager {
+func InitNetworkManager(mediator_addrs []*net.UDPAddr) *NetworkManager {
 	nm := NetworkManager{}
 	conn, err := net.ListenUDP("udp", nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	nm.mediator_addr = &net.UDPAddr{IP: net.ParseIP(mediator_addr), Port: MEDIATOR_PORT}
-	nm.client = &Client{}
+	nm.mediator_addrs = mediator_addrs
+	nm.log = slog.Default()
+	nm.client = &Client{log: nm.log}
 	nm.client.packet_channel = make(chan shared.PacketData)
 	nm.client.wins = make(map[string]int)
+	nm.client.pings.m = make(map[string]time.Duration)
+	nm.client.server_lists.pending = make(map[string][]shared.AvailableServer)
+	nm.client.server_lists.lists = make(map[string][]shared.AvailableServer)
+	nm.client.server_lists.last_seen = make(map[string]time.Time)
 	nm.client.conn = conn
 
 	sigs := make(chan os.Signal, 1)
@@ -84,23 +217,53 @@ func InitNetworkManager(mediator_addr string) *NetworkManager {
 				time.Sleep(time.Second * 2)
 				t := time.Now().Add(-time.Second * 7)
 				if nm.client.time_last_packet.Before(t) {
-					log.Println("no response for 5s, considering connection closed")
+					nm.client.sessionLog().Warn("no response, considering connection closed", "last_packet", nm.client.time_last_packet)
 					nm.client.Disconnect()
 				}
 			} else {
 				time.Sleep(time.Second * 2)
-				data_bytes, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeAvailableHosts}, *nm.client.Auth, []byte{})
-				if err != nil {
-					log.Println("unable to serialize packet, but we don't break for that reason")
-					continue
+				for _, mediator := range nm.mediator_addrs {
+					nm.RequestServers(mediator, 0)
 				}
-				nm.client.conn.WriteToUDP(data_bytes, nm.mediator_addr)
+				nm.PingServers()
 			}
 		}
 	}()
 	return &nm
 }
 
+// asks mediator for its server list starting at offset.
+// the reply only holds as many servers as fit, the rest are requested as
+// the pages arrive in Client.HandlePacket
+func (nm *NetworkManager) RequestServers(mediator *net.UDPAddr, offset int) {
+	query := shared.HostsQuery{Offset: offset, Padding: make([]byte, shared.HOSTS_QUERY_PADDING)}
+	data_bytes, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeAvailableHosts}, *nm.client.Auth, query)
+	if err != nil {
+		nm.log.Error("unable to serialize server list query", shared.LogErr(err))
+		return
+	}
+	nm.client.conn.WriteToUDP(data_bytes, mediator)
+}
+
+// probes every server in the browser directly, the replies are
+// handled in Client.HandlePacket
+func (nm *NetworkManager) PingServers() {
+	for _, server := range nm.client.available_servers {
+		data := shared.PingData{Sent_at: time.Now().UnixNano()}
+		data_bytes, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypePing}, *nm.client.Auth, data)
+		if err != nil {
+			nm.log.Error("unable to serialize ping", shared.LogErr(err))
+			return
+		}
+		nm.client.conn.WriteToUDP(data_bytes, &net.UDPAddr{IP: net.ParseIP(server.Ip), Port: server.Port})
+	}
+}
+
+// whether addr is the server we are on
+func (c *Client) fromTarget(addr net.UDPAddr) bool {
+	return c.target != nil && addr.IP.Equal(c.target.IP) && addr.Port == c.target.Port
+}
+
 func (c *Client) isSelf(id string) bool {
 	return shared.AuthToString(*c.Auth) == id
 }
@@ -109,6 +272,10 @@ func (c *Client) Send(packet_type shared.PacketType, data interface{}) error {
 	if !c.isConnected() {
 		return errors.New("tried to send without being connected")
 	}
+	// the server drops everything else until it has let us in
+	if !c.negotiated && packet_type != shared.PacketTypeNegotiate {
+		return errors.New("tried to send before the server let us in")
+	}
 	packet := shared.Packet{}
 	packet.PacketType = packet_type
 	data_bytes, err := shared.SerializePacket(packet, *c.Auth, data)
@@ -131,7 +298,8 @@ func (c *Client) Listen() {
 
 		packet, data, err := shared.DeserializePacket(buf[:n])
 		if err != nil {
-			log.Panic("error reading from connection:", err)
+			c.log.Debug("dropped unreadable packet", shared.LogAddr("addr", addr), shared.LogErr(err))
+			continue
 		}
 
 		packet_data := shared.PacketData{Packet: packet, Data: data, Addr: *addr}
@@ -139,16 +307,55 @@ func (c *Client) Listen() {
 	}
 }
 
-func (nm *NetworkManager) Connect(server shared.AvailableServer) {
+func (nm *NetworkManager) Connect(server shared.AvailableServer, password string) {
 	if nm.client.isConnected() {
 		log.Panic("tried to connect while already connected")
 	}
 	nm.client.target = &net.UDPAddr{IP: net.ParseIP(server.Ip), Port: server.Port}
-
-	data := shared.ReconcilliationData{Name: server.Name}
-	data_bytes, _ := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeMatchConnect}, *nm.client.Auth, data)
-	nm.client.conn.WriteToUDP(data_bytes, nm.mediator_addr)
+	nm.client.password = password
+	nm.client.room = server.Room
+	nm.client.negotiated = false
+	nm.client.rejection = ""
+
+	// servers we know the address of without the mediator, e.g. one we are
+	// hosting ourselves, have no id and are connected to directly
+	if server.Host_ID != "" {
+		// mediators the server did not register with directly know it from
+		// gossip at best, and can only find it by join code or name
+		data := shared.ReconcilliationData{
+			Name:      server.Name,
+			Host_ID:   server.Host_ID,
+			Join_code: server.Join_code,
+			Padding:   make([]byte, shared.QUERY_PADDING),
+		}
+		nm.sendToMediators(shared.PacketTypeMatchConnect, data)
+	}
 	nm.client.is_connected = true
+	nm.client.sessionLog().Info("connecting", "server", server.Name, "host_id", server.Host_ID)
+}
+
+// asks the mediators where a server is, by name or join code, used for
+// servers which are not in the server list.
+// the first answer arrives as an EventServerResolved
+func (nm *NetworkManager) Resolve(data shared.ReconcilliationData) {
+	data.Padding = make([]byte, shared.QUERY_PADDING)
+	nm.sendToMediators(shared.PacketTypeMatchConnect, data)
+}
+
+// opens the join handshake, repeated until the server answers
+func (c *Client) Negotiate() {
+	if c.negotiated {
+		return
+	}
+	c.Send(shared.PacketTypeNegotiate, shared.NegotiateData{Room: c.room, Username: c.username()})
+}
+
+// the name we go by, one made from our auth until we pick one
+func (c *Client) username() string {
+	if c.Username == nil || *c.Username == "" {
+		return shared.DefaultUsername(*c.Auth)
+	}
+	return *c.Username
 }
 
 func (c *Client) Disconnect() {
@@ -158,6 +365,7 @@ func (c *Client) Disconnect() {
 	c.Send(shared.PacketTypeDisconnect, "disconnect")
 	c.is_connected = false
 	c.target = nil
+	c.Notify(Event{Name: EventDisconnected})
 }
 
 func (c *Client) Loop(game *Game) {
@@ -165,7 +373,8 @@ func (c *Client) Loop(game *Game) {
 		select {
 		case packet_data := <-c.packet_channel:
 			c.HandlePacket(packet_data, game)
-			if packet_data.Packet.PacketType != shared.PacketTypeAvailableHosts {
+			if packet_data.Packet.PacketType != shared.PacketTypeAvailableHosts &&
+				packet_data.Packet.PacketType != shared.PacketTypePing {
 				c.time_last_packet = time.Now()
 			}
 		}
@@ -190,7 +399,7 @@ func (nm *NetworkManager) GetDrawData(g *Game) {
 	}
 
 	for i, player := range g.context.player_updates {
-		if nm.client.isSelf(player.ID) {
+		if nm.client.isSelf(player.ID) || NetBoolify(player.Spectating) {
 			continue
 		}
 
@@ -205,7 +414,7 @@ func (nm *NetworkManager) GetDrawData(g *Game) {
 			g.context.draw_data = append(g.context.draw_data,
 				DrawData{
 					path:      g.tank.sprites_path,
-					position:  Position{x, y},
+					position:  Position{X: x, Y: y},
 					rotation:  t.Rotation - g.camera.rotation,
 					intensity: 1,
 					opacity:   1},
@@ -213,10 +422,10 @@ func (nm *NetworkManager) GetDrawData(g *Game) {
 			g.context.draw_data = append(g.context.draw_data,
 				DrawData{
 					path:      g.tank.turret.sprites_path,
-					position:  Position{x, y + 1},
+					position:  Position{X: x, Y: y + 1},
 					rotation:  t.Turret_rotation,
 					intensity: 1,
-					offset:    Position{0, -TURRET_HEIGHT},
+					offset:    Position{X: 0, Y: -TURRET_HEIGHT},
 					opacity:   1},
 			)
 			if int(g.time*100)%TRACK_INTERVAL == 0 {
@@ -229,7 +438,7 @@ func (nm *NetworkManager) GetDrawData(g *Game) {
 			dead_sprites := g.tank.dead_sprites_path
 			g.context.draw_data = append(g.context.draw_data, DrawData{
 				path:      dead_sprites,
-				position:  Position{x, y},
+				position:  Position{X: x, Y: y},
 				rotation:  t.Rotation - g.camera.rotation,
 				intensity: 1,
 				opacity:   1},
@@ -237,15 +446,15 @@ func (nm *NetworkManager) GetDrawData(g *Game) {
 			vector.DrawFilledCircle(radi_sprite, float32(radius)/2, float32(radius)/2, float32(radius)/4, color.RGBA{R: 0, G: 0, B: 0, A: 128}, true)
 
 			// not sure how i feel about this living in a draw call
-			t.TryAddSmoke(g)
+			TryAddSmoke(g, t)
 
 		}
 		g.context.draw_data = append(g.context.draw_data, DrawData{
 			sprite:    radi_sprite,
-			position:  Position{x, y - 1},
+			position:  Position{X: x, Y: y - 1},
 			rotation:  t.Rotation,
 			intensity: 1,
-			offset:    Position{0, 1},
+			offset:    Position{X: 0, Y: 1},
 			opacity:   1})
 	}
 }
@@ -255,6 +464,23 @@ func (c *Client) IncrementWin(winner string) {
 	}
 }
 
+// for lines about us and the server we are on
+func (c *Client) sessionLog() *slog.Logger {
+	logger := c.log
+	if c.Auth != nil {
+		logger = logger.With(shared.LOG_PLAYER, shared.AuthToString(*c.Auth), shared.LOG_NAME, c.username())
+	}
+	if c.target != nil {
+		logger = logger.With(shared.LOG_SESSION, c.target.String(), shared.LOG_ROOM, c.room)
+	}
+	return logger
+}
+
+// logs a packet whose data could not be read, it is dropped
+func (c *Client) dropUndecodable(packet_data shared.PacketData, err error) {
+	c.sessionLog().Warn("error decoding packet", "type", packet_data.Packet.PacketType, shared.LogAddr("addr", &packet_data.Addr), shared.LogErr(err))
+}
+
 func (c *Client) HandlePacket(packet_data shared.PacketData, game *Game) {
 	dec := gob.NewDecoder(bytes.NewReader(packet_data.Data))
 	switch packet_data.Packet.PacketType {
@@ -262,33 +488,37 @@ func (c *Client) HandlePacket(packet_data shared.PacketData, game *Game) {
 		bullet := StandardBullet{}
 		err := dec.Decode(&bullet)
 		if err != nil {
-			log.Panic("error decoding bullet", err)
+			c.dropUndecodable(packet_data, err)
+			return
 		}
 
 		c.Notify(Event{Name: EventBulletFired, Data: bullet})
 	case shared.PacketTypeUpdatePlayers:
 		err := dec.Decode(&game.context.player_updates)
 		if err != nil {
-			log.Panic("error decoding player updates", err)
+			c.dropUndecodable(packet_data, err)
+			return
 		}
 	case shared.PacketTypePlayerHit:
 		hit := BulletHit{}
 		err := dec.Decode(&hit)
 		if err != nil {
-			log.Panic("error decoding bullet", err)
+			c.dropUndecodable(packet_data, err)
+			return
 		}
 		if c.isSelf(hit.Player) {
 			game.tank.Hit(hit)
 		}
+		game.AddKill(hit)
 
-		bullet := game.bm.bullets[hit.Bullet_ID]
+		bullet, _ := game.bm.Remove(hit.Bullet_ID)
 		c.Notify(Event{Name: EventPlayerHit, Data: bullet})
-		delete(game.bm.bullets, hit.Bullet_ID)
 	case shared.PacketTypeNewRound:
 		event := NewRoundEvent{Spawns: map[string]Position{}}
 		err := dec.Decode(&event)
 		if err != nil {
-			log.Panic("error decoding new round event", err)
+			c.dropUndecodable(packet_data, err)
+			return
 		}
 
 		c.IncrementWin(event.Winner)
@@ -297,7 +527,8 @@ func (c *Client) HandlePacket(packet_data shared.PacketData, game *Game) {
 		event := NewMatchEvent{}
 		err := dec.Decode(&event)
 		if err != nil {
-			log.Panic("error decoding spawn map", err)
+			c.dropUndecodable(packet_data, err)
+			return
 		}
 		go func() {
 			time.Sleep(event.Timestamp.Sub(time.Now()))
@@ -306,26 +537,165 @@ func (c *Client) HandlePacket(packet_data shared.PacketData, game *Game) {
 			}
 			c.Notify(Event{Name: EventNewMatch})
 		}()
+	case shared.PacketTypeSpectate:
+		event := SpectateEvent{}
+		err := dec.Decode(&event)
+		if err != nil {
+			c.dropUndecodable(packet_data, err)
+			return
+		}
+		c.server_state = event.State
+		c.Notify(Event{Name: EventSpectate, Data: event})
 	case shared.PacketTypeServerStateChanged:
 		err := dec.Decode(&c.server_state)
 		if err != nil {
-			log.Panic("error decoding new server state")
+			c.dropUndecodable(packet_data, err)
+			return
 		}
 	case shared.PacketTypeBackToLobby:
 		c.Notify(Event{Name: EventBackToLobby})
 	case shared.PacketTypeGameOver:
-		event := NewRoundEvent{Spawns: map[string]Position{}}
+		event := GameOverEvent{}
 		err := dec.Decode(&event)
 		if err != nil {
-			log.Panic("error decoding game over event", err)
+			c.dropUndecodable(packet_data, err)
+			return
 		}
 
 		c.IncrementWin(event.Winner)
 		c.Notify(Event{Name: EventGameOver, Data: event})
 	case shared.PacketTypeAvailableHosts:
-		err := dec.Decode(&c.available_servers)
+		mediator := game.nm.mediatorAt(packet_data.Addr)
+		if mediator == nil {
+			return
+		}
+		page := shared.HostsPage{}
+		err := dec.Decode(&page)
+		if err != nil {
+			c.dropUndecodable(packet_data, err)
+			return
+		}
+
+		next_offset, done := c.server_lists.AddPage(mediator.String(), page)
+		if !done {
+			if next_offset > 0 {
+				game.nm.RequestServers(mediator, next_offset)
+			}
+			return
+		}
+		c.available_servers = c.server_lists.Merged(game.nm.mediator_addrs)
+	case shared.PacketTypeMatchConnect:
+		// the server sends an empty one of these to open up the connection,
+		// only the mediator's contains anything
+		if game.nm.mediatorAt(packet_data.Addr) == nil {
+			return
+		}
+		server := shared.AvailableServer{}
+		err := dec.Decode(&server)
+		if err != nil {
+			c.dropUndecodable(packet_data, err)
+			return
+		}
+		c.Notify(Event{Name: EventServerResolved, Data: server})
+	case shared.PacketTypeNegotiate:
+		negotiation := shared.NegotiateData{}
+		err := dec.Decode(&negotiation)
+		if err != nil {
+			c.dropUndecodable(packet_data, err)
+			return
+		}
+		if !c.fromTarget(packet_data.Addr) {
+			return
+		}
+		if negotiation.Accepted {
+			c.negotiated = true
+			if negotiation.Join_code != "" && game.context.current_server != nil {
+				game.context.current_server.Join_code = negotiation.Join_code
+			}
+		} else if len(negotiation.Challenge) > 0 {
+			proof := shared.PasswordProof(c.password, negotiation.Challenge, *c.Auth)
+			c.Send(shared.PacketTypeNegotiate, shared.NegotiateData{Proof: proof, Room: c.room, Username: c.username()})
+		}
+	case shared.PacketTypeConnectionRejected:
+		if !c.fromTarget(packet_data.Addr) {
+			return
+		}
+		rejection := shared.RejectionData{}
+		err := dec.Decode(&rejection)
+		if err != nil {
+			c.dropUndecodable(packet_data, err)
+			return
+		}
+		c.sessionLog().Warn("server rejected us", "reason", rejection.Reason)
+		if c.isConnected() {
+			c.Disconnect()
+		}
+		c.rejection = rejection.Reason
+	case shared.PacketTypeServerClosing:
+		if !c.fromTarget(packet_data.Addr) {
+			return
+		}
+		closing := shared.ServerClosingData{}
+		err := dec.Decode(&closing)
+		if err != nil {
+			c.dropUndecodable(packet_data, err)
+			return
+		}
+		c.sessionLog().Info("server closed", "reason", closing.Reason)
+		c.is_connected = false
+		c.target = nil
+		c.closed_reason = closing.Reason
+		c.Notify(Event{Name: EventServerClosed, Data: closing})
+	case shared.PacketTypePing:
+		ping := shared.PingData{}
+		err := dec.Decode(&ping)
+		if err != nil {
+			c.dropUndecodable(packet_data, err)
+			return
+		}
+		if ping.From_server {
+			// the server measuring our ping
+			if c.fromTarget(packet_data.Addr) {
+				c.Send(shared.PacketTypePing, ping)
+			}
+			return
+		}
+		c.pings.Set(packet_data.Addr.String(), time.Since(time.Unix(0, ping.Sent_at)))
+	case shared.PacketTypeKicked:
+		if !c.fromTarget(packet_data.Addr) {
+			return
+		}
+		rejection := shared.RejectionData{}
+		err := dec.Decode(&rejection)
+		if err != nil {
+			c.dropUndecodable(packet_data, err)
+			return
+		}
+		c.sessionLog().Warn("server removed us", "reason", rejection.Reason)
+		c.is_connected = false
+		c.target = nil
+		c.rejection = rejection.Reason
+		c.Notify(Event{Name: EventServerClosed, Data: shared.ServerClosingData{Reason: rejection.Reason}})
+	case shared.PacketTypeServerMessage:
+		if !c.fromTarget(packet_data.Addr) {
+			return
+		}
+		message := shared.ServerMessageData{}
+		err := dec.Decode(&message)
+		if err != nil {
+			c.dropUndecodable(packet_data, err)
+			return
+		}
+		c.sessionLog().Info("server message", "message", message.Message)
+		c.server_message = message.Message
+		c.server_message_time = time.Now()
+	case shared.PacketTypeLeaderboard:
+		board := shared.Leaderboard{}
+		err := dec.Decode(&board)
 		if err != nil {
-			log.Panic("error decoding new server state")
+			c.dropUndecodable(packet_data, err)
+			return
 		}
+		c.acceptLeaderboard(packet_data.Addr, board)
 	}
 }
@@ -18,6 +18,14 @@ const (
 	EventGameOver    EventType = "GameOver"
 	EventNewMatch    EventType = "NewMatch"
 	EventNewRound    EventType = "NewRound"
+	// the mediator told us where a server we asked for by name is
+	EventServerResolved EventType = "ServerResolved"
+	// we joined a running match and watch until the next round
+	EventSpectate EventType = "Spectate"
+	// the server we were on shut down
+	EventServerClosed EventType = "ServerClosed"
+	// we left the server or stopped hearing from it
+	EventDisconnected EventType = "Disconnected"
 )
 
 type Observer interface {
@@ -121,7 +121,7 @@ func (p *Particle) GetDrawData(camera Camera) DrawData {
 
 		return DrawData{
 			sprite:    PARTICLE_SPRITE_BUFFER.SubImage(image.Rect(0, 0, int(f32_radius+f32_margin)*2, int(f32_radius+f32_margin)*2)).(*ebiten.Image),
-			position:  Position{x, y - p.Offset_z},
+			position:  Position{X: x, Y: y - p.Offset_z},
 			rotation:  90 * math.Pi / 180,
 			intensity: float32(p.intensity),
 			offset:    p.offset,
@@ -133,7 +133,7 @@ func (p *Particle) GetDrawData(camera Camera) DrawData {
 	default:
 		return DrawData{
 			path:      p.sprite_path,
-			position:  Position{x, y - p.Offset_z},
+			position:  Position{X: x, Y: y - p.Offset_z},
 			rotation:  p.Rotation - camera.rotation,
 			intensity: float32(p.intensity),
 			offset:    p.offset,
@@ -167,19 +167,19 @@ func (p *Particle) GetDrawShadowData(camera Camera) DrawData {
 		f32_margin := float32(margin)
 		return DrawData{
 			sprite:    PARTICLE_SPRITE_BUFFER.SubImage(image.Rect(0, 0, int(f32_radius+f32_margin)*2, int(f32_radius+f32_margin)*2)).(*ebiten.Image),
-			position:  Position{x, y - 20},
+			position:  Position{X: x, Y: y - 20},
 			rotation:  90 * math.Pi / 180,
 			intensity: 0.2,
-			offset:    Position{0, 20},
+			offset:    Position{X: 0, Y: 20},
 			opacity:   0.25,
 		}
 	default:
 		return DrawData{
 			path:      p.sprite_path,
-			position:  Position{x, y - 20},
+			position:  Position{X: x, Y: y - 20},
 			rotation:  p.Rotation - camera.rotation,
 			intensity: 0.2,
-			offset:    Position{0, 20},
+			offset:    Position{X: 0, Y: 20},
 			opacity:   0.25,
 		}
 	}
@@ -201,14 +201,14 @@ func (p *Particle) Update(game *Game) {
 		x, y := math.Sin(p.Rotation)*p.velocity, math.Cos(p.Rotation)*p.velocity
 
 		p.Position.Y += y
-		collided_object := level.CheckObjectCollisionWithDimensions(p.Position, Position{4, 4})
+		collided_object := level.CheckObjectCollisionWithDimensions(p.Position, Position{X: 4, Y: 4})
 		if collided_object != nil {
 			p.Rotation = math.Pi - p.Rotation
 			p.Position.Y -= y
 		}
 
 		p.Position.X += x
-		collided_object = level.CheckObjectCollisionWithDimensions(p.Position, Position{4, 4})
+		collided_object = level.CheckObjectCollisionWithDimensions(p.Position, Position{X: 4, Y: 4})
 		if collided_object != nil {
 			p.Rotation = -p.Rotation
 			p.Position.X -= x
@@ -318,7 +318,7 @@ func (pm *ParticleManager) OnEvent(event Event) {
 				Rotation:      bullet.Rotation,
 				Position:      bullet.Position,
 				velocity:      2,
-				offset:        Position{0, -TURRET_HEIGHT * 2},
+				offset:        Position{X: 0, Y: -TURRET_HEIGHT * 2},
 				max_t:         25,
 			})
 	case EventPlayerHit:
@@ -2,7 +2,9 @@ package game
 
 import (
 	"encoding/gob"
+	"gotanks/shared"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 )
@@ -20,6 +22,10 @@ type SaveManager struct {
 
 type SaveData struct {
 	Player_ID [16]byte
+	// empty until the player picks one, see Client.username
+	Username string
+	// whose leaderboard the main menu shows
+	Last_server shared.AvailableServer
 }
 
 func InitSaveManager() *SaveManager {
@@ -72,7 +78,7 @@ func saveGameData(file_path string, data SaveData) error {
 	defer file.Close()
 
 	encoder := gob.NewEncoder(file)
-	log.Println("saved to file: ", file_path)
+	slog.Debug("saved game", "path", file_path)
 
 	err = encoder.Encode(data)
 	if err != nil {
@@ -87,7 +93,7 @@ func loadGameData(filePath string) (SaveData, error) {
 
 	info, err := os.Stat(filePath)
 	if os.IsNotExist(err) || info.Size() == 0 {
-		log.Println("Save file does not exist or is empty; returning default data.")
+		slog.Info("save file does not exist or is empty, starting fresh", "path", filePath)
 		return data, nil
 	}
 
@@ -0,0 +1,53 @@
+package game
+
+import (
+	"fmt"
+	"gotanks/shared"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+var SCOREBOARD_BACKGROUND = color.RGBA{R: 11, G: 11, B: 11, A: 200}
+
+// how everyone did in the match that just ended, best first
+func (g *Game) DrawScoreboard(screen *ebiten.Image) {
+	board := g.context.scoreboard
+	if len(board) == 0 {
+		return
+	}
+
+	fontSize := 8.
+	line_height := fontSize + 4
+	font_face := &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}
+
+	header := fmt.Sprintf("%-*s| %-4s| %-3s| %-3s| %-6s| %-5s| %s", shared.USERNAME_MAX_LENGTH, "name", "won", "k", "d", "shots", "acc", "bounces")
+	width := float64(len(header)+2) * fontSize
+	height := float64(len(board)+3) * line_height
+	left := RENDER_WIDTH/2 - width/2
+	top := RENDER_HEIGHT/2 - height/2
+	vector.DrawFilledRect(screen, float32(left), float32(top), float32(width), float32(height), SCOREBOARD_BACKGROUND, true)
+
+	textOp := text.DrawOptions{}
+	msg := fmt.Sprintf("%s wins the match", board[0].Name)
+	textOp.GeoM.Translate(RENDER_WIDTH/2-float64(len(msg)/2)*fontSize, top+line_height/2)
+	text.Draw(screen, msg, font_face, &textOp)
+
+	textOp = text.DrawOptions{}
+	textOp.GeoM.Translate(left+fontSize, top+line_height*2)
+	text.Draw(screen, header, font_face, &textOp)
+
+	for i, player := range board {
+		textOp := text.DrawOptions{}
+		if g.nm.client.isSelf(player.Player_ID) {
+			textOp.ColorScale.ScaleWithColor(PLAYER_COLOR)
+		}
+		msg := fmt.Sprintf("%-*s| %-4d| %-3d| %-3d| %-6d| %-5s| %d", shared.USERNAME_MAX_LENGTH, player.Name,
+			player.Rounds_won, player.Kills, player.Deaths, player.Shots,
+			fmt.Sprintf("%d%%", int(player.Accuracy()*100)), player.Bounces)
+		textOp.GeoM.Translate(left+fontSize, top+line_height*float64(i+3))
+		text.Draw(screen, msg, font_face, &textOp)
+	}
+}
@@ -2,65 +2,381 @@ package game
 
 import (
 	"fmt"
+	"gotanks/shared"
+	"image/color"
+	"net"
+	"sort"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
 )
 
+type ServerSortEnum int
+
+const (
+	ServerSortName ServerSortEnum = iota
+	ServerSortPlayers
+	ServerSortPing
+	ServerSortEnd
+)
+
+type ServerBrowserPromptEnum int
+
+const (
+	ServerBrowserPromptNone ServerBrowserPromptEnum = iota
+	ServerBrowserPromptName
+	ServerBrowserPromptCode
+	ServerBrowserPromptPassword
+	// waiting for the mediator to tell us where a server is
+	ServerBrowserPromptResolving
+)
+
+const (
+	// rows of servers that fit between the header and the footer
+	SERVER_BROWSER_PAGE_SIZE = 36
+
+	// frames to wait for the mediator before giving up on a join by name
+	SERVER_RESOLVE_TIMEOUT = 180
+)
+
+type ServerBrowser struct {
+	sort             ServerSortEnum
+	hide_full        bool
+	hide_in_progress bool
+	lan_only         bool
+
+	// index of the first visible server
+	scroll int
+
+	prompt ServerBrowserPromptEnum
+	input  TextInput
+	// the server being joined through a prompt
+	join_target   shared.AvailableServer
+	resolve_start int
+	resolved      *shared.AvailableServer
+	// feedback shown at the top, e.g. why a join failed
+	message string
+}
+
+func DetermineServerSortName(sort ServerSortEnum) string {
+	switch sort {
+	case ServerSortPlayers:
+		return "players"
+	case ServerSortPing:
+		return "ping"
+	default:
+		return "name"
+	}
+}
+
+func IsLanServer(server shared.AvailableServer) bool {
+	ip := net.ParseIP(server.Ip)
+	return ip != nil && (ip.IsPrivate() || ip.IsLoopback())
+}
+
+// filters and sorts the servers according to the browser settings
+func (b *ServerBrowser) Apply(servers []shared.AvailableServer, pings *ServerPings) []shared.AvailableServer {
+	filtered := []shared.AvailableServer{}
+	for _, server := range servers {
+		if b.hide_full && server.Max_players > 0 && server.Player_count >= server.Max_players {
+			continue
+		}
+		if b.hide_in_progress && server.InProgress() {
+			continue
+		}
+		if b.lan_only && !IsLanServer(server) {
+			continue
+		}
+		filtered = append(filtered, server)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		switch b.sort {
+		case ServerSortPlayers:
+			// fullest first, it's where the games are
+			return filtered[i].Player_count > filtered[j].Player_count
+		case ServerSortPing:
+			i_ping, i_ok := pings.Get(filtered[i])
+			j_ping, j_ok := pings.Get(filtered[j])
+			// servers that have not answered go last
+			if i_ok != j_ok {
+				return i_ok
+			}
+			return i_ping < j_ping
+		default:
+			return filtered[i].Name < filtered[j].Name
+		}
+	})
+
+	return filtered
+}
+
+// makes sure the server at selection is on the visible page
+func (b *ServerBrowser) ScrollTo(selection int) {
+	if selection < b.scroll {
+		b.scroll = selection
+	}
+	if selection >= b.scroll+SERVER_BROWSER_PAGE_SIZE {
+		b.scroll = selection - SERVER_BROWSER_PAGE_SIZE + 1
+	}
+	b.scroll = max(b.scroll, 0)
+}
+
+func (g *Game) JoinServer(server shared.AvailableServer, password string) {
+	g.nm.Connect(server, password)
+	g.context.current_server = &server
+	g.context.current_state = GameStateLobby
+	g.context.browser.message = ""
+	g.rememberServer(server)
+}
+
+func (b *ServerBrowser) OpenPrompt(prompt ServerBrowserPromptEnum) {
+	b.prompt = prompt
+	b.input.Reset()
+	b.input.masked = prompt == ServerBrowserPromptPassword
+	b.input.max_length = 32
+	if prompt == ServerBrowserPromptCode {
+		b.input.max_length = 6
+	}
+}
+
+func (g *Game) ResolveServer(request shared.ReconcilliationData) {
+	browser := &g.context.browser
+	browser.prompt = ServerBrowserPromptResolving
+	browser.resolve_start = g.context.background_time
+	browser.resolved = nil
+	g.nm.Resolve(request)
+}
+
+func (g *Game) UpdateServerBrowserPrompt() {
+	browser := &g.context.browser
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		browser.prompt = ServerBrowserPromptNone
+		return
+	}
+
+	switch browser.prompt {
+	case ServerBrowserPromptName:
+		if browser.input.Update() && browser.input.String() != "" {
+			g.ResolveServer(shared.ReconcilliationData{Name: browser.input.String()})
+		}
+	case ServerBrowserPromptCode:
+		if browser.input.Update() && browser.input.String() != "" {
+			g.ResolveServer(shared.ReconcilliationData{Join_code: shared.NormalizeJoinCode(browser.input.String())})
+		}
+	case ServerBrowserPromptResolving:
+		if browser.resolved != nil {
+			browser.join_target = *browser.resolved
+			browser.resolved = nil
+			if browser.join_target.Password_protected {
+				browser.OpenPrompt(ServerBrowserPromptPassword)
+			} else {
+				browser.prompt = ServerBrowserPromptNone
+				g.JoinServer(browser.join_target, "")
+			}
+		} else if g.context.background_time-browser.resolve_start > SERVER_RESOLVE_TIMEOUT {
+			browser.prompt = ServerBrowserPromptNone
+			browser.message = "could not find that server"
+		}
+	case ServerBrowserPromptPassword:
+		if browser.input.Update() {
+			browser.prompt = ServerBrowserPromptNone
+			g.JoinServer(browser.join_target, browser.input.String())
+		}
+	}
+}
+
 func (g *Game) UpdateServerPicking() error {
 	g.context.background_time++
 
-	g.context.available_servers = g.nm.client.GetServerList(g)
+	browser := &g.context.browser
+	if g.nm.client.rejection != "" {
+		browser.message = fmt.Sprintf("rejected: %s", g.nm.client.rejection)
+		g.nm.client.rejection = ""
+	}
+	if g.nm.client.closed_reason != "" {
+		browser.message = fmt.Sprintf("server closed: %s", g.nm.client.closed_reason)
+		g.nm.client.closed_reason = ""
+	}
+
+	if browser.prompt != ServerBrowserPromptNone {
+		g.UpdateServerBrowserPrompt()
+		return nil
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyJ) {
+		browser.OpenPrompt(ServerBrowserPromptName)
+		return nil
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyC) {
+		browser.OpenPrompt(ServerBrowserPromptCode)
+		return nil
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		browser.sort = (browser.sort + 1) % ServerSortEnd
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF) {
+		browser.hide_full = !browser.hide_full
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		browser.hide_in_progress = !browser.hide_in_progress
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyL) {
+		browser.lan_only = !browser.lan_only
+	}
+
+	g.context.available_servers = browser.Apply(g.nm.client.GetServerList(g), &g.nm.client.pings)
+	server_count := len(g.context.available_servers)
 
 	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
 		g.context.current_selection++
-		if g.context.current_selection >= len(g.context.available_servers)+1 {
+		if g.context.current_selection >= server_count+1 {
 			g.context.current_selection = 0
 		}
 	}
 	if inpututil.IsKeyJustPressed(ebiten.KeyW) {
 		g.context.current_selection--
 		if g.context.current_selection < 0 {
-			g.context.current_selection = len(g.context.available_servers)
+			g.context.current_selection = server_count
 		}
 	}
+	// paging, stays within the list and never wraps to 'back to menu'
+	if inpututil.IsKeyJustPressed(ebiten.KeyD) && server_count > 0 {
+		g.context.current_selection = min(max(g.context.current_selection, 1)+SERVER_BROWSER_PAGE_SIZE, server_count)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyA) && server_count > 0 {
+		g.context.current_selection = max(g.context.current_selection-SERVER_BROWSER_PAGE_SIZE, 1)
+	}
+	// the list can shrink under us when filtering or refreshing
+	g.context.current_selection = min(g.context.current_selection, server_count)
+
+	if g.context.current_selection > 0 {
+		browser.ScrollTo(g.context.current_selection - 1)
+	}
 
 	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
 		if g.context.current_selection == 0 {
 			g.context.current_state = GameStateMainMenu
 			g.context.current_server = nil
-		} else if g.context.current_selection < len(g.context.available_servers)+1 {
+		} else if g.context.current_selection < server_count+1 {
 			server := g.context.available_servers[g.context.current_selection-1]
-			g.nm.Connect(server)
-			g.context.current_server = &server
-			g.context.current_state = GameStateLobby
+			if server.Password_protected {
+				browser.join_target = server
+				browser.OpenPrompt(ServerBrowserPromptPassword)
+			} else {
+				g.JoinServer(server, "")
+			}
 		}
 	}
 	return nil
 }
 
+func FormatServerPing(pings *ServerPings, server shared.AvailableServer) string {
+	ping, ok := pings.Get(server)
+	if !ok {
+		return "--"
+	}
+	return fmt.Sprintf("%dms", ping.Milliseconds())
+}
+
+func FormatServerBrowserFilters(browser ServerBrowser) string {
+	filters := []string{}
+	if browser.hide_full {
+		filters = append(filters, "no full")
+	}
+	if browser.hide_in_progress {
+		filters = append(filters, "no running")
+	}
+	if browser.lan_only {
+		filters = append(filters, "lan")
+	}
+	if len(filters) == 0 {
+		return "none"
+	}
+	return strings.Join(filters, ", ")
+}
+
 func (g *Game) DrawServerPicking(screen *ebiten.Image) {
 	g.DrawStripes(screen)
-	for i, server := range g.context.available_servers {
+
+	fontSize := 8.
+	font_face := &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}
+	browser := g.context.browser
+	left := RENDER_WIDTH/2 - 25*fontSize
+
+	textOp := text.DrawOptions{}
+	msg := fmt.Sprintf("sort: %s | filters: %s", DetermineServerSortName(browser.sort), FormatServerBrowserFilters(browser))
+	if browser.message != "" {
+		msg = browser.message
+	}
+	textOp.GeoM.Translate(1, 1)
+	text.Draw(screen, msg, font_face, &textOp)
+
+	textOp = text.DrawOptions{}
+	msg = fmt.Sprintf("  %-16s| %-7s| %s", "name", "players", "ping")
+	textOp.GeoM.Translate(left, fontSize*2)
+	text.Draw(screen, msg, font_face, &textOp)
+
+	end := min(browser.scroll+SERVER_BROWSER_PAGE_SIZE, len(g.context.available_servers))
+	for i := browser.scroll; i < end; i++ {
+		server := g.context.available_servers[i]
 		textOp := text.DrawOptions{}
-		msg := fmt.Sprintf("  %-10s| %d/%d", server.Name, server.Player_count, server.Max_players)
+		prefix := " "
 		if i+1 == g.context.current_selection {
-			msg = fmt.Sprintf("* %-10s| %d/%d", server.Name, server.Player_count, server.Max_players)
+			prefix = "*"
+		}
+		in_progress := ""
+		if server.InProgress() {
+			in_progress = fmt.Sprintf(" (round %d)", server.Round)
 		}
-		fontSize := 8.
-		textOp.GeoM.Translate(RENDER_WIDTH/2, float64(i)*fontSize)
-		textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, fontSize)
-		text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
+		players := fmt.Sprintf("%d/%d", server.Player_count, server.Max_players)
+		msg := fmt.Sprintf("%s %-16s| %-7s| %s%s", prefix, server.Name, players, FormatServerPing(&g.nm.client.pings, server), in_progress)
+		textOp.GeoM.Translate(left, float64(i-browser.scroll+3)*fontSize)
+		text.Draw(screen, msg, font_face, &textOp)
+
+		if server.Password_protected {
+			DrawLockIcon(screen, float32(left-fontSize), float32(i-browser.scroll+3)*float32(fontSize))
+		}
+	}
+
+	if len(g.context.available_servers) > SERVER_BROWSER_PAGE_SIZE {
+		textOp := text.DrawOptions{}
+		page_count := (len(g.context.available_servers) + SERVER_BROWSER_PAGE_SIZE - 1) / SERVER_BROWSER_PAGE_SIZE
+		msg := fmt.Sprintf("page %d/%d", (end-1)/SERVER_BROWSER_PAGE_SIZE+1, page_count)
+		textOp.GeoM.Translate(RENDER_WIDTH-float64(len(msg)+1)*fontSize, 1)
+		text.Draw(screen, msg, font_face, &textOp)
 	}
 
-	msg := "  back to menu"
+	textOp = text.DrawOptions{}
+	msg = "[TAB] sort [F] full [P] running [L] lan [A/D] page [J] name [C] code"
+	switch browser.prompt {
+	case ServerBrowserPromptName:
+		msg = fmt.Sprintf("server name: %s", browser.input.Display())
+	case ServerBrowserPromptCode:
+		msg = fmt.Sprintf("join code: %s", browser.input.Display())
+	case ServerBrowserPromptPassword:
+		msg = fmt.Sprintf("password for '%s': %s", browser.join_target.Name, browser.input.Display())
+	case ServerBrowserPromptResolving:
+		msg = fmt.Sprintf("looking for '%s'...", browser.input.String())
+	}
+	textOp.GeoM.Translate(1, RENDER_HEIGHT-(fontSize+1))
+	text.Draw(screen, msg, font_face, &textOp)
+
+	msg = "  back to menu"
 	if g.context.current_selection == 0 {
 		msg = "* back to menu"
 	}
-	fontSize := 8.
-	textOp := text.DrawOptions{}
+	textOp = text.DrawOptions{}
 	textOp.GeoM.Translate(RENDER_WIDTH/2, RENDER_HEIGHT-(fontSize*3))
 	textOp.GeoM.Translate(-float64(len(msg)/2)*fontSize, fontSize)
-	text.Draw(screen, msg, &text.GoTextFace{Source: g.am.new_level_font, Size: fontSize}, &textOp)
+	text.Draw(screen, msg, font_face, &textOp)
+}
+
+// a small padlock marking password protected servers, x and y is the top left
+func DrawLockIcon(screen *ebiten.Image, x, y float32) {
+	vector.StrokeRect(screen, x+1.5, y+1, 3, 3, 1, color.White, false)
+	vector.DrawFilledRect(screen, x, y+3, 6, 4, color.White, false)
 }
@@ -0,0 +1,64 @@
+package shared
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+)
+
+const (
+	// what every command logs unless told otherwise
+	DEFAULT_LOG_LEVEL = "info"
+
+	// keys of the fields which tie log lines together
+	LOG_PLAYER  = "player"
+	LOG_NAME    = "name"
+	LOG_ROOM    = "room"
+	LOG_SESSION = "session"
+	LOG_ROUND   = "round"
+	LOG_MATCH   = "match"
+)
+
+// debug, info, warn or error, see slog.Level.UnmarshalText
+func ParseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return l, fmt.Errorf("unknown log level '%s', use debug, info, warn or error", level)
+	}
+	return l, nil
+}
+
+// SetupLogging makes everything logged at level and above go to w, as
+// json lines if json is set or as key=value pairs otherwise.
+// the logger is made the default, so anything still using the log
+// package ends up there too
+func SetupLogging(w io.Writer, level string, json bool) (*slog.Logger, error) {
+	l, err := ParseLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler = slog.NewTextHandler(w, options)
+	if json {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// the error attribute of a log line
+func LogErr(err error) slog.Attr {
+	return slog.Any("err", err)
+}
+
+// addr as a string under key, json would otherwise spell out its fields
+func LogAddr(key string, addr net.Addr) slog.Attr {
+	if addr == nil {
+		return slog.String(key, "")
+	}
+	return slog.String(key, addr.String())
+}
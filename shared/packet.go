@@ -2,11 +2,14 @@ package shared
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 )
 
@@ -30,17 +33,133 @@ type PacketData struct {
 
 const MAGICBYTES = 73458339
 
+// what a listed server is up to, starts at 1 as gob leaves out zero values
+type ServerListingState uint8
+
+const (
+	ServerListingLobby ServerListingState = iota + 1
+	ServerListingInMatch
+)
+
 type AvailableServer struct {
+	// assigned by the mediator on registration, unique per hosted server
+	// unlike Name which is only for display
+	Host_ID string
+	// short code players can type in to join, handed out by the mediator
+	Join_code string
+
 	Ip   string
 	Port int
 	Name string
+	// one server process can host several rooms on the same port
+	Room int
+
+	Player_count       int
+	Max_players        int
+	Password_protected bool
+
+	State ServerListingState
+	// the round being played in the current match, 0 in the lobby
+	Round int
+}
+
+func (s AvailableServer) InProgress() bool {
+	return s.State == ServerListingInMatch
+}
+
+type ServerClosingData struct {
+	Reason string
+}
+
+// the mediator never answers with more bytes than it was sent, so requests
+// which expect a larger answer are padded
+const (
+	QUERY_PADDING             = 512
+	HOSTS_QUERY_PADDING       = 1100
+	LEADERBOARD_QUERY_PADDING = 1100
+)
+
+// asks the mediator for the server list starting at Offset.
+// answered by a HostsPage with as many servers as fit in the request size
+type HostsQuery struct {
+	Offset  int
+	Padding []byte
+}
+
+type HostsPage struct {
+	Servers []AvailableServer
+	Offset  int
+	Total   int
+}
+
+// asks a server directly for its best players, answered by a Leaderboard
+// with as many of them as fit in the request size
+type LeaderboardQuery struct {
+	Padding []byte
+}
+
+type LeaderboardEntry struct {
+	Username string
+	Rating   int
+	Matches  int
+	Wins     int
+	Kills    int
+	Deaths   int
+}
+
+// best rated first
+type Leaderboard struct {
+	Entries []LeaderboardEntry
+}
+
+// sent from a client directly to a server, which echoes it back untouched.
+// servers also ping their players, who echo those back in turn
+type PingData struct {
+	Sent_at     int64
+	From_server bool
+}
 
-	Player_count int
-	Max_players  int
+// a message from whoever runs the server, shown to every player
+type ServerMessageData struct {
+	Message string
 }
 
 type ReconcilliationData struct {
-	Name string
+	Name      string
+	Host_ID   string
+	Join_code string
+	Room      int
+	// proves Host_ID and Join_code were handed to the server before, only a
+	// server asking for them back with it gets them.
+	// sent along with every registration reply
+	Token string
+	// see QUERY_PADDING
+	Padding []byte
+
+	// only meaningful when registering with the mediator
+	// private servers are left out of the server list
+	Private            bool
+	Password_protected bool
+}
+
+// exchanged directly between client and server when joining.
+// a client opens with an empty packet, password protected servers answer
+// with a challenge which the client has to answer with a proof
+type NegotiateData struct {
+	Challenge []byte
+	Proof     []byte
+	Accepted  bool
+	// the room to join, see AvailableServer.Room
+	Room int
+	// what the player wants to be called, see ValidateUsername
+	Username string
+	// how others can join, only set once Accepted.
+	// servers send it again to every player when the mediator hands out a new one
+	Join_code string
+}
+
+type RejectionData struct {
+	Reason string
 }
 
 const (
@@ -64,8 +183,64 @@ const (
 	PacketTypeNegotiate
 	PacketTypeKeepAlive
 	PacketTypeUpdateMediator
+	PacketTypePing
+	PacketTypeConnectionRejected
+	// the mediator does not know the host that sent a keepalive or update
+	PacketTypeUnknownHost
+	PacketTypeSpectate
+	// hosts one mediator shares with another
+	PacketTypeMediatorGossip
+	// the server is going away, players should not wait for it
+	PacketTypeServerClosing
+	// a server taking itself off the mediator's list
+	PacketTypeUnregisterHost
+	// an admin removed the player, carries RejectionData
+	PacketTypeKicked
+	PacketTypeServerMessage
+	// LeaderboardQuery from players, Leaderboard back
+	PacketTypeLeaderboard
 )
 
+var packet_type_names = [...]string{
+	PacketTypeMatchFind:           "match_find",
+	PacketTypeMatchHost:           "match_host",
+	PacketTypeMatchStart:          "match_start",
+	PacketTypeMatchConnect:        "match_connect",
+	PacketTypeDisconnect:          "disconnect",
+	PacketTypeUpdateCurrentPlayer: "update_current_player",
+	PacketTypeUpdatePlayers:       "update_players",
+	PacketTypeBulletShoot:         "bullet_shoot",
+	PacketTypePlayerHit:           "player_hit",
+	PacketTypeClientToggleReady:   "client_toggle_ready",
+	PacketTypeServerStateChanged:  "server_state_changed",
+	PacketTypeNewRound:            "new_round",
+	PacketTypeNewMatch:            "new_match",
+	PacketTypeBackToLobby:         "back_to_lobby",
+	PacketTypeGameOver:            "game_over",
+	PacketTypeAvailableHosts:      "available_hosts",
+	PacketTypeNegotiate:           "negotiate",
+	PacketTypeKeepAlive:           "keep_alive",
+	PacketTypeUpdateMediator:      "update_mediator",
+	PacketTypePing:                "ping",
+	PacketTypeConnectionRejected:  "connection_rejected",
+	PacketTypeUnknownHost:         "unknown_host",
+	PacketTypeSpectate:            "spectate",
+	PacketTypeMediatorGossip:      "mediator_gossip",
+	PacketTypeServerClosing:       "server_closing",
+	PacketTypeUnregisterHost:      "unregister_host",
+	PacketTypeKicked:              "kicked",
+	PacketTypeServerMessage:       "server_message",
+	PacketTypeLeaderboard:         "leaderboard",
+}
+
+// every type that is not one of ours is "unknown"
+func (p PacketType) String() string {
+	if int(p) >= len(packet_type_names) || packet_type_names[p] == "" {
+		return "unknown"
+	}
+	return packet_type_names[p]
+}
+
 func ValidatePacket(packet Packet) error {
 	if packet.TotalSize != packet.HeaderSize+packet.PayloadSize {
 		return errors.New("packet has invalid sizes")
@@ -88,50 +263,46 @@ func DeserializePacket(data []byte) (Packet, []byte, error) {
 
 	err := binary.Read(r, binary.BigEndian, &packet.PacketType)
 	if err != nil {
-		fmt.Println("error during decoding of packet type", err)
-		return packet, nil, err
+		return packet, nil, fmt.Errorf("error during decoding of packet type: %w", err)
 	}
 
 	err = binary.Read(r, binary.BigEndian, &packet.HeaderSize)
 	if err != nil {
-		fmt.Println("error during decoding of header size", err)
-		return packet, nil, err
+		return packet, nil, fmt.Errorf("error during decoding of header size: %w", err)
 	}
 
 	err = binary.Read(r, binary.BigEndian, &packet.MagicBytes)
 	if err != nil {
-		fmt.Println("error during decoding of magic bytes", err)
-		return packet, nil, err
+		return packet, nil, fmt.Errorf("error during decoding of magic bytes: %w", err)
 	}
 
 	err = binary.Read(r, binary.BigEndian, &packet.Timestamp)
 	if err != nil {
-		fmt.Println("error during decoding of timestamp", err)
-		return packet, nil, err
+		return packet, nil, fmt.Errorf("error during decoding of timestamp: %w", err)
 	}
 
 	err = binary.Read(r, binary.BigEndian, &packet.Auth)
 	if err != nil {
-		fmt.Println("error during decoding of auth size", err)
-		return packet, nil, err
+		return packet, nil, fmt.Errorf("error during decoding of auth size: %w", err)
 	}
 
 	err = binary.Read(r, binary.BigEndian, &packet.PayloadSize)
 	if err != nil {
-		fmt.Println("error during decoding of paylaod size", err)
-		return packet, nil, err
+		return packet, nil, fmt.Errorf("error during decoding of paylaod size: %w", err)
 	}
 
 	err = binary.Read(r, binary.BigEndian, &packet.TotalSize)
 	if err != nil {
-		fmt.Println("error during decoding total size", err)
-		return packet, nil, err
+		return packet, nil, fmt.Errorf("error during decoding total size: %w", err)
 	}
 
 	err = ValidatePacket(packet)
 	if err != nil {
-		fmt.Println("error during packet validation", err)
-		return packet, nil, err
+		return packet, nil, fmt.Errorf("error during packet validation: %w", err)
+	}
+
+	if int(packet.TotalSize) > len(data) || packet.HeaderSize > packet.TotalSize {
+		return packet, nil, errors.New("packet is larger than what was received")
 	}
 
 	rawData := buf[packet.HeaderSize:packet.TotalSize]
@@ -184,3 +355,39 @@ func serializeData(data interface{}) ([]byte, error) {
 func AuthToString(auth [16]byte) string {
 	return fmt.Sprintf("%x", auth)
 }
+
+const (
+	USERNAME_MIN_LENGTH = 2
+	USERNAME_MAX_LENGTH = 12
+)
+
+// names are drawn with a pixel font which only has ascii
+func ValidateUsername(name string) error {
+	if len(name) < USERNAME_MIN_LENGTH || len(name) > USERNAME_MAX_LENGTH {
+		return fmt.Errorf("names are %d to %d characters long", USERNAME_MIN_LENGTH, USERNAME_MAX_LENGTH)
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' && r != '-' {
+			return errors.New("names can only have letters, digits, '_' and '-'")
+		}
+	}
+	return nil
+}
+
+// what a player who has not picked a name is called
+func DefaultUsername(auth [16]byte) string {
+	return fmt.Sprintf("tank-%x", auth[:3])
+}
+
+// join codes are typed by players, so they are matched case insensitively
+func NormalizeJoinCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// the answer to a password challenge, the password itself never leaves the client
+func PasswordProof(password string, challenge []byte, auth [16]byte) []byte {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write(challenge)
+	mac.Write(auth[:])
+	return mac.Sum(nil)
+}
@@ -0,0 +1,79 @@
+package game
+
+import "gotanks/sim"
+
+// the simulation lives in gotanks/sim so the server builds without ebiten,
+// these keep the client reading the same as before the split
+
+type (
+	Position               = sim.Position
+	LevelEnum              = sim.LevelEnum
+	Component              = sim.Component
+	TankMinimal            = sim.TankMinimal
+	StandardBullet         = sim.StandardBullet
+	StandardBulletTypeEnum = sim.StandardBulletTypeEnum
+	BulletHit              = sim.BulletHit
+	ServerGameStateEnum    = sim.ServerGameStateEnum
+	PlayerUpdate           = sim.PlayerUpdate
+	NewRoundEvent          = sim.NewRoundEvent
+	NewMatchEvent          = sim.NewMatchEvent
+	GameOverEvent          = sim.GameOverEvent
+	PlayerMatchStats       = sim.PlayerMatchStats
+	SpectateEvent          = sim.SpectateEvent
+)
+
+const (
+	SPRITE_SIZE = sim.SPRITE_SIZE
+	LEVEL_COUNT = sim.LEVEL_COUNT
+
+	SERVERPORT         = sim.SERVERPORT
+	BUFFER_SIZE        = sim.BUFFER_SIZE
+	UPDATE_INTERVAL    = sim.UPDATE_INTERVAL
+	KEEPALIVE_INTERVAL = sim.KEEPALIVE_INTERVAL
+
+	TANK_DEAD_VALUE = sim.TANK_DEAD_VALUE
+
+	LoaderMask = sim.LoaderMask
+	BarrelMask = sim.BarrelMask
+	BulletMask = sim.BulletMask
+	TracksMask = sim.TracksMask
+
+	TracksLight  = sim.TracksLight
+	TracksMedium = sim.TracksMedium
+	TracksHeavy  = sim.TracksHeavy
+	TracksEnd    = sim.TracksEnd
+
+	LoaderAutoloader   = sim.LoaderAutoloader
+	LoaderFastReload   = sim.LoaderFastReload
+	LoaderManualReload = sim.LoaderManualReload
+	LoaderEnd          = sim.LoaderEnd
+
+	BarrelStandard = sim.BarrelStandard
+	BarrelHeavy    = sim.BarrelHeavy
+	BarrelRubber   = sim.BarrelRubber
+	BarrelEnd      = sim.BarrelEnd
+
+	StandardBulletTypeStandard = sim.StandardBulletTypeStandard
+	StandardBulletTypeFast     = sim.StandardBulletTypeFast
+	StandardBulletTypeEnd      = sim.StandardBulletTypeEnd
+
+	BULLET_WIDTH  = sim.BULLET_WIDTH
+	BULLET_HEIGHT = sim.BULLET_HEIGHT
+
+	NetBoolTrue  = sim.NetBoolTrue
+	NetBoolFalse = sim.NetBoolFalse
+
+	ServerGameStateWaitingInLobby   = sim.ServerGameStateWaitingInLobby
+	ServerGameStatePlaying          = sim.ServerGameStatePlaying
+	ServerGameStateStartingNewMatch = sim.ServerGameStateStartingNewMatch
+	ServerGameStateStartingNewRound = sim.ServerGameStateStartingNewRound
+	ServerGameStateGoingBackToLobby = sim.ServerGameStateGoingBackToLobby
+	ServerGameStateGameOver         = sim.ServerGameStateGameOver
+)
+
+var (
+	NetBoolify          = sim.NetBoolify
+	DetermineLoaderName = sim.DetermineLoaderName
+	DetermineBarrelName = sim.DetermineBarrelName
+	DetermineBulletName = sim.DetermineBulletName
+)
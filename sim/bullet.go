@@ -0,0 +1,210 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+type StandardBulletTypeEnum uint8
+
+const (
+	StandardBulletTypeStandard StandardBulletTypeEnum = iota + 1
+	StandardBulletTypeFast
+	StandardBulletTypeEnd
+)
+
+func DetermineBulletName(bullet_type StandardBulletTypeEnum) string {
+	switch bullet_type {
+	case StandardBulletTypeFast:
+		return "sniper"
+	case StandardBulletTypeStandard:
+		return "standard"
+	default:
+		return "missing!"
+	}
+}
+
+const (
+	BULLET_WIDTH  = 8
+	BULLET_HEIGHT = 8
+)
+
+type StandardBullet struct {
+	Position
+	ID          string
+	Rotation    float64
+	Bullet_type StandardBulletTypeEnum
+
+	Num_bounces int
+	Velocity    float64
+	// auth of the player who fired it, set by the server
+	Owner string
+
+	// in physics ticks
+	grace_period int
+}
+
+type BulletHit struct {
+	Player    string
+	Bullet_ID string
+	// who fired the bullet, can be the player who was hit
+	Shooter string
+}
+
+func (b StandardBullet) GetId() string {
+	return b.ID
+}
+
+// moves the bullet one physics tick ahead.
+// on_bounce, if not nil, is called every time the bullet hits a wall.
+// alive is false once the bullet has run out of bounces
+func (b StandardBullet) Step(level *Level, on_bounce func(bullet StandardBullet)) (next StandardBullet, alive bool) {
+	x, y := math.Sin(b.Rotation)*b.Velocity, math.Cos(b.Rotation)*b.Velocity
+
+	b.Position.Y += y
+	collided_object := level.CheckObjectCollisionWithDimensions(b.Position, Position{4, 4})
+	if collided_object != nil {
+		b.Rotation = math.Pi - b.Rotation
+		if on_bounce != nil {
+			on_bounce(b)
+		}
+		if b.Num_bounces == 0 {
+			return b, false
+		}
+		b.Num_bounces--
+		b.Position.Y -= y
+	}
+
+	b.Position.X += x
+	collided_object = level.CheckObjectCollisionWithDimensions(b.Position, Position{4, 4})
+	if collided_object != nil {
+		b.Rotation = -b.Rotation
+		if on_bounce != nil {
+			on_bounce(b)
+		}
+		if b.Num_bounces == 0 {
+			return b, false
+		}
+		b.Num_bounces--
+		b.Position.X -= x
+	}
+
+	b.grace_period = max(b.grace_period-1, 0)
+	return b, true
+}
+
+func (bullet StandardBullet) IsColliding(position, dimension Position) bool {
+	if bullet.grace_period > 0 {
+		return false
+	}
+
+	if bullet.X < position.X+dimension.X &&
+		bullet.X+BULLET_WIDTH > position.X &&
+		bullet.Y < position.Y+dimension.Y &&
+		bullet.Y+BULLET_HEIGHT > position.Y {
+		return true
+	}
+
+	return false
+}
+
+// the bullets in flight, safe to use from multiple goroutines.
+// the zero value is ready to use
+type BulletManager struct {
+	sync.RWMutex
+	bullets map[string]StandardBullet
+	index   uint
+}
+
+func (bm *BulletManager) NewBulletId() string {
+	bm.index++
+	return fmt.Sprintf("0:%d", bm.index)
+}
+
+func (bm *BulletManager) DetermineGracePeriod(bullet_type StandardBulletTypeEnum) int {
+	switch bullet_type {
+	case StandardBulletTypeFast:
+		return 15
+	default:
+		return 30
+	}
+}
+
+func (bm *BulletManager) AddBullet(bullet StandardBullet) {
+	bm.Lock()
+	defer bm.Unlock()
+	if bm.bullets == nil {
+		bm.bullets = make(map[string]StandardBullet)
+	}
+	bm.bullets[bullet.GetId()] = bullet
+}
+
+// takes the bullet with id out of play
+func (bm *BulletManager) Remove(id string) (StandardBullet, bool) {
+	bm.Lock()
+	defer bm.Unlock()
+	bullet, ok := bm.bullets[id]
+	delete(bm.bullets, id)
+	return bullet, ok
+}
+
+func (bm *BulletManager) Reset() {
+	bm.Lock()
+	defer bm.Unlock()
+	for k := range bm.bullets {
+		delete(bm.bullets, k)
+	}
+}
+
+// bullets in play
+func (bm *BulletManager) Count() int {
+	bm.RLock()
+	defer bm.RUnlock()
+	return len(bm.bullets)
+}
+
+// calls f for every bullet, f must not use the manager
+func (bm *BulletManager) Each(f func(bullet StandardBullet)) {
+	bm.RLock()
+	defer bm.RUnlock()
+	for _, bullet := range bm.bullets {
+		f(bullet)
+	}
+}
+
+// advances every bullet by ticks physics ticks, see PHYSICS_TICK_RATE.
+// bullets move one physics tick at a time, so a slow tick rate can not
+// make them skip through walls.
+// on_bounce is passed on to StandardBullet.Step
+func (bm *BulletManager) Update(level *Level, ticks int, on_bounce func(bullet StandardBullet)) {
+	bm.Lock()
+	defer bm.Unlock()
+	for key, bullet := range bm.bullets {
+		alive := true
+		for range ticks {
+			bullet, alive = bullet.Step(level, on_bounce)
+			if !alive {
+				break
+			}
+		}
+		if !alive {
+			delete(bm.bullets, key)
+		} else {
+			bm.bullets[key] = bullet
+		}
+	}
+}
+
+func (bm *BulletManager) IsColliding(position, dimension Position) *StandardBullet {
+	bm.RLock()
+	defer bm.RUnlock()
+	for _, bullet := range bm.bullets {
+		hit := bullet.IsColliding(position, dimension)
+		if hit {
+			return &bullet
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package sim
+
+import (
+	"log/slog"
+)
+
+// Component masks
+const (
+	LoaderMask uint32 = 0xFF       // First 8 bits (1-8)
+	BarrelMask uint32 = 0xFF00     // Second 8 bits (9-16)
+	BulletMask uint32 = 0xFF0000   // Third 8 bits (17-24)
+	TracksMask uint32 = 0xFF000000 // Fourth 8 bits (25-32)
+)
+
+type Component struct {
+	Config uint32
+}
+
+// Set updates the specified component in the configuration.
+func (c *Component) Set(mask uint32, value uint8) {
+	// Clear the bits for the component
+	c.Config &= ^mask
+	// Set the new value, shifted to the appropriate position
+	switch mask {
+	case LoaderMask:
+		c.Config |= uint32(value)
+	case BarrelMask:
+		c.Config |= uint32(value) << 8
+	case BulletMask:
+		c.Config |= uint32(value) << 16
+	case TracksMask:
+		c.Config |= uint32(value) << 24
+	}
+}
+
+// Get retrieves the value of a specified component from the configuration.
+func (c *Component) Get(mask uint32) uint8 {
+	switch mask {
+	case LoaderMask:
+		return uint8(c.Config & mask)
+	case BarrelMask:
+		return uint8((c.Config & mask) >> 8)
+	case BulletMask:
+		return uint8((c.Config & mask) >> 16)
+	case TracksMask:
+		return uint8((c.Config & mask) >> 24)
+	}
+	return 0 // Default fallback
+}
+
+func (c *Component) LogConfiguration() {
+	slog.Debug("component configuration", "loader", c.Get(LoaderMask), "barrel", c.Get(BarrelMask),
+		"bullet", c.Get(BulletMask), "tracks", c.Get(TracksMask))
+}
+
+const (
+	LoaderAutoloader uint8 = iota + 1 // Starts at 1 to avoid GOB's zero-value issue
+	LoaderFastReload
+	LoaderManualReload
+	LoaderEnd
+)
+
+const (
+	BarrelStandard uint8 = iota + 1
+	BarrelHeavy
+	BarrelRubber
+	BarrelEnd
+)
+
+const (
+	TracksLight uint8 = iota + 1
+	TracksMedium
+	TracksHeavy
+	TracksEnd
+)
+
+func DetermineLoaderName(loader_type uint8) string {
+	switch loader_type {
+	case LoaderAutoloader:
+		return "autoloader"
+	case LoaderFastReload:
+		return "standard"
+	case LoaderManualReload:
+		return "manual"
+	default:
+		return "missing!"
+	}
+}
+
+func DetermineBarrelName(barrel_type uint8) string {
+	switch barrel_type {
+	case BarrelStandard:
+		return "standard"
+	case BarrelHeavy:
+		return "heavy"
+	case BarrelRubber:
+		return "rubber"
+	default:
+		return "missing!"
+	}
+}
+
+func DetermineTracksName(tracks_type uint8) string {
+	switch tracks_type {
+	case TracksLight:
+		return "light"
+	case TracksMedium:
+		return "medium"
+	case TracksHeavy:
+		return "heavy"
+	default:
+		return "missing!"
+	}
+}
+
+// the parts of a tank by name, see Component
+type Loadout struct {
+	Loader string
+	Barrel string
+	Bullet string
+	Tracks string
+}
+
+func (c Component) Loadout() Loadout {
+	return Loadout{
+		Loader: DetermineLoaderName(c.Get(LoaderMask)),
+		Barrel: DetermineBarrelName(c.Get(BarrelMask)),
+		Bullet: DetermineBulletName(StandardBulletTypeEnum(c.Get(BulletMask))),
+		Tracks: DetermineTracksName(c.Get(TracksMask)),
+	}
+}
@@ -0,0 +1,93 @@
+package sim
+
+import (
+	"github.com/lafriks/go-tiled"
+)
+
+const (
+	LEVEL_COUNT = 2
+
+	SPRITE_SIZE = 16
+)
+
+type Position struct {
+	X, Y float64
+}
+
+type LevelEnum int
+
+// the parts of a level the game is played on, what it looks like is up to
+// the client
+type Level struct {
+	Tiled_map tiled.Map
+
+	spawns     []tiled.Object
+	collisions []tiled.Object
+}
+
+func (l *Level) GetCollisions(object_group *tiled.ObjectGroup) {
+	for _, object := range object_group.Objects {
+		l.collisions = append(l.collisions, *object)
+	}
+}
+
+func (l *Level) getSpawns(object_group *tiled.ObjectGroup) {
+	for _, object := range object_group.Objects {
+		l.spawns = append(l.spawns, *object)
+	}
+}
+
+func (l *Level) GetSpawnPositions() []Position {
+	spawns := []Position{}
+	for _, value := range l.spawns {
+		spawns = append(spawns, Position{value.X, value.Y})
+	}
+
+	return spawns
+}
+
+func (l *Level) CheckObjectCollisionWithDimensions(position Position, dimension Position) *tiled.Object {
+	for _, object := range l.collisions {
+		if object.X < position.X+dimension.X &&
+			object.X+object.Width > position.X &&
+			object.Y < position.Y+dimension.Y &&
+			object.Y+object.Height > position.Y {
+			return &object
+		}
+	}
+
+	return nil
+}
+
+func (l *Level) CheckObjectCollision(position Position) *tiled.Object {
+	for _, object := range l.collisions {
+		if object.X < position.X+SPRITE_SIZE &&
+			object.X+object.Width > position.X &&
+			object.Y < position.Y+SPRITE_SIZE &&
+			object.Y+object.Height > position.Y {
+			return &object
+		}
+	}
+
+	return nil
+}
+
+func LoadLevel(map_path string) (Level, error) {
+	game_map, err := tiled.LoadFile(map_path)
+	if err != nil {
+		return Level{}, err
+	}
+
+	level := Level{Tiled_map: *game_map}
+	for _, object_group := range level.Tiled_map.ObjectGroups {
+		// Loop through ob in the object group
+		switch object_group.Name {
+		case "collisions":
+			level.GetCollisions(object_group)
+		case "spawn":
+			level.getSpawns(object_group)
+		}
+	}
+
+	return level, nil
+}
@@ -0,0 +1,48 @@
+package sim
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	SERVERPORT  = 7707
+	BUFFER_SIZE = 2048
+
+	MEDIATOR_PORT = 8080
+	// comma separated, see ParseMediatorAddrs
+	MEDIATOR_ADDR = "84.215.22.166"
+
+	// update_interval = fps / desired ticks per second
+	// 3 = 60/20
+	UPDATE_INTERVAL = 3
+	// the mediator only needs to hear from a server every few seconds
+	// and rate limits those that talk more
+	MEDIATOR_UPDATE_INTERVAL = 60
+)
+
+// parses a comma separated list of mediators, each either 'host' or
+// 'host:port'. the port defaults to MEDIATOR_PORT
+func ParseMediatorAddrs(list string) ([]*net.UDPAddr, error) {
+	addrs := []*net.UDPAddr{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(entry); err != nil {
+			entry = net.JoinHostPort(entry, strconv.Itoa(MEDIATOR_PORT))
+		}
+		addr, err := net.ResolveUDPAddr("udp", entry)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no mediator given")
+	}
+	return addrs, nil
+}
@@ -0,0 +1,57 @@
+package sim
+
+import "math"
+
+const (
+	// what players start at
+	INITIAL_RATING = 1000.
+	// the most a two player match can move a rating
+	RATING_K = 32.
+)
+
+// how a match changed a player's rating, see StatsStore.SaveMatchResults
+type MatchResult struct {
+	Match_ID      string
+	Player_ID     string
+	Rating_before float64
+	Rating_after  float64
+}
+
+// chance of a beating b going by their ratings
+func expectedScore(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// rates a match as if every pair of players had played each other: the
+// winner beat everyone and the rest drew among themselves. every pair
+// counts for a share of RATING_K, so bigger matches do not move ratings more
+func RateMatch(match_id string, ratings map[string]float64, winner string) []MatchResult {
+	results := []MatchResult{}
+	if len(ratings) < 2 {
+		return results
+	}
+
+	k := RATING_K / float64(len(ratings)-1)
+	for player, rating := range ratings {
+		change := 0.
+		for opponent, opponent_rating := range ratings {
+			if opponent == player {
+				continue
+			}
+			score := 0.5
+			if player == winner {
+				score = 1
+			} else if opponent == winner {
+				score = 0
+			}
+			change += k * (score - expectedScore(rating, opponent_rating))
+		}
+		results = append(results, MatchResult{
+			Match_ID:      match_id,
+			Player_ID:     player,
+			Rating_before: rating,
+			Rating_after:  rating + change,
+		})
+	}
+	return results
+}
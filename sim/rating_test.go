@@ -0,0 +1,82 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+func ratingsAfter(results []MatchResult) map[string]float64 {
+	after := map[string]float64{}
+	for _, result := range results {
+		after[result.Player_ID] = result.Rating_after
+	}
+	return after
+}
+
+func TestRateMatchNeedsTwoPlayers(t *testing.T) {
+	if results := RateMatch("m", map[string]float64{"a": INITIAL_RATING}, "a"); len(results) != 0 {
+		t.Fatalf("a match played alone was rated: %+v", results)
+	}
+}
+
+func TestRateMatchBetweenEquals(t *testing.T) {
+	results := RateMatch("m", map[string]float64{"a": INITIAL_RATING, "b": INITIAL_RATING}, "a")
+	if len(results) != 2 {
+		t.Fatalf("expected a result per player, got %+v", results)
+	}
+	for _, result := range results {
+		if result.Match_ID != "m" || result.Rating_before != INITIAL_RATING {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	}
+	after := ratingsAfter(results)
+	if after["a"] != INITIAL_RATING+RATING_K/2 || after["b"] != INITIAL_RATING-RATING_K/2 {
+		t.Fatalf("expected +-%v, got %v", RATING_K/2, after)
+	}
+}
+
+func TestRateMatchUpset(t *testing.T) {
+	favourite := RateMatch("m", map[string]float64{"strong": 1400, "weak": 1000}, "strong")
+	upset := RateMatch("m", map[string]float64{"strong": 1400, "weak": 1000}, "weak")
+
+	gained := ratingsAfter(favourite)["strong"] - 1400
+	upset_gain := ratingsAfter(upset)["weak"] - 1000
+	if gained <= 0 || upset_gain <= gained {
+		t.Fatalf("beating the favourite should gain more than being it, %v against %v", upset_gain, gained)
+	}
+	if upset_gain >= RATING_K {
+		t.Fatalf("a two player match moved a rating by %v", upset_gain)
+	}
+}
+
+func TestRateMatchIsZeroSum(t *testing.T) {
+	ratings := map[string]float64{"a": 1100, "b": 950, "c": 1000, "d": 1320}
+	for winner := range ratings {
+		total := 0.
+		for _, result := range RateMatch("m", ratings, winner) {
+			total += result.Rating_after - result.Rating_before
+		}
+		if math.Abs(total) > 1e-9 {
+			t.Fatalf("with %s winning ratings changed by %v in total", winner, total)
+		}
+	}
+}
+
+func TestRateMatchSize(t *testing.T) {
+	ratings := map[string]float64{}
+	for _, player := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		ratings[player] = INITIAL_RATING
+	}
+	after := ratingsAfter(RateMatch("m", ratings, "a"))
+
+	// bigger matches do not move ratings more
+	if gain := after["a"] - INITIAL_RATING; gain != RATING_K/2 {
+		t.Fatalf("the winner of a big match gained %v", gain)
+	}
+	// the rest drew among themselves and lost the same to the winner
+	for player, rating := range after {
+		if player != "a" && rating != after["b"] {
+			t.Fatalf("losers of the same rating ended up apart: %v", after)
+		}
+	}
+}
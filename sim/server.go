@@ -0,0 +1,1339 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	crypto_rand "crypto/rand"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ServerGameStateEnum int
+
+const (
+	NetBoolTrue  = 1
+	NetBoolFalse = 2
+)
+
+const (
+	ServerGameStateWaitingInLobby ServerGameStateEnum = iota
+	ServerGameStatePlaying
+	ServerGameStateStartingNewMatch
+	ServerGameStateStartingNewRound
+	ServerGameStateGoingBackToLobby
+	ServerGameStateGameOver
+)
+
+// converts uint to bool
+// we need this because gob can't decode nil values
+func NetBoolify(n uint) bool {
+	return n == 1
+}
+
+const (
+	NEW_LEVEL_INTERVAL_S  = 3
+	GAME_OVER_INTERVAL_S  = 5
+	STATE_CHANGE_GRACE_MS = 500
+	KEEPALIVE_INTERVAL    = 30
+
+	WIN_THRESHOLD = 3
+)
+
+type ConnectedPlayer struct {
+	tank   TankMinimal
+	player Player
+	addr   *net.UDPAddr
+	ready  uint
+	// joined during a match, watches until the next round starts
+	spectating bool
+	// round trip time, 0 until a ping has been answered
+	ping time.Duration
+}
+
+type PlayerUpdate struct {
+	Tank       TankMinimal
+	ID         string
+	Name       string
+	Ready      uint
+	Spectating uint
+}
+
+type ConnectedPlayers struct {
+	sync.RWMutex
+	m map[string]ConnectedPlayer
+}
+
+type NewRoundEvent struct {
+	Spawns    map[string]Position
+	Timestamp time.Time
+	Level     LevelEnum
+	Winner    string
+}
+
+type NewMatchEvent struct {
+	Timestamp time.Time
+}
+
+// sent to players joining a match that is already being played
+type SpectateEvent struct {
+	Level LevelEnum
+	State ServerGameStateEnum
+}
+
+// the id the mediator knows this server by.
+// the id and code are kept when the mediator forgets about us, so that we
+// can ask for them back when registering again
+type MediatorRegistration struct {
+	sync.RWMutex
+	host_id   string
+	join_code string
+	// lets us ask for host_id and join_code back, see shared.ReconcilliationData.Token
+	token      string
+	registered bool
+}
+
+func (r *MediatorRegistration) Registered() bool {
+	r.RLock()
+	defer r.RUnlock()
+	return r.registered
+}
+
+func (r *MediatorRegistration) Unregister() {
+	r.Lock()
+	defer r.Unlock()
+	r.registered = false
+}
+
+func (r *MediatorRegistration) HostID() string {
+	r.RLock()
+	defer r.RUnlock()
+	return r.host_id
+}
+
+func (r *MediatorRegistration) JoinCode() string {
+	r.RLock()
+	defer r.RUnlock()
+	return r.join_code
+}
+
+func (r *MediatorRegistration) Token() string {
+	r.RLock()
+	defer r.RUnlock()
+	return r.token
+}
+
+func (r *MediatorRegistration) Set(host_id, join_code, token string) {
+	r.Lock()
+	defer r.Unlock()
+	r.host_id = host_id
+	r.join_code = join_code
+	r.token = token
+	r.registered = true
+}
+
+// each mediator hands out its own registration
+type MediatorLink struct {
+	addr         *net.UDPAddr
+	registration MediatorRegistration
+}
+
+const (
+	// how long a player has to answer a password challenge
+	CHALLENGE_TTL = time.Second * 10
+	// anyone can ask for a challenge, so only so many are kept at once
+	MAX_CHALLENGES        = 1024
+	MAX_CHALLENGES_PER_IP = 4
+)
+
+type PasswordChallenge struct {
+	challenge []byte
+	ip        string
+	issued    time.Time
+}
+
+// outstanding password challenges, keyed by player auth
+type PasswordChallenges struct {
+	sync.Mutex
+	m map[string]PasswordChallenge
+}
+
+// a new challenge for auth, replacing any it had.
+// false if ip or the server already has too many outstanding
+func (c *PasswordChallenges) Issue(auth string, ip net.IP, now time.Time) ([]byte, bool, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.m, auth)
+	from_ip := 0
+	for _, outstanding := range c.m {
+		if outstanding.ip == ip.String() {
+			from_ip++
+		}
+	}
+	if from_ip >= MAX_CHALLENGES_PER_IP || len(c.m) >= MAX_CHALLENGES {
+		return nil, false, nil
+	}
+
+	challenge := make([]byte, 16)
+	_, err := crypto_rand.Read(challenge)
+	if err != nil {
+		return nil, false, err
+	}
+	c.m[auth] = PasswordChallenge{challenge: challenge, ip: ip.String(), issued: now}
+	return challenge, true, nil
+}
+
+// the challenge auth was given, every challenge can only be answered once
+func (c *PasswordChallenges) Take(auth string, now time.Time) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	outstanding, ok := c.m[auth]
+	delete(c.m, auth)
+	if !ok || now.Sub(outstanding.issued) > CHALLENGE_TTL {
+		return nil, false
+	}
+	return outstanding.challenge, true
+}
+
+// forgets the challenges nobody answered in time
+func (c *PasswordChallenges) Prune(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	for auth, outstanding := range c.m {
+		if now.Sub(outstanding.issued) > CHALLENGE_TTL {
+			delete(c.m, auth)
+		}
+	}
+}
+
+func CreateServerName() string {
+	names := []string{
+		"apple", "banana", "cherry", "date", "elderberry", "fig", "grape", "honeydew",
+		"kiwi", "lemon", "mango", "nectarine", "orange", "papaya", "quince", "raspberry",
+		"strawberry", "tangerine", "ugli", "vanilla", "watermelon", "xigua", "yam", "zucchini",
+		"brick", "walls", "yellow", "red", "blue", "purple", "orange", "funny", "warm", "cold",
+	}
+	return names[rand.Intn(len(names))]
+}
+
+type Server struct {
+	conn                    *net.UDPConn
+	accepts_new_connections atomic.Bool
+	// ticks simulated so far
+	tick       uint64
+	tick_stats TickStats
+
+	packet_channel    chan shared.PacketData
+	connected_players ConnectedPlayers
+	// admin commands, run between ticks, see Server.do
+	admin_channel chan func()
+
+	bm     BulletManager
+	levels []Level
+	// only touched by the game loop, other goroutines read view
+	state       ServerGameStateEnum
+	view        atomic.Pointer[RoomView]
+	sm          *ServerSyncManager
+	Name        string
+	match_stats MatchStats
+
+	// see RoomHost
+	host     *RoomHost
+	room     int
+	sessions *Sessions
+	access   *Access
+	metrics  *Metrics
+	replays  *Replays
+	// every line says which room it is about
+	log *slog.Logger
+
+	current_level int
+
+	wait_time time.Time
+
+	mediators []*MediatorLink
+
+	config     ServerConfig
+	challenges PasswordChallenges
+}
+
+func (s *Server) CurrentLevel() *Level {
+	return &s.levels[s.current_level]
+}
+
+// what the game loop last published about the room,
+// safe to read from any goroutine
+type RoomView struct {
+	State ServerGameStateEnum
+	Level LevelEnum
+}
+
+func (s *Server) View() RoomView {
+	return *s.view.Load()
+}
+
+// expects to be run on the game loop
+func (s *Server) publish() {
+	s.view.Store(&RoomView{State: s.state, Level: s.CurrentLevelEnum()})
+}
+
+func newRoom(conn *net.UDPConn, config ServerConfig, room int, mediator_addrs []*net.UDPAddr, host *RoomHost) (*Server, error) {
+	server := Server{}
+	server.conn = conn
+
+	server.packet_channel = make(chan shared.PacketData)
+	server.admin_channel = make(chan func())
+	server.connected_players.m = make(map[string]ConnectedPlayer)
+
+	server.accepts_new_connections.Store(true)
+	for _, level := range config.Maps {
+		level_path := fmt.Sprintf("assets/tiled/level_%d.tmx", level)
+		level, err := LoadLevel(level_path)
+		if err != nil {
+			return nil, err
+		}
+		server.levels = append(server.levels, level)
+	}
+
+	for _, addr := range mediator_addrs {
+		server.mediators = append(server.mediators, &MediatorLink{addr: addr})
+	}
+
+	server.sm = InitStatsManager(host.stats)
+	server.Name = RoomName(config.Name, room)
+	server.host = host
+	server.room = room
+	server.sessions = &host.sessions
+	server.access = host.access
+	server.metrics = &host.metrics
+	server.log = host.log.With(shared.LOG_ROOM, server.Name)
+	server.sm.log = server.log
+	server.replays = NewReplays(config, server.log)
+	server.config = config
+	server.challenges.m = make(map[string]PasswordChallenge)
+	server.publish()
+	return &server, nil
+}
+
+// StartServer runs every room of a server until ctx is cancelled, then
+// shuts them down and returns.
+// config is expected to be valid, see ServerConfig.Validate
+func StartServer(ctx context.Context, config ServerConfig) error {
+	mediator_addrs, err := ParseMediatorAddrs(config.mediatorList())
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("0.0.0.0"), Port: config.Port})
+	if err != nil {
+		return err
+	}
+
+	access, err := LoadAccess(config.Access_file, config.Allowlist)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	host := RoomHost{conn: conn, access: access, log: slog.Default()}
+	host.sessions.m = make(map[string]int)
+	stats, err := OpenStatsStore(config)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	// once every room has written its last stats
+	defer stats.Close()
+	host.stats = stats
+	for i := range config.Rooms {
+		room, err := newRoom(conn, config, i, mediator_addrs, &host)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		host.rooms = append(host.rooms, room)
+	}
+
+	var rcon_listener net.Listener
+	if config.Rcon_port != 0 {
+		rcon_listener, err = net.Listen("tcp", net.JoinHostPort(config.Rcon_host, strconv.Itoa(config.Rcon_port)))
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	var metrics_listener net.Listener
+	if config.Metrics_port != 0 {
+		metrics_listener, err = net.Listen("tcp", fmt.Sprintf(":%d", config.Metrics_port))
+		if err != nil {
+			if rcon_listener != nil {
+				rcon_listener.Close()
+			}
+			conn.Close()
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		host.Listen(ctx)
+	}()
+
+	if rcon_listener != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			host.ServeRcon(ctx, rcon_listener, config.Rcon_password)
+		}()
+	}
+	if metrics_listener != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			host.ServeMetrics(ctx, metrics_listener)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		host.RefreshLeaderboard(ctx)
+	}()
+	if config.Access_file != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			host.WatchAccess(ctx)
+		}()
+	}
+	if config.Console {
+		// blocks on stdin, so it is not waited for
+		go host.Console(ctx, os.Stdin, os.Stdout)
+	}
+
+	var logic sync.WaitGroup
+	for _, room := range host.rooms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			room.StartHandlingPackets(ctx)
+		}()
+		for _, mediator := range room.mediators {
+			room.TellMediator(mediator)
+		}
+
+		logic.Add(1)
+		go func() {
+			defer logic.Done()
+			room.StartServerLogic(ctx)
+		}()
+	}
+	logic.Wait()
+
+	for _, room := range host.rooms {
+		room.Shutdown("server is shutting down")
+	}
+	conn.Close()
+	wg.Wait()
+
+	for _, room := range host.rooms {
+		room.sm.DeInit()
+	}
+	host.log.Info("server shut down")
+	return nil
+}
+
+// tells players and mediators we are going away.
+// called once the game loop has stopped
+func (s *Server) Shutdown(reason string) {
+	s.accepts_new_connections.Store(false)
+	s.Broadcast(shared.Packet{PacketType: shared.PacketTypeServerClosing}, shared.ServerClosingData{Reason: reason})
+	s.replays.Close()
+
+	for _, mediator := range s.mediators {
+		if !mediator.registration.Registered() {
+			continue
+		}
+		data := shared.ReconcilliationData{Name: s.Name, Host_ID: mediator.registration.HostID(), Room: s.room}
+		raw_data, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeUnregisterHost}, [16]byte{}, data)
+		if err != nil {
+			s.log.Error("failed to serialize packet", shared.LogErr(err))
+			continue
+		}
+		s.write(shared.PacketTypeUnregisterHost, raw_data, mediator.addr)
+		mediator.registration.Unregister()
+	}
+}
+
+func (s *Server) UpdateMediator(mediator *MediatorLink) {
+	data := shared.AvailableServer{
+		Host_ID:      mediator.registration.HostID(),
+		Player_count: len(s.connected_players.m),
+		Max_players:  s.config.Max_players,
+		Name:         s.Name,
+		Room:         s.room,
+
+		Password_protected: s.config.Password != "",
+		State:              shared.ServerListingLobby,
+	}
+	if s.state != ServerGameStateWaitingInLobby {
+		data.State = shared.ServerListingInMatch
+		data.Round = s.CurrentRoundNumber()
+	}
+	raw_data, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeUpdateMediator}, [16]byte{}, data)
+	if err != nil {
+		log.Panic("failed to serialize packet")
+	}
+	s.write(shared.PacketTypeUpdateMediator, raw_data, mediator.addr)
+}
+func (s *Server) KeepAliveMediator(mediator *MediatorLink) {
+	data := shared.ReconcilliationData{Name: s.Name, Host_ID: mediator.registration.HostID(), Room: s.room}
+	raw_data, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeKeepAlive}, [16]byte{}, data)
+	if err != nil {
+		log.Panic("failed to serialize packet")
+	}
+	s.write(shared.PacketTypeKeepAlive, raw_data, mediator.addr)
+}
+
+func (s *Server) Broadcast(packet shared.Packet, data interface{}) {
+	s.connected_players.RLock()
+	defer s.connected_players.RUnlock()
+
+	raw_data, err := shared.SerializePacket(packet, [16]byte{}, data)
+	if err != nil {
+		log.Panic(err)
+	}
+	s.replays.Packet(raw_data)
+
+	for _, value := range s.connected_players.m {
+		s.write(packet.PacketType, raw_data, value.addr)
+	}
+}
+
+// sends raw_data, a serialized packet of packet_type, to addr
+func (s *Server) write(packet_type shared.PacketType, raw_data []byte, addr *net.UDPAddr) {
+	_, err := s.conn.WriteToUDP(raw_data, addr)
+	if err == nil {
+		s.metrics.Sent(packet_type, len(raw_data))
+	}
+}
+
+// the mediator at addr, nil if addr is not one of ours
+func (s *Server) mediatorAt(addr net.UDPAddr) *MediatorLink {
+	for _, mediator := range s.mediators {
+		if addr.IP.Equal(mediator.addr.IP) && addr.Port == mediator.addr.Port {
+			return mediator
+		}
+	}
+	return nil
+}
+
+// the id and join code of the first mediator we are registered with.
+// they are asked for when registering with the others, so players can use
+// the same code no matter which mediator they ask
+func (s *Server) preferredRegistration() (host_id, join_code, token string) {
+	for _, mediator := range s.mediators {
+		if mediator.registration.Registered() {
+			return mediator.registration.HostID(), mediator.registration.JoinCode(), mediator.registration.Token()
+		}
+	}
+	return "", "", ""
+}
+
+// logs and counts a packet whose data could not be read
+func (s *Server) dropUndecodable(packet_data shared.PacketData, err error) {
+	s.log.Warn("error decoding packet", "type", packet_data.Packet.PacketType, shared.LogAddr("addr", &packet_data.Addr),
+		shared.LOG_PLAYER, shared.AuthToString(packet_data.Packet.Auth), shared.LogErr(err))
+	s.metrics.DecodeError(packet_data.Packet.PacketType)
+}
+
+func (s *Server) HandlePacket(packet_data shared.PacketData) {
+	dec := gob.NewDecoder(bytes.NewReader(packet_data.Data))
+	switch packet_data.Packet.PacketType {
+	case shared.PacketTypeBulletShoot:
+		bullet := StandardBullet{}
+		err := dec.Decode(&bullet)
+		if err != nil {
+			s.dropUndecodable(packet_data, err)
+			return
+		}
+
+		// TODO
+		// bullet factory
+		bullet.grace_period = s.bm.DetermineGracePeriod(bullet.Bullet_type)
+		bullet.ID = s.bm.NewBulletId()
+		bullet.Owner = shared.AuthToString(packet_data.Packet.Auth)
+		if s.View().State == ServerGameStatePlaying {
+			s.match_stats.Add(bullet.Owner, func(stats *PlayerMatchStats) { stats.Shots++ })
+		}
+
+		s.Broadcast(packet_data.Packet, bullet)
+		s.bm.AddBullet(bullet)
+	case shared.PacketTypeUpdateCurrentPlayer:
+		s.connected_players.Lock()
+		player := s.connected_players.m[shared.AuthToString(packet_data.Packet.Auth)]
+		err := dec.Decode(&player.tank)
+		if err != nil {
+			s.connected_players.Unlock()
+			s.dropUndecodable(packet_data, err)
+			return
+		}
+		s.connected_players.m[shared.AuthToString(packet_data.Packet.Auth)] = player
+		s.connected_players.Unlock()
+	case shared.PacketTypeClientToggleReady:
+		s.connected_players.Lock()
+		player := s.connected_players.m[shared.AuthToString(packet_data.Packet.Auth)]
+		if NetBoolify(player.ready) {
+			player.ready = NetBoolFalse
+		} else {
+			player.ready = NetBoolTrue
+		}
+
+		s.connected_players.m[shared.AuthToString(packet_data.Packet.Auth)] = player
+		s.connected_players.Unlock()
+	case shared.PacketTypeDisconnect:
+		s.Leave(shared.AuthToString(packet_data.Packet.Auth))
+	case shared.PacketTypeMatchConnect:
+		var addr net.UDPAddr
+		err := dec.Decode(&addr)
+		if err != nil {
+			s.dropUndecodable(packet_data, err)
+			return
+		}
+		data_bytes, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeMatchConnect}, [16]byte{}, []byte{})
+		if err != nil {
+			log.Panic("error during serializing", err)
+		}
+		s.write(shared.PacketTypeMatchConnect, data_bytes, &addr)
+	case shared.PacketTypeUnknownHost:
+		mediator := s.mediatorAt(packet_data.Addr)
+		if mediator == nil {
+			return
+		}
+		if mediator.registration.Registered() {
+			s.log.Warn("mediator does not know us anymore, registering again", shared.LogAddr("mediator", mediator.addr))
+		}
+		mediator.registration.Unregister()
+	case shared.PacketTypeMatchHost:
+		mediator := s.mediatorAt(packet_data.Addr)
+		if mediator == nil {
+			s.log.Warn("ignoring host registration not sent by a mediator", shared.LogAddr("addr", &packet_data.Addr))
+			return
+		}
+
+		var inner_data shared.ReconcilliationData
+		err := dec.Decode(&inner_data)
+		if err != nil {
+			s.dropUndecodable(packet_data, err)
+			return
+		}
+		if mediator.registration.HostID() != inner_data.Host_ID {
+			s.log.Info("registered with mediator", shared.LogAddr("mediator", mediator.addr), "host_id", inner_data.Host_ID, "join_code", inner_data.Join_code)
+		}
+		_, prior_code, _ := s.preferredRegistration()
+		mediator.registration.Set(inner_data.Host_ID, inner_data.Join_code, inner_data.Token)
+		if _, join_code, _ := s.preferredRegistration(); join_code != prior_code {
+			// players already here are the ones who want to share it
+			s.Broadcast(shared.Packet{PacketType: shared.PacketTypeNegotiate}, shared.NegotiateData{Accepted: true, Join_code: join_code})
+		}
+	}
+}
+
+// every connected player gets a spawn, so this is also where spectators
+// become players again
+func (s *Server) GetSpawnMap() map[string]Position {
+	s.connected_players.Lock()
+	defer s.connected_players.Unlock()
+
+	spawn_map := make(map[string]Position)
+	spawns := s.CurrentLevel().GetSpawnPositions()
+
+	i := 0
+	for key, value := range s.connected_players.m {
+		spawn_map[key] = spawns[i%len(spawns)]
+		value.spectating = false
+		s.connected_players.m[key] = value
+		i++
+	}
+
+	return spawn_map
+}
+
+func (s *Server) StopSpectating() {
+	s.connected_players.Lock()
+	defer s.connected_players.Unlock()
+
+	for key, value := range s.connected_players.m {
+		value.spectating = false
+		s.connected_players.m[key] = value
+	}
+}
+
+// simulates one tick
+func (s *Server) UpdateServerLogic() {
+	if s.tick%s.config.sendInterval() == 0 {
+		packet := shared.Packet{PacketType: shared.PacketTypeUpdatePlayers}
+
+		players := []PlayerUpdate{}
+		s.connected_players.RLock()
+		for key, value := range s.connected_players.m {
+			spectating := uint(NetBoolFalse)
+			if value.spectating {
+				spectating = NetBoolTrue
+			}
+			players = append(players, PlayerUpdate{Tank: value.tank, ID: key, Name: value.player.Username, Ready: value.ready, Spectating: spectating})
+		}
+		sort.Slice(players, func(i, j int) bool {
+			return players[i].ID < players[j].ID
+		})
+		s.connected_players.RUnlock()
+		s.Broadcast(packet, players)
+	}
+
+	if s.tick%s.config.ticks(MEDIATOR_UPDATE_INTERVAL) == 0 {
+		for _, mediator := range s.mediators {
+			if !mediator.registration.Registered() {
+				// registration is repeated until the mediator replies with our id,
+				// one that is down just never does
+				s.TellMediator(mediator)
+			} else {
+				s.KeepAliveMediator(mediator)
+				s.UpdateMediator(mediator)
+			}
+		}
+	}
+
+	if s.tick%s.config.ticks(PLAYER_PING_INTERVAL) == 0 {
+		s.Broadcast(shared.Packet{PacketType: shared.PacketTypePing}, shared.PingData{Sent_at: time.Now().UnixNano(), From_server: true})
+		s.challenges.Prune(time.Now())
+	}
+
+	s.bm.Update(s.CurrentLevel(), s.config.physicsStep(), func(bullet StandardBullet) {
+		// the last bounce is the one that ends the bullet
+		if s.state == ServerGameStatePlaying && bullet.Num_bounces > 0 {
+			s.match_stats.Add(bullet.Owner, func(stats *PlayerMatchStats) { stats.Bounces++ })
+		}
+	})
+
+	s.connected_players.RLock()
+	for key, value := range s.connected_players.m {
+		if !value.tank.Alive() || value.spectating {
+			continue
+		}
+
+		bullet_hit := s.bm.IsColliding(value.tank.Position, Position{16, 16})
+		if bullet_hit != nil {
+			packet := shared.Packet{PacketType: shared.PacketTypePlayerHit}
+			data := BulletHit{Player: key, Bullet_ID: bullet_hit.GetId(), Shooter: bullet_hit.Owner}
+			s.connected_players.RUnlock()
+			s.Broadcast(packet, data)
+			s.connected_players.RLock()
+
+			s.bm.Remove(bullet_hit.GetId())
+			s.roundLog().Debug("player hit", shared.LOG_PLAYER, key, "shooter", bullet_hit.Owner, "bullet", bullet_hit.GetId())
+			if len(s.sm.stats.Rounds) > 0 {
+				round_id := s.sm.stats.Rounds[len(s.sm.stats.Rounds)-1].Round_ID
+				kill_event := NewKillEvent(round_id, key, bullet_hit.Owner)
+				kill_event.Killer_loadout = s.connected_players.m[bullet_hit.Owner].tank.Config
+				kill_event.Bullet_type = bullet_hit.Bullet_type
+				kill_event.Sync(s.sm)
+				if s.state == ServerGameStatePlaying {
+					s.match_stats.Kill(kill_event)
+				}
+			}
+		}
+	}
+	s.connected_players.RUnlock()
+
+	prior_state := s.state
+	new_state := s.CheckServerState()
+	if prior_state != new_state {
+		s.stateChanged(prior_state, new_state)
+		packet := shared.Packet{PacketType: shared.PacketTypeServerStateChanged}
+		s.Broadcast(packet, new_state)
+	}
+
+	s.tick++
+}
+
+// spectators are neither alive nor counted
+func (s *Server) GetAlivePlayers() (alive []ConnectedPlayer, total_count int) {
+	s.connected_players.Lock()
+	defer s.connected_players.Unlock()
+
+	alive_player := []ConnectedPlayer{}
+	for _, value := range s.connected_players.m {
+		if value.spectating {
+			continue
+		}
+		total_count++
+		if value.tank.Alive() {
+			alive_player = append(alive_player, value)
+		}
+	}
+
+	return alive_player, total_count
+}
+
+func (s *Server) GetReadyPlayers() (ready []ConnectedPlayer, total_count int) {
+	s.connected_players.Lock()
+	defer s.connected_players.Unlock()
+
+	ready_players := []ConnectedPlayer{}
+	for _, value := range s.connected_players.m {
+		if NetBoolify(value.ready) {
+			ready_players = append(ready_players, value)
+		}
+	}
+
+	return ready_players, len(s.connected_players.m)
+}
+
+func (s *Server) DetermineNextLevel() LevelEnum {
+	s.current_level = (s.current_level + 1) % len(s.levels)
+	return s.CurrentLevelEnum()
+}
+
+// the current level as clients know it, they load every level while the
+// server only loads the ones in its map list
+func (s *Server) CurrentLevelEnum() LevelEnum {
+	return LevelEnum(s.config.Maps[s.current_level] - 1)
+}
+
+func (s *Server) GetHighestWinCount() (top_player string, highest_wins int) {
+	match := s.GetCurrentMatch()
+
+	wins := make(map[string]int)
+	for _, round := range s.sm.stats.Rounds {
+		// drawn rounds count for nobody
+		if !round.Winner_ID.Valid {
+			continue
+		}
+		if match == nil || round.Match_ID == match.Match_ID {
+			wins[round.Winner_ID.String]++
+		}
+	}
+
+	for player_id, wins := range wins {
+		if wins > highest_wins {
+			top_player = player_id
+			highest_wins = wins
+		}
+	}
+
+	return top_player, highest_wins
+}
+
+func (s *Server) GetCurrentMatch() *Match {
+	if len(s.sm.stats.Matches) == 0 {
+		return nil
+	}
+	return s.sm.stats.Matches[len(s.sm.stats.Matches)-1]
+}
+
+// the round being played in the current match, starting at 1
+func (s *Server) CurrentRoundNumber() int {
+	match := s.GetCurrentMatch()
+	if match == nil {
+		return 0
+	}
+
+	count := 0
+	for _, round := range s.sm.stats.Rounds {
+		if round.Match_ID == match.Match_ID {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Server) StartNewMatch() *Match {
+	match := NewMatch(s.sm)
+
+	return &match
+}
+
+// starts recording the match that just started, see Replays
+func (s *Server) recordMatch() {
+	header := ReplayHeader{
+		Server:    s.Name,
+		Match_ID:  s.GetCurrentMatch().Match_ID,
+		Tick_rate: s.config.Tick_rate,
+		Maps:      s.config.Maps,
+		Level:     s.CurrentLevelEnum(),
+	}
+	s.connected_players.RLock()
+	for key, value := range s.connected_players.m {
+		header.Players = append(header.Players, ReplayPlayer{Player_ID: key, Name: value.player.Username})
+	}
+	s.connected_players.RUnlock()
+	sort.Slice(header.Players, func(i, j int) bool { return header.Players[i].Player_ID < header.Players[j].Player_ID })
+	s.replays.Start(header)
+}
+
+// counts and records the room moving from one state to another
+func (s *Server) stateChanged(from, to ServerGameStateEnum) {
+	s.metrics.Transition(s.room, from, to)
+	s.replays.State(from, to)
+}
+
+func (s *Server) StartNewRound() *Round {
+	current_match := s.GetCurrentMatch()
+	if current_match == nil {
+		log.Panic("can not start a round before a match")
+	}
+	round := NewRound(*current_match, s.CurrentLevelEnum(), s.sm)
+
+	return &round
+}
+
+func (s *Server) TellMediator(mediator *MediatorLink) {
+	host_id, join_code, token := mediator.registration.HostID(), mediator.registration.JoinCode(), mediator.registration.Token()
+	if host_id == "" {
+		host_id, join_code, token = s.preferredRegistration()
+	}
+	data := shared.ReconcilliationData{
+		Name:               s.Name,
+		Host_ID:            host_id,
+		Join_code:          join_code,
+		Token:              token,
+		Room:               s.room,
+		Private:            s.config.Private,
+		Password_protected: s.config.Password != "",
+		// the reply carries our id and join code
+		Padding: make([]byte, shared.QUERY_PADDING),
+	}
+	raw_data, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeMatchHost}, [16]byte{}, data)
+	if err != nil {
+		log.Panic("failed to serialize packet")
+	}
+	s.write(shared.PacketTypeMatchHost, raw_data, mediator.addr)
+}
+
+func (s *Server) CheckServerState() ServerGameStateEnum {
+	alive, total := s.GetAlivePlayers()
+	after_grace_period := time.Now().After(s.wait_time)
+	new_state := s.state
+	switch s.state {
+	case ServerGameStateWaitingInLobby:
+		ready, total := s.GetReadyPlayers()
+		if after_grace_period && total > 1 && len(ready) == total {
+			packet := shared.Packet{PacketType: shared.PacketTypeNewMatch}
+			new_state = ServerGameStateStartingNewMatch
+			wait_time := time.Now().Add(time.Second * time.Duration(s.config.New_level_interval_s))
+			event := NewMatchEvent{
+				Timestamp: wait_time,
+			}
+			s.Broadcast(packet, event)
+		}
+	case ServerGameStateGameOver:
+		if after_grace_period {
+			s.wait_time = time.Now().Add(time.Millisecond * time.Duration(s.config.State_change_grace_ms))
+			new_state = ServerGameStateWaitingInLobby
+			s.StopSpectating()
+		}
+	case ServerGameStatePlaying:
+		if after_grace_period && len(alive) <= 1 && total > 1 {
+			current_round := s.sm.stats.Rounds[len(s.sm.stats.Rounds)-1]
+
+			// everyone can die in the same tick, leaving nobody to win
+			winner_id := ""
+			if len(alive) == 1 {
+				winner_id = alive[0].player.Player_ID
+				current_round.Winner_ID = sql.NullString{String: winner_id, Valid: true}
+				s.roundLog().Info("round won", shared.LOG_PLAYER, winner_id, shared.LOG_NAME, alive[0].player.Username)
+				s.match_stats.Add(winner_id, func(stats *PlayerMatchStats) { stats.Rounds_won++ })
+				s.metrics.RoundPlayed(s.room)
+			} else {
+				s.roundLog().Info("round drawn")
+			}
+			current_round.CompleteRound(s.sm)
+
+			top_player, highest_wins := s.GetHighestWinCount()
+			if highest_wins >= s.config.Win_threshold {
+				match := s.GetCurrentMatch()
+				match.Winner_ID = sql.NullString{String: top_player, Valid: true}
+				match.CompleteMatch(s.sm)
+				s.sm.RateMatch(*match, s.match_stats.Participants())
+				s.roundLog().Info("match won", shared.LOG_PLAYER, top_player, "rounds", highest_wins)
+
+				new_state = ServerGameStateGameOver
+				wait_time := time.Now().Add(time.Second * time.Duration(s.config.Game_over_interval_s))
+
+				packet := shared.Packet{PacketType: shared.PacketTypeGameOver}
+				event := GameOverEvent{
+					Timestamp:  wait_time,
+					Level:      s.CurrentLevelEnum(),
+					Winner:     winner_id,
+					Scoreboard: s.match_stats.Scoreboard(),
+				}
+				s.wait_time = wait_time
+				s.Broadcast(packet, event)
+			} else {
+				s.announceNewRound(winner_id)
+				new_state = ServerGameStateStartingNewRound
+			}
+		}
+	case ServerGameStateStartingNewMatch:
+		if after_grace_period {
+			// TODO validate that this is accurate
+			// works as intended from a little bit of testing
+			s.DetermineNextLevel()
+
+			s.sm.stats.Matches = append(s.sm.stats.Matches, s.StartNewMatch())
+			s.match_stats.Reset()
+			s.recordMatch()
+			s.roundLog().Info("match started", "players", total)
+			// there is no winner yet
+			s.announceNewRound("")
+			new_state = ServerGameStateStartingNewRound
+			s.bm.Reset()
+		}
+	case ServerGameStateStartingNewRound:
+		// adding an extra buffer to let people alive themselves
+		if after_grace_period && total > 0 {
+			s.sm.stats.Rounds = append(s.sm.stats.Rounds, s.StartNewRound())
+			s.roundLog().Info("round started", "level", s.CurrentLevelEnum(), "number", s.CurrentRoundNumber())
+			new_state = ServerGameStatePlaying
+			s.wait_time = time.Now().Add(time.Millisecond * time.Duration(s.config.State_change_grace_ms))
+			s.bm.Reset()
+
+			s.connected_players.Lock()
+			for key, value := range s.connected_players.m {
+				value.ready = NetBoolFalse
+				s.connected_players.m[key] = value
+				if !value.spectating {
+					name := value.player.Username
+					s.match_stats.Add(key, func(stats *PlayerMatchStats) {
+						stats.Name = name
+						stats.Rounds_played++
+					})
+				}
+			}
+			s.connected_players.Unlock()
+		}
+	}
+
+	s.state = new_state
+	return s.state
+}
+
+// gives everyone a spawn on the current level, the round starts once
+// New_level_interval_s has passed
+func (s *Server) announceNewRound(winner string) {
+	packet := shared.Packet{PacketType: shared.PacketTypeNewRound}
+	wait_time := time.Now().Add(time.Second * time.Duration(s.config.New_level_interval_s))
+	event := NewRoundEvent{
+		Spawns:    s.GetSpawnMap(),
+		Timestamp: wait_time,
+		Level:     s.CurrentLevelEnum(),
+		Winner:    winner,
+	}
+
+	s.wait_time = wait_time
+	s.Broadcast(packet, event)
+}
+
+func (s *Server) AuthorizePacket(packet_data shared.PacketData) error {
+	s.connected_players.Lock()
+	defer s.connected_players.Unlock()
+	// this is the mediator server, typically
+	if packet_data.Packet.Auth == [16]byte{} {
+		return nil
+	}
+
+	// players only join by negotiating, see HandleNegotiate
+	if _, ok := s.connected_players.m[shared.AuthToString(packet_data.Packet.Auth)]; !ok {
+		return errors.New("player has not negotiated")
+	}
+	return nil
+}
+
+// expects connected_players to be locked
+func (s *Server) full() bool {
+	return len(s.connected_players.m) >= s.config.Max_players
+}
+
+// whether a player other than auth goes by name.
+// expects connected_players to be locked
+func (s *Server) usernameTaken(name, auth string) bool {
+	for key, player := range s.connected_players.m {
+		if key != auth && strings.EqualFold(player.player.Username, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// whether auth can go by name in this room.
+// expects connected_players to be locked
+func (s *Server) checkUsername(name, auth string) error {
+	if err := shared.ValidateUsername(name); err != nil {
+		return err
+	}
+	if s.usernameTaken(name, auth) {
+		return fmt.Errorf("the name '%s' is taken", name)
+	}
+	return nil
+}
+
+// returns the room the player was in before, they still have to leave it.
+// expects connected_players to be locked
+func (s *Server) admitPlayer(auth string, username string, addr *net.UDPAddr) (left int, ok bool) {
+	player := NewPlayer(auth, username)
+	s.sm.SaveJoined(player, func(returning bool) {
+		if returning {
+			s.playerLog(auth, username).Info("player joined", shared.LogAddr("addr", addr))
+		} else {
+			s.playerLog(auth, username).Info("new player joined", shared.LogAddr("addr", addr))
+		}
+	})
+	connected_player := ConnectedPlayer{addr: addr, player: player}
+
+	// joining mid match, the spawn logic only runs at the start of a round.
+	// this runs with packets, so the state is the one the loop published
+	view := s.View()
+	if view.State != ServerGameStateWaitingInLobby {
+		connected_player.spectating = true
+		connected_player.tank.Kill()
+		s.playerLog(auth, username).Info("player is spectating until the next round")
+
+		// the lobby is the right place to wait out a match that is
+		// starting or ending, there is nothing to watch
+		if view.State == ServerGameStatePlaying || view.State == ServerGameStateStartingNewRound {
+			s.SendTo(addr, shared.PacketTypeSpectate, SpectateEvent{Level: view.Level, State: view.State})
+		}
+	}
+	s.connected_players.m[auth] = connected_player
+	left, ok = s.sessions.Set(auth, s.room)
+	return left, ok && left != s.room
+}
+
+// removes auth from the room without telling them,
+// they disconnected or moved on to another room
+func (s *Server) Leave(auth string) bool {
+	s.connected_players.Lock()
+	player, ok := s.connected_players.m[auth]
+	delete(s.connected_players.m, auth)
+	s.connected_players.Unlock()
+	if !ok {
+		return false
+	}
+
+	s.sessions.Remove(auth, s.room)
+	s.playerLog(auth, player.player.Username).Info("player left")
+	return true
+}
+
+func (s *Server) SendTo(addr *net.UDPAddr, packet_type shared.PacketType, data interface{}) {
+	raw_data, err := shared.SerializePacket(shared.Packet{PacketType: packet_type}, [16]byte{}, data)
+	if err != nil {
+		s.log.Error("error serializing packet", "type", packet_type, shared.LogErr(err))
+		return
+	}
+	s.write(packet_type, raw_data, addr)
+}
+
+func (s *Server) Reject(addr *net.UDPAddr, reason string) {
+	s.log.Info("rejected", shared.LogAddr("addr", addr), "reason", reason)
+	s.SendTo(addr, shared.PacketTypeConnectionRejected, shared.RejectionData{Reason: reason})
+}
+
+// for lines about the player with auth, name can be left empty
+func (s *Server) playerLog(auth, name string) *slog.Logger {
+	if name == "" {
+		return s.log.With(shared.LOG_PLAYER, auth)
+	}
+	return s.log.With(shared.LOG_PLAYER, auth, shared.LOG_NAME, name)
+}
+
+// for lines about the current match and round.
+// expects to be run on the game loop, which is where they change
+func (s *Server) roundLog() *slog.Logger {
+	logger := s.log
+	if match := s.GetCurrentMatch(); match != nil {
+		logger = logger.With(shared.LOG_MATCH, match.Match_ID)
+	}
+	if len(s.sm.stats.Rounds) > 0 {
+		logger = logger.With(shared.LOG_ROUND, s.sm.stats.Rounds[len(s.sm.stats.Rounds)-1].Round_ID)
+	}
+	return logger
+}
+
+// handles the join handshake, which happens before authorization.
+// password protected servers only admit players through here
+func (s *Server) HandleNegotiate(packet_data shared.PacketData) {
+	var negotiation shared.NegotiateData
+	err := gob.NewDecoder(bytes.NewReader(packet_data.Data)).Decode(&negotiation)
+	if err != nil {
+		s.dropUndecodable(packet_data, err)
+		return
+	}
+
+	if packet_data.Packet.Auth == [16]byte{} {
+		return
+	}
+	auth := shared.AuthToString(packet_data.Packet.Auth)
+	_, join_code, _ := s.preferredRegistration()
+	accepted := shared.NegotiateData{Accepted: true, Join_code: join_code}
+
+	// a player who joins from another room leaves it once we are unlocked,
+	// two players swapping rooms would wait on each other otherwise
+	left, moved := 0, false
+	defer func() {
+		if moved {
+			s.host.rooms[left].Leave(auth)
+		}
+	}()
+	s.connected_players.Lock()
+	defer s.connected_players.Unlock()
+
+	if player, ok := s.connected_players.m[auth]; ok {
+		// negotiating again, maybe under another name
+		if negotiation.Username != player.player.Username {
+			if err := s.checkUsername(negotiation.Username, auth); err != nil {
+				s.Reject(&packet_data.Addr, err.Error())
+				return
+			}
+			s.playerLog(auth, negotiation.Username).Info("player changed their name", "old_name", player.player.Username)
+			player.player.Username = negotiation.Username
+			s.connected_players.m[auth] = player
+			s.sm.SaveJoined(player.player, func(bool) {})
+		}
+		s.SendTo(&packet_data.Addr, shared.PacketTypeNegotiate, accepted)
+		return
+	}
+
+	if reason := s.access.Check(auth, packet_data.Addr.IP); reason != "" {
+		s.Reject(&packet_data.Addr, reason)
+		return
+	}
+
+	if !s.accepts_new_connections.Load() {
+		s.Reject(&packet_data.Addr, "server is not accepting new players")
+		return
+	}
+
+	if s.full() {
+		s.Reject(&packet_data.Addr, "server is full")
+		return
+	}
+
+	if err := s.checkUsername(negotiation.Username, auth); err != nil {
+		s.Reject(&packet_data.Addr, err.Error())
+		return
+	}
+
+	if s.config.Password == "" {
+		left, moved = s.admitPlayer(auth, negotiation.Username, &packet_data.Addr)
+		s.SendTo(&packet_data.Addr, shared.PacketTypeNegotiate, accepted)
+		return
+	}
+
+	now := time.Now()
+	challenge, ok := s.challenges.Take(auth, now)
+	if len(negotiation.Proof) == 0 || !ok {
+		challenge, ok, err := s.challenges.Issue(auth, packet_data.Addr.IP, now)
+		if err != nil {
+			s.log.Error("error creating challenge", shared.LogErr(err))
+			return
+		}
+		if !ok {
+			// answering would only help whoever is flooding us
+			s.log.Debug("too many outstanding challenges", shared.LogAddr("addr", &packet_data.Addr))
+			return
+		}
+		s.SendTo(&packet_data.Addr, shared.PacketTypeNegotiate, shared.NegotiateData{Challenge: challenge})
+		return
+	}
+
+	if !hmac.Equal(negotiation.Proof, shared.PasswordProof(s.config.Password, challenge, packet_data.Packet.Auth)) {
+		s.Reject(&packet_data.Addr, "wrong password")
+		return
+	}
+
+	left, moved = s.admitPlayer(auth, negotiation.Username, &packet_data.Addr)
+	s.SendTo(&packet_data.Addr, shared.PacketTypeNegotiate, accepted)
+}
+
+// answers a ping from the server browser.
+// this happens before authorization, pinging a server should not join it
+func (s *Server) HandlePing(packet_data shared.PacketData) {
+	var ping shared.PingData
+	err := gob.NewDecoder(bytes.NewReader(packet_data.Data)).Decode(&ping)
+	if err != nil {
+		s.dropUndecodable(packet_data, err)
+		return
+	}
+
+	if ping.From_server {
+		// a player answering one of ours
+		auth := shared.AuthToString(packet_data.Packet.Auth)
+		s.connected_players.Lock()
+		defer s.connected_players.Unlock()
+		player, ok := s.connected_players.m[auth]
+		if ok {
+			player.ping = time.Since(time.Unix(0, ping.Sent_at))
+			s.connected_players.m[auth] = player
+		}
+		return
+	}
+
+	raw_data, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypePing}, [16]byte{}, ping)
+	if err != nil {
+		s.log.Error("error serializing ping", shared.LogErr(err))
+		return
+	}
+	s.write(shared.PacketTypePing, raw_data, &packet_data.Addr)
+}
+
+func (s *Server) StartHandlingPackets(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet_data := <-s.packet_channel:
+			s.handle(packet_data)
+		}
+	}
+}
+
+// handles one packet routed to this room
+func (s *Server) handle(packet_data shared.PacketData) {
+	switch packet_data.Packet.PacketType {
+	case shared.PacketTypePing:
+		s.HandlePing(packet_data)
+		return
+	case shared.PacketTypeNegotiate:
+		s.HandleNegotiate(packet_data)
+		return
+	}
+
+	err := s.AuthorizePacket(packet_data)
+	if err != nil {
+		// players are only turned away while negotiating,
+		// anything else from them is dropped until they have
+		s.log.Debug("dropped packet from a player who has not joined", shared.LogAddr("addr", &packet_data.Addr), "type", packet_data.Packet.PacketType, shared.LogErr(err))
+		return
+	}
+	s.HandlePacket(packet_data)
+}
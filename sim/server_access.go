@@ -0,0 +1,351 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how often the access file is checked for changes made by hand
+const ACCESS_POLL_INTERVAL = 5 * time.Second
+
+// keeps a player out, either by auth or by address
+type Ban struct {
+	// player id, see shared.AuthToString
+	Auth string
+	// an address like '10.0.0.1' or a range like '10.0.0.0/24'
+	Ip     string
+	Reason string
+	// zero for bans that never run out
+	Expires time.Time
+}
+
+func (b Ban) Target() string {
+	if b.Auth != "" {
+		return b.Auth
+	}
+	return b.Ip
+}
+
+func (b Ban) Expired(now time.Time) bool {
+	return !b.Expires.IsZero() && now.After(b.Expires)
+}
+
+// an ip is a range of one
+func parseIpRange(ip string) (*net.IPNet, error) {
+	if strings.Contains(ip, "/") {
+		_, network, err := net.ParseCIDR(ip)
+		return network, err
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("invalid ip '%s'", ip)
+	}
+	bits := 128
+	if parsed.To4() != nil {
+		parsed = parsed.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: parsed, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// what is kept in ServerConfig.Access_file, field names double as keys
+type AccessList struct {
+	Bans []Ban
+	// the only players let in when ServerConfig.Allowlist is on
+	Allowed []string
+}
+
+// who may join, shared by every room of a server.
+// changes are written to the file right away and changes made to the file
+// by hand are picked up, see RoomHost.WatchAccess
+type Access struct {
+	sync.RWMutex
+	list AccessList
+	// parsed Ban.Ip, by index into list.Bans
+	ranges []*net.IPNet
+
+	path      string
+	mod_time  time.Time
+	allowlist bool
+}
+
+// loads the list at path, which does not have to exist yet.
+// an empty path keeps the list in memory
+func LoadAccess(path string, allowlist bool) (*Access, error) {
+	access := &Access{path: path, allowlist: allowlist}
+	if path == "" {
+		return access, nil
+	}
+	_, err := access.reload()
+	return access, err
+}
+
+func (a *Access) set(list AccessList) error {
+	ranges := make([]*net.IPNet, len(list.Bans))
+	for i, ban := range list.Bans {
+		if ban.Ip == "" {
+			continue
+		}
+		network, err := parseIpRange(ban.Ip)
+		if err != nil {
+			return err
+		}
+		ranges[i] = network
+	}
+	a.list = list
+	a.ranges = ranges
+	return nil
+}
+
+// reads the file again if it changed since it was last read or written
+func (a *Access) reload() (changed bool, err error) {
+	info, err := os.Stat(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	if info.ModTime().Equal(a.mod_time) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return false, err
+	}
+	list := AccessList{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&list)
+	if err != nil {
+		return false, fmt.Errorf("error reading %s: %w", a.path, err)
+	}
+	err = a.set(list)
+	if err != nil {
+		return false, fmt.Errorf("error reading %s: %w", a.path, err)
+	}
+	a.mod_time = info.ModTime()
+	return true, nil
+}
+
+// expects the lock to be held
+func (a *Access) save() error {
+	now := time.Now()
+	bans := []Ban{}
+	for _, ban := range a.list.Bans {
+		if !ban.Expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	allowed := a.list.Allowed
+	if allowed == nil {
+		allowed = []string{}
+	}
+	err := a.set(AccessList{Bans: bans, Allowed: allowed})
+	if err != nil {
+		return err
+	}
+	if a.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(a.list, "", "\t")
+	if err != nil {
+		return err
+	}
+	// written next to the file and moved over it, so a crash can not
+	// leave half a list behind
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), filepath.Base(a.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err = errors.Join(err, tmp.Close()); err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), a.path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	a.mod_time = info.ModTime()
+	return nil
+}
+
+// why the player with auth at ip is not let in, empty if they are
+func (a *Access) Check(auth string, ip net.IP) string {
+	a.RLock()
+	defer a.RUnlock()
+
+	now := time.Now()
+	for i, ban := range a.list.Bans {
+		if ban.Expired(now) {
+			continue
+		}
+		if ban.Auth == auth || (a.ranges[i] != nil && a.ranges[i].Contains(ip)) {
+			return BanMessage(ban)
+		}
+	}
+
+	if a.allowlist && !slices.Contains(a.list.Allowed, auth) {
+		return "not on the allowlist"
+	}
+	return ""
+}
+
+// replaces any ban of the same player or address
+func (a *Access) Ban(ban Ban) error {
+	if ban.Target() == "" {
+		return errors.New("a ban needs an auth or an ip")
+	}
+	if ban.Ip != "" {
+		if _, err := parseIpRange(ban.Ip); err != nil {
+			return err
+		}
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	a.list.Bans = slices.DeleteFunc(a.list.Bans, func(existing Ban) bool {
+		return existing.Target() == ban.Target()
+	})
+	a.list.Bans = append(a.list.Bans, ban)
+	return a.save()
+}
+
+// lifts the ban of a player or address, the way it was banned
+func (a *Access) Unban(target string) (bool, error) {
+	a.Lock()
+	defer a.Unlock()
+	count := len(a.list.Bans)
+	a.list.Bans = slices.DeleteFunc(a.list.Bans, func(ban Ban) bool {
+		return ban.Target() == target
+	})
+	if len(a.list.Bans) == count {
+		return false, nil
+	}
+	return true, a.save()
+}
+
+// the bans which have not run out
+func (a *Access) Bans() []Ban {
+	a.RLock()
+	defer a.RUnlock()
+	now := time.Now()
+	bans := []Ban{}
+	for _, ban := range a.list.Bans {
+		if !ban.Expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	return bans
+}
+
+func (a *Access) Allow(auth string) error {
+	a.Lock()
+	defer a.Unlock()
+	if slices.Contains(a.list.Allowed, auth) {
+		return nil
+	}
+	a.list.Allowed = append(a.list.Allowed, auth)
+	return a.save()
+}
+
+func (a *Access) Disallow(auth string) (bool, error) {
+	a.Lock()
+	defer a.Unlock()
+	index := slices.Index(a.list.Allowed, auth)
+	if index == -1 {
+		return false, nil
+	}
+	a.list.Allowed = slices.Delete(a.list.Allowed, index, index+1)
+	return true, a.save()
+}
+
+func (a *Access) Allowed() []string {
+	a.RLock()
+	defer a.RUnlock()
+	return slices.Clone(a.list.Allowed)
+}
+
+func (a *Access) AllowlistOn() bool {
+	a.RLock()
+	defer a.RUnlock()
+	return a.allowlist
+}
+
+func (a *Access) SetAllowlist(on bool) {
+	a.Lock()
+	defer a.Unlock()
+	a.allowlist = on
+}
+
+// what a banned player is told
+func BanMessage(ban Ban) string {
+	msg := adminMessage("banned", ban.Reason)
+	if !ban.Expires.IsZero() {
+		msg = fmt.Sprintf("%s, until %s", msg, ban.Expires.Format(time.DateTime))
+	}
+	return msg
+}
+
+// removes the players who are no longer let in, after the list changed
+func (h *RoomHost) enforceAccess() {
+	for _, room := range h.rooms {
+		kicks := map[string]string{}
+		room.connected_players.RLock()
+		for auth, player := range room.connected_players.m {
+			if reason := h.access.Check(auth, player.addr.IP); reason != "" {
+				kicks[auth] = reason
+			}
+		}
+		room.connected_players.RUnlock()
+
+		for auth, reason := range kicks {
+			room.Kick(auth, reason)
+		}
+	}
+}
+
+// picks up changes made to the access file by hand until ctx is cancelled
+func (h *RoomHost) WatchAccess(ctx context.Context) {
+	ticker := time.NewTicker(ACCESS_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := h.access.reload()
+		if err != nil {
+			h.log.Error("keeping the old access list", shared.LogErr(err))
+			continue
+		}
+		if changed {
+			h.log.Info("access list changed, reloaded", "path", h.access.path)
+			h.enforceAccess()
+		}
+	}
+}
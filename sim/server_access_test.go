@@ -0,0 +1,163 @@
+package sim
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessCheck(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		bans      []Ban
+		allowed   []string
+		allowlist bool
+		auth      string
+		ip        string
+		// part of why they are turned away, empty if they are let in
+		reason string
+	}{
+		{"nobody banned", nil, nil, false, "a", "10.0.0.1", ""},
+		{"banned auth", []Ban{{Auth: "a", Reason: "cheating"}}, nil, false, "a", "10.0.0.1", "cheating"},
+		{"other auth banned", []Ban{{Auth: "b"}}, nil, false, "a", "10.0.0.1", ""},
+		{"banned ip", []Ban{{Ip: "10.0.0.1"}}, nil, false, "a", "10.0.0.1", "banned"},
+		{"other ip banned", []Ban{{Ip: "10.0.0.2"}}, nil, false, "a", "10.0.0.1", ""},
+		{"in banned range", []Ban{{Ip: "10.0.0.0/24"}}, nil, false, "a", "10.0.0.99", "banned"},
+		{"outside banned range", []Ban{{Ip: "10.0.0.0/24"}}, nil, false, "a", "10.0.1.1", ""},
+		{"in banned ipv6 range", []Ban{{Ip: "fd00::/8"}}, nil, false, "a", "fd12::1", "banned"},
+		{"ipv4 in ipv6 form", []Ban{{Ip: "10.0.0.1"}}, nil, false, "a", "::ffff:10.0.0.1", "banned"},
+		{"ban ran out", []Ban{{Auth: "a", Expires: past}}, nil, false, "a", "10.0.0.1", ""},
+		{"ban runs out later", []Ban{{Auth: "a", Expires: future}}, nil, false, "a", "10.0.0.1", "until"},
+		{"not on allowlist", nil, []string{"b"}, true, "a", "10.0.0.1", "allowlist"},
+		{"on allowlist", nil, []string{"a"}, true, "a", "10.0.0.1", ""},
+		{"allowlist off", nil, nil, false, "a", "10.0.0.1", ""},
+		{"banned on allowlist", []Ban{{Auth: "a"}}, []string{"a"}, true, "a", "10.0.0.1", "banned"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			access, _ := LoadAccess("", test.allowlist)
+			if err := access.set(AccessList{Bans: test.bans, Allowed: test.allowed}); err != nil {
+				t.Fatal(err)
+			}
+
+			reason := access.Check(test.auth, net.ParseIP(test.ip))
+			if test.reason == "" {
+				if reason != "" {
+					t.Fatalf("expected to be let in, got '%s'", reason)
+				}
+				return
+			}
+			if !strings.Contains(reason, test.reason) {
+				t.Fatalf("expected to be turned away for '%s', got '%s'", test.reason, reason)
+			}
+		})
+	}
+}
+
+func TestAccessBan(t *testing.T) {
+	access, _ := LoadAccess("", false)
+	tests := []struct {
+		name string
+		ban  Ban
+		ok   bool
+	}{
+		{"auth", Ban{Auth: "a"}, true},
+		{"ip", Ban{Ip: "10.0.0.1"}, true},
+		{"range", Ban{Ip: "10.0.0.0/24"}, true},
+		{"nobody", Ban{Reason: "no target"}, false},
+		{"bad ip", Ban{Ip: "10.0.0"}, false},
+		{"bad range", Ban{Ip: "10.0.0.0/40"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := access.Ban(test.ban)
+			if test.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !test.ok && err == nil {
+				t.Fatal("an invalid ban was accepted")
+			}
+		})
+	}
+
+	// banning again replaces the ban
+	access.Ban(Ban{Auth: "a", Reason: "again"})
+	if bans := access.Bans(); len(bans) != 3 || bans[2].Reason != "again" {
+		t.Fatalf("expected the ban to be replaced, got %+v", bans)
+	}
+	if ok, _ := access.Unban("10.0.0.0/24"); !ok {
+		t.Fatal("the range was not unbanned")
+	}
+	if ok, _ := access.Unban("10.0.0.0/24"); ok {
+		t.Fatal("unbanned twice")
+	}
+	if reason := access.Check("b", net.ParseIP("10.0.0.2")); reason != "" {
+		t.Fatalf("still banned after the range was lifted: %s", reason)
+	}
+}
+
+func TestAccessFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.json")
+
+	// the file does not have to exist yet
+	access, err := LoadAccess(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access.Ban(Ban{Auth: "a"})
+	access.Allow("b")
+
+	loaded, err := LoadAccess(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Check("a", nil) == "" || loaded.Check("b", nil) != "" || loaded.Check("c", nil) == "" {
+		t.Fatalf("the list was not read back: %+v", loaded.list)
+	}
+
+	// changed by hand
+	os.WriteFile(path, []byte(`{"Bans": [{"Ip": "10.0.0.0/8"}], "Allowed": ["a"]}`), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	changed, err := loaded.reload()
+	if err != nil || !changed {
+		t.Fatalf("the change was not picked up: %v", err)
+	}
+	if loaded.Check("a", net.ParseIP("192.168.0.1")) != "" || loaded.Check("a", net.ParseIP("10.1.2.3")) == "" {
+		t.Fatalf("the changed list is not used: %+v", loaded.list)
+	}
+	if changed, _ := loaded.reload(); changed {
+		t.Fatal("reloaded a file which did not change")
+	}
+
+	// a broken file keeps the list that was read last
+	for _, broken := range []string{`{"Bans": [{"Ip": "not an ip"}]}`, `{"Banned": []}`, `{`} {
+		os.WriteFile(path, []byte(broken), 0o644)
+		later = later.Add(time.Minute)
+		os.Chtimes(path, later, later)
+		if _, err := loaded.reload(); err == nil {
+			t.Fatalf("'%s' was read", broken)
+		}
+		if loaded.Check("a", net.ParseIP("10.1.2.3")) == "" {
+			t.Fatal("the last good list was dropped")
+		}
+	}
+
+	// bans which ran out are not written again
+	access, _ = LoadAccess(filepath.Join(t.TempDir(), "access.json"), false)
+	access.Ban(Ban{Auth: "a", Expires: time.Now().Add(-time.Hour)})
+	access.Ban(Ban{Auth: "b"})
+	if bans := access.Bans(); len(bans) != 1 || bans[0].Auth != "b" {
+		t.Fatalf("expected only the ban of b, got %+v", bans)
+	}
+	if len(access.list.Bans) != 1 {
+		t.Fatalf("a ban which ran out was kept: %+v", access.list.Bans)
+	}
+}
@@ -0,0 +1,660 @@
+package sim
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	crypto_rand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"io"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the port cmd/rcon connects to unless told otherwise
+	RCON_PORT = 7708
+	// rcon only listens on this machine unless told otherwise
+	RCON_HOST = "127.0.0.1"
+	// how long an rcon client has to prove it knows the password
+	RCON_AUTH_TIMEOUT = 10 * time.Second
+	// slows down guessing the rcon password
+	RCON_FAILURE_DELAY = time.Second
+	// wrong rcon passwords an address can send before it is turned away
+	RCON_MAX_FAILURES = 5
+	// how long a wrong rcon password is held against its address
+	RCON_FAILURE_WINDOW = 10 * time.Minute
+	// rcon connections an address can have open before sending the password
+	RCON_MAX_PENDING = 2
+
+	// how often players are pinged, in ticks at PHYSICS_TICK_RATE
+	PLAYER_PING_INTERVAL = 60
+
+	// what fits on a player's screen
+	MAX_SERVER_MESSAGE_LENGTH = 120
+)
+
+// what a player is told when turned away, with the reason if there is one
+func adminMessage(action, reason string) string {
+	if reason == "" {
+		return action
+	}
+	return fmt.Sprintf("%s: %s", action, reason)
+}
+
+func (s ServerGameStateEnum) String() string {
+	switch s {
+	case ServerGameStateWaitingInLobby:
+		return "lobby"
+	case ServerGameStatePlaying:
+		return "playing"
+	case ServerGameStateStartingNewMatch:
+		return "starting match"
+	case ServerGameStateStartingNewRound:
+		return "starting round"
+	case ServerGameStateGoingBackToLobby:
+		return "going back to lobby"
+	case ServerGameStateGameOver:
+		return "game over"
+	default:
+		return fmt.Sprintf("state %d", int(s))
+	}
+}
+
+// runs f on the room's game loop between two ticks and waits for it.
+// anything touching the state of a match goes through here
+func (s *Server) do(ctx context.Context, f func()) error {
+	done := make(chan struct{})
+	select {
+	case s.admin_channel <- func() { f(); close(done) }:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	<-done
+	return nil
+}
+
+// expects to be run on the game loop
+func (s *Server) setState(state ServerGameStateEnum) {
+	if s.state == state {
+		return
+	}
+	s.stateChanged(s.state, state)
+	s.state = state
+	s.Broadcast(shared.Packet{PacketType: shared.PacketTypeServerStateChanged}, state)
+}
+
+// removes auth from the room, telling them why
+func (s *Server) Kick(auth, reason string) bool {
+	s.connected_players.Lock()
+	player, ok := s.connected_players.m[auth]
+	delete(s.connected_players.m, auth)
+	s.connected_players.Unlock()
+	if !ok {
+		return false
+	}
+
+	s.sessions.Remove(auth, s.room)
+	s.playerLog(auth, player.player.Username).Info("kicked", "reason", reason)
+	s.SendTo(player.addr, shared.PacketTypeKicked, shared.RejectionData{Reason: reason})
+	return true
+}
+
+// moves the room to level, one of config.Maps.
+// a match being played goes on with a new round there,
+// otherwise the next match starts there.
+// expects to be run on the game loop
+func (s *Server) ChangeMap(level int) error {
+	index := slices.Index(s.config.Maps, level)
+	if index == -1 {
+		return fmt.Errorf("map %d is not in the map list %v", level, s.config.Maps)
+	}
+
+	switch s.state {
+	case ServerGameStatePlaying, ServerGameStateStartingNewRound:
+		s.current_level = index
+		s.bm.Reset()
+		s.announceNewRound("")
+		s.setState(ServerGameStateStartingNewRound)
+	default:
+		// starting a match moves on to the next map first
+		s.current_level = (index + len(s.levels) - 1) % len(s.levels)
+	}
+	return nil
+}
+
+// starts the current match over on the same map.
+// expects to be run on the game loop
+func (s *Server) RestartMatch() error {
+	if s.state == ServerGameStateWaitingInLobby {
+		return errors.New("no match is being played")
+	}
+
+	// starting a match moves on to the next map first,
+	// unless the match restarted has not done so yet
+	if s.state != ServerGameStateStartingNewMatch {
+		s.current_level = (s.current_level + len(s.levels) - 1) % len(s.levels)
+	}
+	s.wait_time = time.Now()
+	s.Broadcast(shared.Packet{PacketType: shared.PacketTypeNewMatch}, NewMatchEvent{Timestamp: time.Now()})
+	s.setState(ServerGameStateStartingNewMatch)
+	return nil
+}
+
+type AdminCommand struct {
+	Name  string
+	Usage string
+	Help  string
+
+	min_args int
+	run      func(h *RoomHost, ctx context.Context, args []string) (string, error)
+}
+
+var admin_commands = []AdminCommand{
+	{Name: "players", Usage: "players", Help: "list the players of every room with their ping", run: (*RoomHost).adminPlayers},
+	{Name: "kick", Usage: "kick <auth|name> [reason]", Help: "remove a player, auth can be shortened", min_args: 1, run: (*RoomHost).adminKick},
+	{Name: "ban", Usage: "ban <auth|ip> [duration] [reason]", Help: "keep a player or address range out, e.g. 'ban 10.0.0.0/24 24h spam'", min_args: 1, run: (*RoomHost).adminBan},
+	{Name: "unban", Usage: "unban <auth|ip>", Help: "lift a ban, written the way it was banned", min_args: 1, run: (*RoomHost).adminUnban},
+	{Name: "bans", Usage: "bans", Help: "list the bans that have not run out", run: (*RoomHost).adminBans},
+	{Name: "allow", Usage: "allow <auth>", Help: "put a player on the allowlist", min_args: 1, run: (*RoomHost).adminAllow},
+	{Name: "disallow", Usage: "disallow <auth>", Help: "take a player off the allowlist", min_args: 1, run: (*RoomHost).adminDisallow},
+	{Name: "allowlist", Usage: "allowlist [on|off]", Help: "show the allowlist, or only let players on it join", run: (*RoomHost).adminAllowlist},
+	{Name: "map", Usage: "map <map> [room]", Help: "switch to one of the maps in the map list", min_args: 1, run: (*RoomHost).adminMap},
+	{Name: "restart", Usage: "restart [room]", Help: "start the match over", run: (*RoomHost).adminRestart},
+	{Name: "wins", Usage: "wins <n>", Help: "set the round wins needed to win a match", min_args: 1, run: (*RoomHost).adminWins},
+	{Name: "say", Usage: "say <message>", Help: "show every player a message", min_args: 1, run: (*RoomHost).adminSay},
+	{Name: "accept", Usage: "accept [on|off]", Help: "let new players join or not, toggles without an argument", run: (*RoomHost).adminAccept},
+}
+
+// runs one admin command and returns what it has to say, see help
+func (h *RoomHost) Exec(ctx context.Context, line string) string {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return ""
+	}
+
+	if args[0] == "help" {
+		lines := []string{}
+		for _, command := range admin_commands {
+			lines = append(lines, fmt.Sprintf("%-34s %s", command.Usage, command.Help))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	for _, command := range admin_commands {
+		if command.Name != args[0] {
+			continue
+		}
+		if len(args)-1 < command.min_args {
+			return "usage: " + command.Usage
+		}
+		out, err := command.run(h, ctx, args[1:])
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		return out
+	}
+	return fmt.Sprintf("unknown command '%s', try help", args[0])
+}
+
+// the room and full auth of the player whose auth starts with prefix,
+// or who goes by it
+func (h *RoomHost) findPlayer(prefix string) (*Server, string, error) {
+	var room *Server
+	matches := []string{}
+	for _, r := range h.rooms {
+		r.connected_players.RLock()
+		for auth, player := range r.connected_players.m {
+			if strings.HasPrefix(auth, prefix) || strings.EqualFold(player.player.Username, prefix) {
+				room = r
+				matches = append(matches, auth)
+			}
+		}
+		r.connected_players.RUnlock()
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, "", fmt.Errorf("no player matches '%s'", prefix)
+	case 1:
+		return room, matches[0], nil
+	default:
+		return nil, "", fmt.Errorf("'%s' matches %d players", prefix, len(matches))
+	}
+}
+
+// the rooms a command is meant for, the one numbered args[i] or all of them
+func (h *RoomHost) roomsFrom(args []string, i int) ([]*Server, error) {
+	if len(args) <= i {
+		return h.rooms, nil
+	}
+	n, err := strconv.Atoi(args[i])
+	if err != nil || n < 1 || n > len(h.rooms) {
+		return nil, fmt.Errorf("there is no room '%s', rooms go from 1 to %d", args[i], len(h.rooms))
+	}
+	return h.rooms[n-1 : n], nil
+}
+
+func (h *RoomHost) adminPlayers(ctx context.Context, args []string) (string, error) {
+	lines := []string{}
+	for i, room := range h.rooms {
+		accepting := "accepting players"
+		if !room.accepts_new_connections.Load() {
+			accepting = "not accepting players"
+		}
+
+		var state ServerGameStateEnum
+		err := room.do(ctx, func() { state = room.state })
+		if err != nil {
+			return "", err
+		}
+
+		room.connected_players.RLock()
+		lines = append(lines, fmt.Sprintf("room %d '%s' %s, %d/%d players, %s",
+			i+1, room.Name, state, len(room.connected_players.m), room.config.Max_players, accepting))
+
+		auths := []string{}
+		for auth := range room.connected_players.m {
+			auths = append(auths, auth)
+		}
+		sort.Strings(auths)
+		for _, auth := range auths {
+			player := room.connected_players.m[auth]
+			ping := "?"
+			if player.ping > 0 {
+				ping = player.ping.Round(time.Millisecond).String()
+			}
+			status := ""
+			if player.spectating {
+				status = "spectating"
+			} else if NetBoolify(player.ready) {
+				status = "ready"
+			}
+			lines = append(lines, fmt.Sprintf("  %s  %-*s  ping %-6s %s", auth, shared.USERNAME_MAX_LENGTH, player.player.Username, ping, status))
+		}
+		room.connected_players.RUnlock()
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (h *RoomHost) adminKick(ctx context.Context, args []string) (string, error) {
+	room, auth, err := h.findPlayer(args[0])
+	if err != nil {
+		return "", err
+	}
+	room.Kick(auth, adminMessage("kicked", strings.Join(args[1:], " ")))
+	return "kicked " + auth, nil
+}
+
+// the full auth of a player, who has to be here unless given in full
+func (h *RoomHost) resolveAuth(prefix string) (string, error) {
+	_, auth, err := h.findPlayer(prefix)
+	if err != nil {
+		raw, hex_err := hex.DecodeString(prefix)
+		if hex_err != nil || len(raw) != 16 {
+			return "", err
+		}
+		auth = prefix
+	}
+	return auth, nil
+}
+
+func (h *RoomHost) adminBan(ctx context.Context, args []string) (string, error) {
+	ban := Ban{}
+	if _, err := parseIpRange(args[0]); err == nil {
+		ban.Ip = args[0]
+	} else {
+		auth, err := h.resolveAuth(args[0])
+		if err != nil {
+			return "", err
+		}
+		ban.Auth = auth
+	}
+
+	args = args[1:]
+	if len(args) > 0 {
+		duration, err := time.ParseDuration(args[0])
+		if err == nil {
+			if duration <= 0 {
+				return "", errors.New("a ban has to last for some time")
+			}
+			ban.Expires = time.Now().Add(duration)
+			args = args[1:]
+		}
+	}
+	ban.Reason = strings.Join(args, " ")
+
+	err := h.access.Ban(ban)
+	if err != nil {
+		return "", err
+	}
+	h.enforceAccess()
+	h.log.Info("banned", "target", ban.Target(), "reason", ban.Reason)
+	return "banned " + ban.Target(), nil
+}
+
+func (h *RoomHost) adminUnban(ctx context.Context, args []string) (string, error) {
+	ok, err := h.access.Unban(args[0])
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is not banned", args[0])
+	}
+	return "unbanned " + args[0], nil
+}
+
+func (h *RoomHost) adminBans(ctx context.Context, args []string) (string, error) {
+	lines := []string{}
+	for _, ban := range h.access.Bans() {
+		expires := "never expires"
+		if !ban.Expires.IsZero() {
+			expires = "until " + ban.Expires.Format(time.DateTime)
+		}
+		lines = append(lines, fmt.Sprintf("%-32s  %s  %s", ban.Target(), expires, ban.Reason))
+	}
+	if len(lines) == 0 {
+		return "nobody is banned", nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (h *RoomHost) adminAllow(ctx context.Context, args []string) (string, error) {
+	auth, err := h.resolveAuth(args[0])
+	if err != nil {
+		return "", err
+	}
+	err = h.access.Allow(auth)
+	if err != nil {
+		return "", err
+	}
+	return "allowed " + auth, nil
+}
+
+func (h *RoomHost) adminDisallow(ctx context.Context, args []string) (string, error) {
+	ok, err := h.access.Disallow(args[0])
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%s is not on the allowlist", args[0])
+	}
+	h.enforceAccess()
+	return "disallowed " + args[0], nil
+}
+
+func (h *RoomHost) adminAllowlist(ctx context.Context, args []string) (string, error) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "on":
+			h.access.SetAllowlist(true)
+			h.enforceAccess()
+		case "off":
+			h.access.SetAllowlist(false)
+		default:
+			return "", fmt.Errorf("expected on or off, not '%s'", args[0])
+		}
+	}
+
+	state := "off"
+	if h.access.AllowlistOn() {
+		state = "on"
+	}
+	allowed := h.access.Allowed()
+	if len(allowed) == 0 {
+		return fmt.Sprintf("allowlist is %s, nobody is on it", state), nil
+	}
+	return fmt.Sprintf("allowlist is %s:\n%s", state, strings.Join(allowed, "\n")), nil
+}
+
+func (h *RoomHost) adminMap(ctx context.Context, args []string) (string, error) {
+	level, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid map '%s'", args[0])
+	}
+	rooms, err := h.roomsFrom(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	for _, room := range rooms {
+		var map_err error
+		err := room.do(ctx, func() { map_err = room.ChangeMap(level) })
+		if err = errors.Join(err, map_err); err != nil {
+			return "", fmt.Errorf("'%s': %w", room.Name, err)
+		}
+	}
+	return fmt.Sprintf("switched to map %d", level), nil
+}
+
+func (h *RoomHost) adminRestart(ctx context.Context, args []string) (string, error) {
+	rooms, err := h.roomsFrom(args, 0)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+	for _, room := range rooms {
+		var restart_err error
+		err := room.do(ctx, func() { restart_err = room.RestartMatch() })
+		if err = errors.Join(err, restart_err); err != nil {
+			lines = append(lines, fmt.Sprintf("'%s': %s", room.Name, err))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("'%s': restarted", room.Name))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (h *RoomHost) adminWins(ctx context.Context, args []string) (string, error) {
+	wins, err := strconv.Atoi(args[0])
+	if err != nil || wins < 1 {
+		return "", fmt.Errorf("win threshold has to be at least 1, not '%s'", args[0])
+	}
+
+	for _, room := range h.rooms {
+		err := room.do(ctx, func() { room.config.Win_threshold = wins })
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("matches are won with %d rounds", wins), nil
+}
+
+func (h *RoomHost) adminSay(ctx context.Context, args []string) (string, error) {
+	message := strings.Join(args, " ")
+	if len(message) > MAX_SERVER_MESSAGE_LENGTH {
+		return "", fmt.Errorf("messages can be at most %d characters", MAX_SERVER_MESSAGE_LENGTH)
+	}
+
+	for _, room := range h.rooms {
+		room.Broadcast(shared.Packet{PacketType: shared.PacketTypeServerMessage}, shared.ServerMessageData{Message: message})
+	}
+	return "sent", nil
+}
+
+func (h *RoomHost) adminAccept(ctx context.Context, args []string) (string, error) {
+	accept := !h.rooms[0].accepts_new_connections.Load()
+	if len(args) > 0 {
+		switch args[0] {
+		case "on":
+			accept = true
+		case "off":
+			accept = false
+		default:
+			return "", fmt.Errorf("expected on or off, not '%s'", args[0])
+		}
+	}
+
+	for _, room := range h.rooms {
+		room.accepts_new_connections.Store(accept)
+	}
+	if accept {
+		return "accepting new players", nil
+	}
+	return "not accepting new players", nil
+}
+
+// reads commands from r until it runs out, answering on w
+func (h *RoomHost) Console(ctx context.Context, r io.Reader, w io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+		out := h.Exec(ctx, scanner.Text())
+		if out != "" {
+			fmt.Fprintln(w, out)
+		}
+	}
+}
+
+// answers remote admin connections until ctx is cancelled.
+// a connection starts with the line 'challenge <hex>', which is answered
+// with the hex of shared.PasswordProof for the password and an empty auth.
+// after 'ok' every line is a command, every answer ends with an empty line
+func (h *RoomHost) ServeRcon(ctx context.Context, listener net.Listener, password string) {
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+	failures := RconFailures{m: make(map[string]RconFailure)}
+
+	h.log.Info("rcon is listening", shared.LogAddr("addr", listener.Addr()))
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			h.log.Error("error accepting rcon connection", shared.LogErr(err))
+			continue
+		}
+		go h.handleRcon(ctx, conn, password, &failures)
+	}
+}
+
+type RconFailure struct {
+	// attempts held against the address, counted before the password is read
+	count int
+	last  time.Time
+	// connections which have not sent a password yet
+	pending int
+}
+
+// rcon attempts by the ip they came from, so guessing can not be
+// sped up by opening many connections at once
+type RconFailures struct {
+	sync.Mutex
+	m map[string]RconFailure
+}
+
+// counts an attempt by ip before its password is read, see Release.
+// returns why ip is turned away, empty if it may try
+func (f *RconFailures) Reserve(ip string, now time.Time) string {
+	f.Lock()
+	defer f.Unlock()
+	for key, failure := range f.m {
+		if failure.pending == 0 && now.Sub(failure.last) >= RCON_FAILURE_WINDOW {
+			delete(f.m, key)
+		}
+	}
+
+	failure := f.m[ip]
+	if failure.count >= RCON_MAX_FAILURES {
+		return "too many wrong passwords, try again later"
+	}
+	if failure.pending >= RCON_MAX_PENDING {
+		return "too many connections, try again later"
+	}
+	failure.count++
+	failure.pending++
+	failure.last = now
+	f.m[ip] = failure
+	return ""
+}
+
+// ends an attempt of Reserve, only a right password is not held against ip
+func (f *RconFailures) Release(ip string, right bool) {
+	f.Lock()
+	defer f.Unlock()
+	failure, ok := f.m[ip]
+	if !ok {
+		return
+	}
+	failure.pending--
+	if right {
+		failure.count--
+	}
+	f.m[ip] = failure
+}
+
+func (h *RoomHost) handleRcon(ctx context.Context, conn net.Conn, password string, failures *RconFailures) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	logger := h.log.With(shared.LOG_SESSION, conn.RemoteAddr().String())
+
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		ip = conn.RemoteAddr().String()
+	}
+	if reason := failures.Reserve(ip, time.Now()); reason != "" {
+		logger.Warn("rcon: turned away", "reason", reason)
+		fmt.Fprintln(conn, reason)
+		return
+	}
+	// a connection which never answers counts as a wrong password
+	right := false
+	defer func() {
+		if !right {
+			failures.Release(ip, false)
+		}
+	}()
+
+	challenge := make([]byte, 16)
+	_, err = crypto_rand.Read(challenge)
+	if err != nil {
+		logger.Error("error creating rcon challenge", shared.LogErr(err))
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(RCON_AUTH_TIMEOUT))
+	fmt.Fprintf(conn, "challenge %x\n", challenge)
+
+	scanner := bufio.NewScanner(conn)
+	if !scanner.Scan() {
+		return
+	}
+	proof, err := hex.DecodeString(strings.TrimSpace(scanner.Text()))
+	if err != nil || !hmac.Equal(proof, shared.PasswordProof(password, challenge, [16]byte{})) {
+		logger.Warn("rcon: wrong password")
+		time.Sleep(RCON_FAILURE_DELAY)
+		fmt.Fprintln(conn, "wrong password")
+		return
+	}
+	right = true
+	failures.Release(ip, true)
+	conn.SetDeadline(time.Time{})
+	fmt.Fprintln(conn, "ok")
+	logger.Info("rcon: admin connected")
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		logger.Info("rcon command", "command", line)
+		out := h.Exec(ctx, line)
+		if out != "" {
+			out += "\n"
+		}
+		_, err := fmt.Fprintf(conn, "%s\n", out)
+		if err != nil {
+			return
+		}
+	}
+}
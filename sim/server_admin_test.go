@@ -0,0 +1,175 @@
+package sim
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRconFailures(t *testing.T) {
+	failures := RconFailures{m: make(map[string]RconFailure)}
+	now := time.Now()
+
+	// a right password is not held against anyone
+	for range RCON_MAX_FAILURES {
+		if reason := failures.Reserve("10.0.0.1", now); reason != "" {
+			t.Fatal(reason)
+		}
+		failures.Release("10.0.0.1", true)
+	}
+
+	for range RCON_MAX_FAILURES {
+		if reason := failures.Reserve("10.0.0.1", now); reason != "" {
+			t.Fatalf("turned away before the last allowed failure: %s", reason)
+		}
+		failures.Release("10.0.0.1", false)
+	}
+	if failures.Reserve("10.0.0.1", now) == "" {
+		t.Fatal("not turned away after too many failures")
+	}
+	if failures.Reserve("10.0.0.2", now) != "" {
+		t.Fatal("another address was turned away")
+	}
+	failures.Release("10.0.0.2", false)
+
+	later := now.Add(RCON_FAILURE_WINDOW)
+	if failures.Reserve("10.0.0.3", later) != "" {
+		t.Fatal("another address was turned away")
+	}
+	if _, ok := failures.m["10.0.0.1"]; ok {
+		t.Fatal("failures that ran out were kept")
+	}
+	if failures.Reserve("10.0.0.1", later) != "" {
+		t.Fatal("still turned away after the failures ran out")
+	}
+}
+
+func TestRconCapsPendingConnections(t *testing.T) {
+	failures := RconFailures{m: make(map[string]RconFailure)}
+	now := time.Now()
+
+	for range RCON_MAX_PENDING {
+		if reason := failures.Reserve("10.0.0.1", now); reason != "" {
+			t.Fatal(reason)
+		}
+	}
+	if reason := failures.Reserve("10.0.0.1", now); !strings.Contains(reason, "connections") {
+		t.Fatalf("expected too many connections, got '%s'", reason)
+	}
+	failures.Release("10.0.0.1", true)
+	if reason := failures.Reserve("10.0.0.1", now); reason != "" {
+		t.Fatalf("a finished connection still counts: %s", reason)
+	}
+}
+
+func TestRconTurnsAwayGuessers(t *testing.T) {
+	host := newTestHost(t, 1)
+	failures := RconFailures{m: make(map[string]RconFailure)}
+	client, server := net.Pipe()
+	defer client.Close()
+	// a pipe has no port to split off
+	for range RCON_MAX_FAILURES {
+		failures.Reserve(server.RemoteAddr().String(), time.Now())
+		failures.Release(server.RemoteAddr().String(), false)
+	}
+
+	go host.handleRcon(context.Background(), server, "secret", &failures)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(line, "too many wrong passwords") {
+		t.Fatalf("expected to be turned away, got '%s'", strings.TrimSpace(line))
+	}
+}
+
+func TestRconParallelGuesses(t *testing.T) {
+	host := newTestHost(t, 1)
+	failures := RconFailures{m: make(map[string]RconFailure)}
+
+	// every pipe has the same address, they all guess until turned away
+	// for their wrong passwords
+	var evaluated, pending, most_pending atomic.Int32
+	var wg sync.WaitGroup
+	for range 4 * RCON_MAX_FAILURES {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				client, server := net.Pipe()
+				go host.handleRcon(context.Background(), server, "secret", &failures)
+				client.SetDeadline(time.Now().Add(5 * time.Second))
+				reader := bufio.NewReader(client)
+				line, err := reader.ReadString('\n')
+				if err != nil || strings.HasPrefix(line, "too many wrong passwords") {
+					client.Close()
+					return
+				}
+				if !strings.HasPrefix(line, "challenge") {
+					client.Close()
+					time.Sleep(10 * time.Millisecond)
+					continue
+				}
+
+				now := pending.Add(1)
+				for {
+					most := most_pending.Load()
+					if now <= most || most_pending.CompareAndSwap(most, now) {
+						break
+					}
+				}
+				fmt.Fprintln(client, "00")
+				line, _ = reader.ReadString('\n')
+				pending.Add(-1)
+				client.Close()
+				if strings.HasPrefix(line, "wrong password") {
+					evaluated.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := evaluated.Load(); n != RCON_MAX_FAILURES {
+		t.Fatalf("%d guesses were evaluated, the limit is %d", n, RCON_MAX_FAILURES)
+	}
+	if n := most_pending.Load(); n > RCON_MAX_PENDING {
+		t.Fatalf("%d connections were waiting for a password at once, the limit is %d", n, RCON_MAX_PENDING)
+	}
+}
+
+func TestRestartMatch(t *testing.T) {
+	host := newTestHost(t, 1)
+	room := host.rooms[0]
+	room.levels = make([]Level, 3)
+	room.config.Maps = []int{1, 2, 3}
+
+	room.state = ServerGameStateWaitingInLobby
+	if room.RestartMatch() == nil {
+		t.Fatal("restarted a match in the lobby")
+	}
+
+	// a match being played started on the current map,
+	// starting the next one moves on to the map after it first
+	room.state = ServerGameStatePlaying
+	room.current_level = 1
+	room.RestartMatch()
+	if room.state != ServerGameStateStartingNewMatch {
+		t.Fatal("restarting did not start a new match")
+	}
+
+	// restarting again before the match started
+	room.RestartMatch()
+	room.RestartMatch()
+	room.DetermineNextLevel()
+	if room.current_level != 1 {
+		t.Fatalf("restarted on map %d instead of 2", room.current_level+1)
+	}
+}
@@ -0,0 +1,253 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// the rate movement and bullet speeds are written for, clients run one
+// physics tick per frame at ebiten's default of 60 frames per second.
+// intervals counted in ticks, like UPDATE_INTERVAL, are written for it too
+const PHYSICS_TICK_RATE = 60
+
+// the tick rates a server can run at, those dividing PHYSICS_TICK_RATE
+var TICK_RATES = []int{10, 12, 15, 20, 30, 60}
+
+// how often servers send players the state of the game by default
+const DEFAULT_SEND_RATE = PHYSICS_TICK_RATE / UPDATE_INTERVAL
+
+// everything a server can be started with, read from a json file and flags,
+// see cmd/server.
+// field names double as the keys of the file
+type ServerConfig struct {
+	Name string
+	Port int
+	// 'host' or 'host:port', see ParseMediatorAddrs
+	Mediators []string
+
+	// players have to prove they know the password before joining
+	// empty means anyone can join
+	Password string
+	// private servers are not listed by the mediator, but can still be joined by name
+	Private bool
+
+	Max_players   int
+	Win_threshold int
+
+	New_level_interval_s  int
+	Game_over_interval_s  int
+	State_change_grace_ms int
+
+	// server simulation ticks per second, one of TICK_RATES.
+	// bullets move the same distance per second at any rate,
+	// see BulletManager.Update
+	Tick_rate int
+	// how often per second players are sent the state of the game,
+	// at most once per tick
+	Send_rate int
+
+	// the levels played in order, numbered from 1 like the files in assets/tiled
+	Maps []int
+
+	// independent matches hosted on the same port, each listed separately.
+	// mediators only list so many servers per ip, see mediator.Options
+	Rooms int
+
+	// read admin commands from stdin, see RoomHost.Exec
+	Console bool
+	// tcp port for remote admin commands, 0 turns them off.
+	// connecting needs Rcon_password, see cmd/rcon
+	Rcon_port     int
+	Rcon_password string
+	// the address rcon listens on, only this machine by default.
+	// empty listens on every interface
+	Rcon_host string
+
+	// json file the bans and allowlist are kept in, see AccessList.
+	// empty keeps them in memory until the server stops
+	Access_file string
+	// only players on the allowlist can join
+	Allowlist bool
+
+	// where players and match results are kept, STATS_STORE_MEMORY
+	// until the server stops or STATS_STORE_SQLITE in Stats_path
+	Stats_store string
+	Stats_path  string
+
+	// tcp port serving /metrics for prometheus, 0 turns it off.
+	// anyone who can reach it can read it, see RoomHost.WriteMetrics
+	Metrics_port int
+
+	// debug, info, warn or error, see shared.SetupLogging
+	Log_level string
+	// json lines instead of key=value pairs
+	Log_json bool
+
+	// directory every match is recorded to, see Replays and cmd/replay.
+	// empty turns recording off
+	Replay_dir string
+	// a replay growing past this many kilobytes goes on in a new file.
+	// only what gzip has flushed is counted, so files end up somewhat larger
+	Replay_max_kb int
+	// only the newest replays are kept, older ones are removed
+	Replay_max_files int
+}
+
+func DefaultServerConfig() ServerConfig {
+	config := ServerConfig{
+		Name:      CreateServerName(),
+		Port:      SERVERPORT,
+		Mediators: []string{MEDIATOR_ADDR},
+
+		Max_players:   4,
+		Win_threshold: WIN_THRESHOLD,
+
+		New_level_interval_s:  NEW_LEVEL_INTERVAL_S,
+		Game_over_interval_s:  GAME_OVER_INTERVAL_S,
+		State_change_grace_ms: STATE_CHANGE_GRACE_MS,
+
+		Tick_rate: PHYSICS_TICK_RATE,
+		Send_rate: DEFAULT_SEND_RATE,
+
+		Rooms: 1,
+
+		Rcon_host: RCON_HOST,
+
+		Stats_store: STATS_STORE_MEMORY,
+
+		Log_level: shared.DEFAULT_LOG_LEVEL,
+
+		Replay_max_kb:    REPLAY_MAX_KB,
+		Replay_max_files: REPLAY_MAX_FILES,
+	}
+	for i := range LEVEL_COUNT {
+		config.Maps = append(config.Maps, i+1)
+	}
+	return config
+}
+
+// LoadServerConfig reads the config at path.
+// anything the file leaves out keeps its default
+func LoadServerConfig(path string) (ServerConfig, error) {
+	config := DefaultServerConfig()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	// a misspelled key would otherwise silently be the default
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&config)
+	if err != nil {
+		return config, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return config, nil
+}
+
+func (c ServerConfig) Validate() error {
+	errs := []error{}
+	if c.Name == "" {
+		errs = append(errs, errors.New("name can not be empty"))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is out of range", c.Port))
+	}
+	if _, err := ParseMediatorAddrs(c.mediatorList()); err != nil {
+		errs = append(errs, fmt.Errorf("mediators: %w", err))
+	}
+	if c.Max_players < 2 {
+		errs = append(errs, errors.New("max players has to be at least 2"))
+	}
+	if c.Win_threshold < 1 {
+		errs = append(errs, errors.New("win threshold has to be at least 1"))
+	}
+	if c.New_level_interval_s < 0 || c.Game_over_interval_s < 0 || c.State_change_grace_ms < 0 {
+		errs = append(errs, errors.New("intervals can not be negative"))
+	}
+	if c.Tick_rate < 10 || c.Tick_rate > PHYSICS_TICK_RATE || PHYSICS_TICK_RATE%c.Tick_rate != 0 {
+		errs = append(errs, fmt.Errorf("tick rate %d has to be one of %v, every tick simulates a whole number of physics ticks", c.Tick_rate, TICK_RATES))
+	}
+	if c.Send_rate < 1 || c.Send_rate > c.Tick_rate {
+		errs = append(errs, fmt.Errorf("send rate %d is not between 1 and the tick rate", c.Send_rate))
+	}
+	if len(c.Maps) == 0 {
+		errs = append(errs, errors.New("at least one map is needed"))
+	}
+	for _, level := range c.Maps {
+		if level < 1 || level > LEVEL_COUNT {
+			errs = append(errs, fmt.Errorf("there is no map %d, maps go from 1 to %d", level, LEVEL_COUNT))
+		}
+	}
+	if c.Rooms < 1 {
+		errs = append(errs, errors.New("at least one room is needed"))
+	}
+	if c.Rcon_port < 0 || c.Rcon_port > 65535 {
+		errs = append(errs, fmt.Errorf("rcon port %d is out of range", c.Rcon_port))
+	}
+	if c.Metrics_port < 0 || c.Metrics_port > 65535 {
+		errs = append(errs, fmt.Errorf("metrics port %d is out of range", c.Metrics_port))
+	}
+	if c.Rcon_host != "" && net.ParseIP(c.Rcon_host) == nil {
+		errs = append(errs, fmt.Errorf("rcon host '%s' is not an ip address", c.Rcon_host))
+	}
+	if c.Rcon_port != 0 && c.Rcon_password == "" {
+		errs = append(errs, errors.New("rcon needs a password"))
+	}
+	if _, err := shared.ParseLogLevel(c.Log_level); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.Stats_store {
+	case STATS_STORE_MEMORY:
+		if c.Stats_path != "" {
+			errs = append(errs, errors.New("a stats path needs the sqlite stats store"))
+		}
+	case STATS_STORE_SQLITE:
+		if c.Stats_path == "" {
+			errs = append(errs, errors.New("the sqlite stats store needs a path"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown stats store '%s', use %s or %s", c.Stats_store, STATS_STORE_MEMORY, STATS_STORE_SQLITE))
+	}
+	if c.Replay_dir != "" {
+		if c.Replay_max_kb < 1 {
+			errs = append(errs, fmt.Errorf("replays need to be allowed at least 1 kilobyte, not %d", c.Replay_max_kb))
+		}
+		if c.Replay_max_files < 1 {
+			errs = append(errs, fmt.Errorf("at least 1 replay has to be kept, not %d", c.Replay_max_files))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c ServerConfig) mediatorList() string {
+	return strings.Join(c.Mediators, ",")
+}
+
+// scales an interval counted in ticks at PHYSICS_TICK_RATE to the configured rate
+func (c ServerConfig) ticks(interval int) uint64 {
+	return uint64(max(1, interval*c.Tick_rate/PHYSICS_TICK_RATE))
+}
+
+// ticks between two sends to players
+func (c ServerConfig) sendInterval() uint64 {
+	return uint64(max(1, c.Tick_rate/c.Send_rate))
+}
+
+// physics ticks that pass in one server tick
+func (c ServerConfig) physicsStep() int {
+	return PHYSICS_TICK_RATE / c.Tick_rate
+}
+
+// the time one server tick has
+func (c ServerConfig) tickDuration() time.Duration {
+	return time.Second / time.Duration(c.Tick_rate)
+}
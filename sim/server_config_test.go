@@ -0,0 +1,114 @@
+package sim
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultServerConfigIsValid(t *testing.T) {
+	err := DefaultServerConfig().Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *ServerConfig)
+		// part of the error, empty if the config is valid
+		err string
+	}{
+		{"no name", func(c *ServerConfig) { c.Name = "" }, "name"},
+		{"port 0", func(c *ServerConfig) { c.Port = 0 }, "port 0"},
+		{"port too high", func(c *ServerConfig) { c.Port = 70000 }, "port 70000"},
+		{"bad mediator", func(c *ServerConfig) { c.Mediators = []string{"host:notaport"} }, "mediators"},
+		{"no mediators", func(c *ServerConfig) { c.Mediators = nil }, "no mediator given"},
+		{"one player", func(c *ServerConfig) { c.Max_players = 1 }, "max players"},
+		{"no wins needed", func(c *ServerConfig) { c.Win_threshold = 0 }, "win threshold"},
+		{"negative interval", func(c *ServerConfig) { c.Game_over_interval_s = -1 }, "negative"},
+		{"no wait between rounds", func(c *ServerConfig) { c.New_level_interval_s = 0 }, ""},
+		{"tick rate too low", func(c *ServerConfig) { c.Tick_rate = 5 }, "tick rate"},
+		{"tick rate too high", func(c *ServerConfig) { c.Tick_rate = 120 }, "tick rate"},
+		{"tick rate not dividing physics", func(c *ServerConfig) { c.Tick_rate = 25 }, "tick rate 25"},
+		{"slow tick rate", func(c *ServerConfig) { c.Tick_rate = 20; c.Send_rate = 20 }, ""},
+		{"send rate above tick rate", func(c *ServerConfig) { c.Send_rate = c.Tick_rate + 1 }, "send rate"},
+		{"no send rate", func(c *ServerConfig) { c.Send_rate = 0 }, "send rate"},
+		{"no maps", func(c *ServerConfig) { c.Maps = nil }, "at least one map"},
+		{"unknown map", func(c *ServerConfig) { c.Maps = []int{1, LEVEL_COUNT + 1} }, "no map"},
+		{"no rooms", func(c *ServerConfig) { c.Rooms = 0 }, "room"},
+		{"rcon without password", func(c *ServerConfig) { c.Rcon_port = RCON_PORT }, "rcon needs a password"},
+		{"rcon with password", func(c *ServerConfig) { c.Rcon_port = RCON_PORT; c.Rcon_password = "secret" }, ""},
+		{"metrics port out of range", func(c *ServerConfig) { c.Metrics_port = -1 }, "metrics port"},
+		{"unknown log level", func(c *ServerConfig) { c.Log_level = "loud" }, "log level"},
+		{"unknown stats store", func(c *ServerConfig) { c.Stats_store = "paper" }, "stats store"},
+		{"sqlite without path", func(c *ServerConfig) { c.Stats_store = STATS_STORE_SQLITE }, "needs a path"},
+		{"path without sqlite", func(c *ServerConfig) { c.Stats_path = "stats.db" }, "needs the sqlite"},
+		{"sqlite with path", func(c *ServerConfig) { c.Stats_store = STATS_STORE_SQLITE; c.Stats_path = "stats.db" }, ""},
+		{"empty replays", func(c *ServerConfig) { c.Replay_dir = "replays"; c.Replay_max_kb = 0 }, "kilobyte"},
+		{"no replays kept", func(c *ServerConfig) { c.Replay_dir = "replays"; c.Replay_max_files = 0 }, "replay"},
+		{"replay limits unused", func(c *ServerConfig) { c.Replay_max_kb = 0 }, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultServerConfig()
+			test.change(&config)
+			err := config.Validate()
+
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("expected a valid config, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error about '%s'", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected an error about '%s', got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestServerConfigValidateReportsEverything(t *testing.T) {
+	config := DefaultServerConfig()
+	config.Name = ""
+	config.Port = 0
+	config.Rooms = 0
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected an invalid config")
+	}
+	if lines := strings.Count(err.Error(), "\n") + 1; lines != 3 {
+		t.Fatalf("expected all 3 problems to be reported, got:\n%v", err)
+	}
+}
+
+func TestLoadServerConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "server.json")
+	os.WriteFile(path, []byte(`{"Name": "from file", "Maps": [2]}`), 0o644)
+	config, err := LoadServerConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "from file" || len(config.Maps) != 1 || config.Maps[0] != 2 {
+		t.Fatalf("file was not read: %+v", config)
+	}
+	if config.Port != SERVERPORT || config.Tick_rate != PHYSICS_TICK_RATE {
+		t.Fatal("what the file leaves out should keep its default")
+	}
+
+	misspelled := filepath.Join(dir, "misspelled.json")
+	os.WriteFile(misspelled, []byte(`{"Max_player": 8}`), 0o644)
+	_, err = LoadServerConfig(misspelled)
+	if err == nil {
+		t.Fatal("an unknown key was accepted")
+	}
+}
@@ -0,0 +1,90 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"gotanks/shared"
+	"sync"
+	"time"
+)
+
+const (
+	// players asked for, fewer are sent if they do not fit the query
+	LEADERBOARD_SIZE = 10
+	// anyone can ask, so answers come from a copy read this often,
+	// see RoomHost.RefreshLeaderboard
+	LEADERBOARD_REFRESH_INTERVAL = 10 * time.Second
+)
+
+type LeaderboardCache struct {
+	sync.Mutex
+	entries []shared.LeaderboardEntry
+}
+
+// the best players of every room as last read from the store
+func (h *RoomHost) Leaderboard() []shared.LeaderboardEntry {
+	h.leaderboard.Lock()
+	defer h.leaderboard.Unlock()
+	return h.leaderboard.entries
+}
+
+// reads the leaderboard from the store every LEADERBOARD_REFRESH_INTERVAL
+// until ctx is cancelled, so answering it never waits for the store
+func (h *RoomHost) RefreshLeaderboard(ctx context.Context) {
+	ticker := time.NewTicker(LEADERBOARD_REFRESH_INTERVAL)
+	defer ticker.Stop()
+	for {
+		entries, err := h.stats.Leaderboard(LEADERBOARD_SIZE)
+		if err != nil {
+			h.log.Error("keeping the old leaderboard", shared.LogErr(err))
+		} else {
+			h.leaderboard.Lock()
+			h.leaderboard.entries = entries
+			h.leaderboard.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// the most entries whose reply fits in size bytes
+func fitLeaderboard(entries []shared.LeaderboardEntry, size int) shared.Leaderboard {
+	board := shared.Leaderboard{}
+	for end := 1; end <= len(entries); end++ {
+		candidate := shared.Leaderboard{Entries: entries[:end]}
+		serialized_packet, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeLeaderboard}, [16]byte{}, candidate)
+		if err != nil || len(serialized_packet) > size {
+			break
+		}
+		board = candidate
+	}
+	return board
+}
+
+// answers a LeaderboardQuery, which like a ping needs no authorization.
+// the reply is never larger than the query, see mediator.reply
+func (h *RoomHost) answerLeaderboard(packet_data shared.PacketData) {
+	var query shared.LeaderboardQuery
+	err := gob.NewDecoder(bytes.NewReader(packet_data.Data)).Decode(&query)
+	if err != nil {
+		h.log.Warn("error decoding leaderboard query", shared.LogAddr("addr", &packet_data.Addr), shared.LogErr(err))
+		h.metrics.DecodeError(shared.PacketTypeLeaderboard)
+		return
+	}
+
+	board := fitLeaderboard(h.Leaderboard(), int(packet_data.Packet.TotalSize))
+	raw_data, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeLeaderboard}, [16]byte{}, board)
+	if err != nil {
+		h.log.Error("error serializing leaderboard", shared.LogErr(err))
+		return
+	}
+	_, err = h.conn.WriteToUDP(raw_data, &packet_data.Addr)
+	if err == nil {
+		h.metrics.Sent(shared.PacketTypeLeaderboard, len(raw_data))
+	}
+}
@@ -0,0 +1,62 @@
+package sim
+
+import (
+	"context"
+	"gotanks/shared"
+	"net"
+	"testing"
+)
+
+// counts how often the leaderboard was read
+type countingStats struct {
+	*MemoryStats
+	reads int
+}
+
+func (s *countingStats) Leaderboard(limit int) ([]shared.LeaderboardEntry, error) {
+	s.reads++
+	return s.MemoryStats.Leaderboard(limit)
+}
+
+func TestLeaderboardIsAnsweredFromCache(t *testing.T) {
+	store := &countingStats{MemoryStats: NewMemoryStats()}
+	playMatch(t, store, NewPlayer("a", "first"), INITIAL_RATING+10, true)
+	host := newTestHost(t, 1)
+	host.stats = store
+
+	if len(host.Leaderboard()) != 0 {
+		t.Fatal("the leaderboard was read before it was refreshed")
+	}
+
+	// refreshes once, then stops
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	host.RefreshLeaderboard(ctx)
+	if store.reads != 1 {
+		t.Fatalf("expected one read, got %d", store.reads)
+	}
+
+	for range 10 {
+		host.answerLeaderboard(leaderboardQuery(t))
+	}
+	board := host.Leaderboard()
+	if len(board) != 1 || board[0].Username != "first" {
+		t.Fatalf("unexpected leaderboard %+v", board)
+	}
+	if store.reads != 1 {
+		t.Fatalf("answering read the store %d more times", store.reads-1)
+	}
+}
+
+func leaderboardQuery(t *testing.T) shared.PacketData {
+	t.Helper()
+	raw, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeLeaderboard}, [16]byte{}, shared.LeaderboardQuery{Padding: make([]byte, shared.QUERY_PADDING)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, data, err := shared.DeserializePacket(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shared.PacketData{Packet: packet, Data: data, Addr: net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 7707}}
+}
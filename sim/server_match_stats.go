@@ -0,0 +1,139 @@
+package sim
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// what a player did during one match, sent to everyone when it ends
+type PlayerMatchStats struct {
+	Player_ID string
+	Name      string
+
+	Rounds_played int
+	Rounds_won    int
+	Kills         int
+	Deaths        int
+	Shots         int
+	// times their bullets bounced off a wall and kept going
+	Bounces int
+}
+
+// the share of shots which hit another player, one hit is a kill
+func (p PlayerMatchStats) Accuracy() float64 {
+	if p.Shots == 0 {
+		return 0
+	}
+	return float64(p.Kills) / float64(p.Shots)
+}
+
+// sent with PacketTypeGameOver, clients which only know NewRoundEvent can
+// still read everything but the scoreboard
+type GameOverEvent struct {
+	Timestamp  time.Time
+	Level      LevelEnum
+	Winner     string
+	Scoreboard []PlayerMatchStats
+}
+
+// per player totals of the current match.
+// shots arrive with packets while the rest is counted between ticks.
+// kills and deaths are not counted, they come from the match's kill events
+type MatchStats struct {
+	sync.Mutex
+	m     map[string]*PlayerMatchStats
+	kills []KillEvent
+}
+
+func (ms *MatchStats) Reset() {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.m = make(map[string]*PlayerMatchStats)
+	ms.kills = nil
+}
+
+// expects ms to be locked
+func (ms *MatchStats) player(id string) *PlayerMatchStats {
+	if ms.m == nil {
+		ms.m = make(map[string]*PlayerMatchStats)
+	}
+	stats, ok := ms.m[id]
+	if !ok {
+		stats = &PlayerMatchStats{Player_ID: id}
+		ms.m[id] = stats
+	}
+	return stats
+}
+
+// changes the stats of player id, who is added if they are new
+func (ms *MatchStats) Add(id string, change func(stats *PlayerMatchStats)) {
+	if id == "" {
+		return
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	change(ms.player(id))
+}
+
+// records a kill of this match, the killer and victim are added if they are new
+func (ms *MatchStats) Kill(event KillEvent) {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.player(event.Victim_ID)
+	if event.Killer_ID != "" {
+		ms.player(event.Killer_ID)
+	}
+	ms.kills = append(ms.kills, event)
+}
+
+// everyone who played a round, they are rated even if they left
+func (ms *MatchStats) Participants() []string {
+	ms.Lock()
+	defer ms.Unlock()
+	participants := []string{}
+	for id, stats := range ms.m {
+		if stats.Rounds_played > 0 {
+			participants = append(participants, id)
+		}
+	}
+	return participants
+}
+
+// the players who played a round, best first
+func (ms *MatchStats) Scoreboard() []PlayerMatchStats {
+	ms.Lock()
+	defer ms.Unlock()
+	kills := map[string]int{}
+	deaths := map[string]int{}
+	for _, event := range ms.kills {
+		deaths[event.Victim_ID]++
+		// shooting yourself is only a death
+		if event.Killer_ID != event.Victim_ID {
+			kills[event.Killer_ID]++
+		}
+	}
+
+	board := []PlayerMatchStats{}
+	for id, stats := range ms.m {
+		if stats.Rounds_played > 0 {
+			row := *stats
+			row.Kills = kills[id]
+			row.Deaths = deaths[id]
+			board = append(board, row)
+		}
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].Rounds_won != board[j].Rounds_won {
+			return board[i].Rounds_won > board[j].Rounds_won
+		}
+		if board[i].Kills != board[j].Kills {
+			return board[i].Kills > board[j].Kills
+		}
+		if board[i].Deaths != board[j].Deaths {
+			return board[i].Deaths < board[j].Deaths
+		}
+		return board[i].Player_ID < board[j].Player_ID
+	})
+	return board
+}
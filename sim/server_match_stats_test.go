@@ -0,0 +1,81 @@
+package sim
+
+import (
+	"context"
+	"gotanks/shared"
+	"testing"
+	"time"
+)
+
+func TestScoreboardCountsKillEvents(t *testing.T) {
+	stats := MatchStats{}
+	stats.Reset()
+	for _, id := range []string{"a", "b", "c"} {
+		stats.Add(id, func(stats *PlayerMatchStats) {
+			stats.Rounds_played = 1
+			stats.Shots = 4
+		})
+	}
+	stats.Kill(NewKillEvent("round", "b", "a"))
+	stats.Kill(NewKillEvent("round", "c", "a"))
+	// shooting yourself is only a death
+	stats.Kill(NewKillEvent("round", "a", "a"))
+
+	board := map[string]PlayerMatchStats{}
+	for _, row := range stats.Scoreboard() {
+		board[row.Player_ID] = row
+	}
+	tests := []struct {
+		id       string
+		kills    int
+		deaths   int
+		accuracy float64
+	}{
+		{"a", 2, 1, 0.5},
+		{"b", 0, 1, 0},
+		{"c", 0, 1, 0},
+	}
+	for _, test := range tests {
+		row := board[test.id]
+		if row.Kills != test.kills || row.Deaths != test.deaths || row.Accuracy() != test.accuracy {
+			t.Errorf("%s: expected %d kills, %d deaths and %v accuracy, got %+v", test.id, test.kills, test.deaths, test.accuracy, row)
+		}
+	}
+
+	stats.Reset()
+	stats.Add("a", func(stats *PlayerMatchStats) { stats.Rounds_played = 1 })
+	if board := stats.Scoreboard(); board[0].Kills != 0 || board[0].Deaths != 0 {
+		t.Fatal("kills of the last match were kept")
+	}
+}
+
+func TestShotsAreCountedWhileTheLoopRuns(t *testing.T) {
+	host := newTestHost(t, 1)
+	room := host.rooms[0]
+	room.levels = make([]Level, 1)
+	room.state = ServerGameStatePlaying
+	room.publish()
+	room.match_stats.Reset()
+
+	player := newTestPlayer(t, 1)
+	room.connected_players.m[player.key()] = ConnectedPlayer{player: NewPlayer(player.key(), "shooter")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		room.StartServerLogic(ctx)
+		close(done)
+	}()
+	for range 10 {
+		room.handle(player.packet(t, shared.PacketTypeBulletShoot, StandardBullet{}))
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	shots := 0
+	room.match_stats.Add(player.key(), func(stats *PlayerMatchStats) { shots = stats.Shots })
+	if shots != 10 {
+		t.Fatalf("expected 10 shots, counted %d", shots)
+	}
+}
@@ -0,0 +1,234 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// traffic of one packet type in one direction
+type PacketCounts struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+type stateTransition struct {
+	room     int
+	from, to ServerGameStateEnum
+}
+
+// counters shared by every room of a server, served in the prometheus text
+// format when ServerConfig.Metrics_port is set.
+// what can be read off the rooms at any time, like the players connected,
+// is not counted but looked at when asked for, see RoomHost.WriteMetrics
+type Metrics struct {
+	sync.Mutex
+	// keyed by shared.PacketType.String, which all unknown types share
+	received      map[string]*PacketCounts
+	sent          map[string]*PacketCounts
+	decode_errors map[string]uint64
+	rounds        map[int]uint64
+	transitions   map[stateTransition]uint64
+}
+
+func (m *Metrics) count(counts *map[string]*PacketCounts, packet_type shared.PacketType, n int) {
+	m.Lock()
+	defer m.Unlock()
+	if *counts == nil {
+		*counts = make(map[string]*PacketCounts)
+	}
+	c, ok := (*counts)[packet_type.String()]
+	if !ok {
+		c = &PacketCounts{}
+		(*counts)[packet_type.String()] = c
+	}
+	c.Packets++
+	c.Bytes += uint64(n)
+}
+
+func (m *Metrics) Received(packet_type shared.PacketType, n int) {
+	m.count(&m.received, packet_type, n)
+}
+
+func (m *Metrics) Sent(packet_type shared.PacketType, n int) {
+	m.count(&m.sent, packet_type, n)
+}
+
+// a packet of packet_type that could not be read and was dropped
+func (m *Metrics) DecodeError(packet_type shared.PacketType) {
+	m.Lock()
+	defer m.Unlock()
+	if m.decode_errors == nil {
+		m.decode_errors = make(map[string]uint64)
+	}
+	m.decode_errors[packet_type.String()]++
+}
+
+func (m *Metrics) RoundPlayed(room int) {
+	m.Lock()
+	defer m.Unlock()
+	if m.rounds == nil {
+		m.rounds = make(map[int]uint64)
+	}
+	m.rounds[room]++
+}
+
+func (m *Metrics) Transition(room int, from, to ServerGameStateEnum) {
+	m.Lock()
+	defer m.Unlock()
+	if m.transitions == nil {
+		m.transitions = make(map[stateTransition]uint64)
+	}
+	m.transitions[stateTransition{room, from, to}]++
+}
+
+// quotes v as a label value
+func label(v string) string {
+	return strconv.Quote(v)
+}
+
+func roomLabel(room int) string {
+	return label(strconv.Itoa(room + 1))
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writePacketCounts(w io.Writer, direction string, counts map[string]*PacketCounts) {
+	types := []string{}
+	for packet_type := range counts {
+		types = append(types, packet_type)
+	}
+	sort.Strings(types)
+
+	name := fmt.Sprintf("gotanks_packets_%s_total", direction)
+	writeMetricHeader(w, name, "counter", fmt.Sprintf("packets %s, by packet type", direction))
+	for _, packet_type := range types {
+		fmt.Fprintf(w, "%s{type=%s} %d\n", name, label(packet_type), counts[packet_type].Packets)
+	}
+	name = fmt.Sprintf("gotanks_bytes_%s_total", direction)
+	writeMetricHeader(w, name, "counter", fmt.Sprintf("bytes %s, by packet type", direction))
+	for _, packet_type := range types {
+		fmt.Fprintf(w, "%s{type=%s} %d\n", name, label(packet_type), counts[packet_type].Bytes)
+	}
+}
+
+func (m *Metrics) write(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+
+	writePacketCounts(w, "received", m.received)
+	writePacketCounts(w, "sent", m.sent)
+
+	types := []string{}
+	for packet_type := range m.decode_errors {
+		types = append(types, packet_type)
+	}
+	sort.Strings(types)
+	writeMetricHeader(w, "gotanks_decode_errors_total", "counter", "packets dropped because they could not be read, by packet type")
+	for _, packet_type := range types {
+		fmt.Fprintf(w, "gotanks_decode_errors_total{type=%s} %d\n", label(packet_type), m.decode_errors[packet_type])
+	}
+
+	rooms := []int{}
+	for room := range m.rounds {
+		rooms = append(rooms, room)
+	}
+	sort.Ints(rooms)
+	writeMetricHeader(w, "gotanks_rounds_played_total", "counter", "rounds which ended with a winner")
+	for _, room := range rooms {
+		fmt.Fprintf(w, "gotanks_rounds_played_total{room=%s} %d\n", roomLabel(room), m.rounds[room])
+	}
+
+	transitions := []stateTransition{}
+	for transition := range m.transitions {
+		transitions = append(transitions, transition)
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		a, b := transitions[i], transitions[j]
+		if a.room != b.room {
+			return a.room < b.room
+		}
+		if a.from != b.from {
+			return a.from < b.from
+		}
+		return a.to < b.to
+	})
+	writeMetricHeader(w, "gotanks_state_transitions_total", "counter", "changes of a room's game state")
+	for _, t := range transitions {
+		fmt.Fprintf(w, "gotanks_state_transitions_total{room=%s,from=%s,to=%s} %d\n",
+			roomLabel(t.room), label(t.from.String()), label(t.to.String()), m.transitions[t])
+	}
+}
+
+// everything there is to know about the server, in the prometheus text format
+func (h *RoomHost) WriteMetrics(w io.Writer) {
+	writeMetricHeader(w, "gotanks_players_connected", "gauge", "players in a room, spectators included")
+	for _, room := range h.rooms {
+		room.connected_players.RLock()
+		players := len(room.connected_players.m)
+		room.connected_players.RUnlock()
+		fmt.Fprintf(w, "gotanks_players_connected{room=%s} %d\n", roomLabel(room.room), players)
+	}
+
+	writeMetricHeader(w, "gotanks_bullets_alive", "gauge", "bullets in play in a room")
+	for _, room := range h.rooms {
+		fmt.Fprintf(w, "gotanks_bullets_alive{room=%s} %d\n", roomLabel(room.room), room.bm.Count())
+	}
+
+	reports := []TickReport{}
+	for _, room := range h.rooms {
+		reports = append(reports, room.tick_stats.Report())
+	}
+	writeMetricHeader(w, "gotanks_tick_duration_seconds", "histogram", "time a room's simulation ticks took")
+	for i, report := range reports {
+		var ticks uint64
+		for j, bucket := range TICK_DURATION_BUCKETS {
+			ticks += report.Durations[j]
+			fmt.Fprintf(w, "gotanks_tick_duration_seconds_bucket{room=%s,le=%s} %d\n", roomLabel(i), label(strconv.FormatFloat(bucket.Seconds(), 'g', -1, 64)), ticks)
+		}
+		fmt.Fprintf(w, "gotanks_tick_duration_seconds_bucket{room=%s,le=\"+Inf\"} %d\n", roomLabel(i), report.Ticks)
+		fmt.Fprintf(w, "gotanks_tick_duration_seconds_sum{room=%s} %g\n", roomLabel(i), report.Total.Seconds())
+		fmt.Fprintf(w, "gotanks_tick_duration_seconds_count{room=%s} %d\n", roomLabel(i), report.Ticks)
+	}
+	writeMetricHeader(w, "gotanks_tick_overruns_total", "counter", "ticks which took longer than the time they had")
+	for i, report := range reports {
+		fmt.Fprintf(w, "gotanks_tick_overruns_total{room=%s} %d\n", roomLabel(i), report.Overruns)
+	}
+	writeMetricHeader(w, "gotanks_ticks_skipped_total", "counter", "ticks dropped because a room fell too far behind")
+	for i, report := range reports {
+		fmt.Fprintf(w, "gotanks_ticks_skipped_total{room=%s} %d\n", roomLabel(i), report.Skipped)
+	}
+
+	h.metrics.write(w)
+}
+
+// serves /metrics until ctx is cancelled
+func (h *RoomHost) ServeMetrics(ctx context.Context, listener net.Listener) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		h.WriteMetrics(w)
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	h.log.Info("serving metrics", shared.LogAddr("addr", listener.Addr()))
+	err := server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		h.log.Error("error serving metrics", shared.LogErr(err))
+	}
+}
@@ -0,0 +1,144 @@
+package sim
+
+import (
+	"bufio"
+	"gotanks/shared"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the samples of WriteMetrics by name and labels, and the type of every metric
+func readMetrics(t *testing.T, host *RoomHost) (samples map[string]string, types map[string]string) {
+	t.Helper()
+	var out strings.Builder
+	host.WriteMetrics(&out)
+
+	samples = map[string]string{}
+	types = map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if kind, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, kind, _ := strings.Cut(kind, " ")
+			types[name] = kind
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		// label values can have spaces, the value can not
+		i := strings.LastIndex(line, " ")
+		if i == -1 {
+			t.Fatalf("malformed line '%s'", line)
+		}
+		sample, value := line[:i], line[i+1:]
+		if _, ok := samples[sample]; ok {
+			t.Fatalf("'%s' was written twice", sample)
+		}
+		samples[sample] = value
+	}
+	return samples, types
+}
+
+func TestWriteMetrics(t *testing.T) {
+	host := newTestHost(t, 2)
+	first, second := host.rooms[0], host.rooms[1]
+
+	level, err := LoadLevel("../assets/tiled/level_1.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.levels = []Level{level}
+	first.config.Maps = []int{1}
+	first.config.Win_threshold = 1
+	first.config.New_level_interval_s = 0
+	for i := range 2 {
+		player := newTestPlayer(t, byte(i+1))
+		first.connected_players.m[player.key()] = ConnectedPlayer{
+			addr:   player.conn.LocalAddr().(*net.UDPAddr),
+			player: NewPlayer(player.key(), "tester"),
+			ready:  NetBoolTrue,
+		}
+	}
+	second.bm.AddBullet(StandardBullet{ID: "1"})
+	second.tick_stats.record(time.Millisecond, time.Second)
+	second.tick_stats.record(2*time.Second, time.Second)
+	host.metrics.DecodeError(shared.PacketTypeBulletShoot)
+	host.metrics.Received(shared.PacketTypeKeepAlive, 10)
+	host.metrics.Received(shared.PacketTypeKeepAlive, 20)
+
+	// a match of one round, from the lobby back to the lobby
+	states := []ServerGameStateEnum{ServerGameStateStartingNewMatch, ServerGameStateStartingNewRound, ServerGameStatePlaying}
+	for _, state := range states {
+		first.wait_time = time.Time{}
+		step(t, first, state)
+	}
+	// one of them is shot
+	for key, player := range first.connected_players.m {
+		player.tank.Kill()
+		first.connected_players.m[key] = player
+		break
+	}
+	first.wait_time = time.Time{}
+	step(t, first, ServerGameStateGameOver)
+	first.wait_time = time.Time{}
+	step(t, first, ServerGameStateWaitingInLobby)
+
+	samples, types := readMetrics(t, host)
+	expected_types := map[string]string{
+		"gotanks_players_connected":       "gauge",
+		"gotanks_bullets_alive":           "gauge",
+		"gotanks_tick_duration_seconds":   "histogram",
+		"gotanks_tick_overruns_total":     "counter",
+		"gotanks_ticks_skipped_total":     "counter",
+		"gotanks_packets_received_total":  "counter",
+		"gotanks_bytes_received_total":    "counter",
+		"gotanks_packets_sent_total":      "counter",
+		"gotanks_bytes_sent_total":        "counter",
+		"gotanks_decode_errors_total":     "counter",
+		"gotanks_rounds_played_total":     "counter",
+		"gotanks_state_transitions_total": "counter",
+	}
+	for name, kind := range expected_types {
+		if types[name] != kind {
+			t.Errorf("expected %s to be a %s, got '%s'", name, kind, types[name])
+		}
+	}
+	if len(types) != len(expected_types) {
+		t.Errorf("expected %d metrics, got %v", len(expected_types), types)
+	}
+
+	expected := map[string]string{
+		`gotanks_players_connected{room="1"}`:                                        "2",
+		`gotanks_players_connected{room="2"}`:                                        "0",
+		`gotanks_bullets_alive{room="1"}`:                                            "0",
+		`gotanks_bullets_alive{room="2"}`:                                            "1",
+		`gotanks_tick_duration_seconds_bucket{room="2",le="0.001"}`:                  "1",
+		`gotanks_tick_duration_seconds_bucket{room="2",le="0.128"}`:                  "1",
+		`gotanks_tick_duration_seconds_bucket{room="2",le="+Inf"}`:                   "2",
+		`gotanks_tick_duration_seconds_count{room="2"}`:                              "2",
+		`gotanks_tick_duration_seconds_count{room="1"}`:                              "0",
+		`gotanks_tick_overruns_total{room="2"}`:                                      "1",
+		`gotanks_ticks_skipped_total{room="2"}`:                                      "0",
+		`gotanks_packets_received_total{type="keep_alive"}`:                          "2",
+		`gotanks_bytes_received_total{type="keep_alive"}`:                            "30",
+		`gotanks_decode_errors_total{type="bullet_shoot"}`:                           "1",
+		`gotanks_rounds_played_total{room="1"}`:                                      "1",
+		`gotanks_state_transitions_total{room="1",from="lobby",to="starting match"}`: "1",
+		`gotanks_state_transitions_total{room="1",from="playing",to="game over"}`:    "1",
+		`gotanks_state_transitions_total{room="1",from="game over",to="lobby"}`:      "1",
+	}
+	for sample, value := range expected {
+		if samples[sample] != value {
+			t.Errorf("expected %s to be %s, got '%s'", sample, value, samples[sample])
+		}
+	}
+	if _, ok := samples[`gotanks_rounds_played_total{room="2"}`]; ok {
+		t.Error("a room which played no round has a count")
+	}
+	if samples[`gotanks_packets_sent_total{type="game_over"}`] != "2" {
+		t.Errorf("the end of the match was not sent to both players: %s", samples[`gotanks_packets_sent_total{type="game_over"}`])
+	}
+}
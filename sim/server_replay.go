@@ -0,0 +1,388 @@
+package sim
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bumped whenever the layout of replay files changes
+const REPLAY_VERSION = 1
+
+const REPLAY_EXTENSION = ".replay"
+
+// defaults of ServerConfig.Replay_max_kb and Replay_max_files
+const (
+	REPLAY_MAX_KB    = 4096
+	REPLAY_MAX_FILES = 100
+)
+
+// the largest header or record a replay may hold, no packet sent over udp
+// is larger. anything claiming more is a broken file
+const REPLAY_MAX_RECORD = 64 * 1024
+
+// written once at the start of every replay file
+type ReplayHeader struct {
+	Version  int
+	Server   string
+	Match_ID string
+	// a match too long for one file goes on in the next part, see
+	// ServerConfig.Replay_max_kb
+	Part      int
+	Started   time.Time
+	Tick_rate int
+	// the map list, numbered from 1, and the one the match starts on
+	Maps  []int
+	Level LevelEnum
+	// who was there when the match started, later players show up in
+	// PlayerUpdate packets
+	Players []ReplayPlayer
+}
+
+type ReplayPlayer struct {
+	Player_ID string
+	Name      string
+}
+
+type ReplayRecordKind uint8
+
+const (
+	// a packet broadcast to every player, as it was sent
+	ReplayRecordPacket ReplayRecordKind = iota + 1
+	// the room moved from one ServerGameStateEnum to another
+	ReplayRecordState
+)
+
+// precedes the data of every record
+type replayRecordHeader struct {
+	// milliseconds since ReplayHeader.Started
+	Offset uint32
+	Kind   ReplayRecordKind
+	Size   uint32
+}
+
+// one record read back by ReplayReader
+type ReplayRecord struct {
+	At   time.Duration
+	Kind ReplayRecordKind
+
+	// ReplayRecordPacket
+	Packet shared.Packet
+	Data   []byte
+
+	// ReplayRecordState
+	From ServerGameStateEnum
+	To   ServerGameStateEnum
+}
+
+// an open replay file.
+// everything past the file's header is gzipped, so only what gzip has
+// flushed counts towards its size. the size is behind by what gzip
+// holds back, which makes ServerConfig.Replay_max_kb approximate
+type replayFile struct {
+	header  ReplayHeader
+	file    *os.File
+	counter *countingWriter
+	gz      *gzip.Writer
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func createReplayFile(path string, header ReplayHeader) (*replayFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingWriter{w: file}
+	f := &replayFile{header: header, file: file, counter: counter, gz: gzip.NewWriter(counter)}
+
+	// the header is length prefixed, gob would read past its end
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(header)
+	if err == nil {
+		err = binary.Write(f.gz, binary.BigEndian, uint32(buf.Len()))
+	}
+	if err == nil {
+		_, err = f.gz.Write(buf.Bytes())
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *replayFile) write(kind ReplayRecordKind, data []byte) error {
+	record := replayRecordHeader{
+		Offset: uint32(time.Since(f.header.Started).Milliseconds()),
+		Kind:   kind,
+		Size:   uint32(len(data)),
+	}
+	err := binary.Write(f.gz, binary.BigEndian, record)
+	if err != nil {
+		return err
+	}
+	_, err = f.gz.Write(data)
+	return err
+}
+
+func (f *replayFile) Close() error {
+	return errors.Join(f.gz.Close(), f.file.Close())
+}
+
+// Replays records the matches of a room to ServerConfig.Replay_dir.
+// every match gets its own file, rotated to a new part when it grows past
+// Replay_max_kb, and only the newest Replay_max_files are kept.
+// packets are recorded from the game loop and the packet handler alike
+type Replays struct {
+	sync.Mutex
+	dir       string
+	max_bytes int64
+	max_files int
+	log       *slog.Logger
+
+	current *replayFile
+}
+
+func NewReplays(config ServerConfig, logger *slog.Logger) *Replays {
+	return &Replays{
+		dir:       config.Replay_dir,
+		max_bytes: int64(config.Replay_max_kb) * 1024,
+		max_files: config.Replay_max_files,
+		log:       logger,
+	}
+}
+
+func (r *Replays) enabled() bool {
+	return r != nil && r.dir != ""
+}
+
+// the names sort by when they were started
+func (r *Replays) path(header ReplayHeader) string {
+	name := fmt.Sprintf("%s-%s-%s-%d%s", header.Started.UTC().Format("20060102-150405"), strings.ReplaceAll(header.Server, " ", "_"),
+		header.Match_ID[:min(8, len(header.Match_ID))], header.Part, REPLAY_EXTENSION)
+	return filepath.Join(r.dir, name)
+}
+
+// closes the recording of the last match and starts recording the next
+func (r *Replays) Start(header ReplayHeader) {
+	if !r.enabled() {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.closeCurrent()
+
+	header.Version = REPLAY_VERSION
+	header.Part = 1
+	header.Started = time.Now()
+	r.open(header)
+}
+
+// expects r to be locked
+func (r *Replays) open(header ReplayHeader) {
+	err := os.MkdirAll(r.dir, 0o755)
+	if err != nil {
+		r.log.Error("error creating replay directory", "path", r.dir, shared.LogErr(err))
+		return
+	}
+	path := r.path(header)
+	f, err := createReplayFile(path, header)
+	if err != nil {
+		r.log.Error("error creating replay", "path", path, shared.LogErr(err))
+		return
+	}
+	r.current = f
+	r.log.Debug("recording replay", "path", path, shared.LOG_MATCH, header.Match_ID)
+	r.prune()
+}
+
+// removes the oldest replays beyond max_files, the one being recorded is
+// always the newest.
+// expects r to be locked
+func (r *Replays) prune() {
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*"+REPLAY_EXTENSION))
+	if err != nil || len(paths) <= r.max_files {
+		return
+	}
+	sort.Strings(paths)
+	for _, path := range paths[:len(paths)-r.max_files] {
+		err := os.Remove(path)
+		if err != nil {
+			r.log.Error("error removing old replay", "path", path, shared.LogErr(err))
+		}
+	}
+}
+
+// expects r to be locked
+func (r *Replays) closeCurrent() {
+	if r.current == nil {
+		return
+	}
+	err := r.current.Close()
+	if err != nil {
+		r.log.Error("error closing replay", "path", r.current.file.Name(), shared.LogErr(err))
+	}
+	r.current = nil
+}
+
+// expects r to be locked
+func (r *Replays) record(kind ReplayRecordKind, data []byte) {
+	if r.current == nil {
+		return
+	}
+	if len(data) > REPLAY_MAX_RECORD {
+		r.log.Warn("not recording what could not be read back", "path", r.current.file.Name(), "size", len(data))
+		return
+	}
+	err := r.current.write(kind, data)
+	if err != nil {
+		r.log.Error("error recording replay, stopping", "path", r.current.file.Name(), shared.LogErr(err))
+		r.closeCurrent()
+		return
+	}
+
+	if r.current.counter.n >= r.max_bytes {
+		header := r.current.header
+		header.Part++
+		r.closeCurrent()
+		r.open(header)
+	}
+}
+
+// records raw_data, a serialized packet sent to every player
+func (r *Replays) Packet(raw_data []byte) {
+	if !r.enabled() {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.record(ReplayRecordPacket, raw_data)
+}
+
+// records a state change, a match ends with the room back in the lobby
+func (r *Replays) State(from, to ServerGameStateEnum) {
+	if !r.enabled() {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.record(ReplayRecordState, []byte{byte(from), byte(to)})
+	if to == ServerGameStateWaitingInLobby {
+		r.closeCurrent()
+		return
+	}
+	if r.current != nil {
+		// what was recorded so far survives the server dying
+		r.current.gz.Flush()
+	}
+}
+
+// stops recording, the file is kept
+func (r *Replays) Close() {
+	if !r.enabled() {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.closeCurrent()
+}
+
+// reads back what Replays recorded
+type ReplayReader struct {
+	header ReplayHeader
+	r      *bufio.Reader
+}
+
+// reads the header of the replay in r, see ReplayReader.Next for the rest
+func OpenReplay(r io.Reader) (*ReplayReader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a replay: %w", err)
+	}
+	reader := &ReplayReader{r: bufio.NewReader(gz)}
+
+	var size uint32
+	err = binary.Read(reader.r, binary.BigEndian, &size)
+	if err != nil {
+		return nil, fmt.Errorf("error reading replay header: %w", err)
+	}
+	if size > REPLAY_MAX_RECORD {
+		return nil, fmt.Errorf("replay header of %d bytes is larger than %d", size, REPLAY_MAX_RECORD)
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(reader.r, data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading replay header: %w", err)
+	}
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&reader.header)
+	if err != nil {
+		return nil, fmt.Errorf("error reading replay header: %w", err)
+	}
+	if reader.header.Version != REPLAY_VERSION {
+		return nil, fmt.Errorf("replay version %d is not supported, only %d is", reader.header.Version, REPLAY_VERSION)
+	}
+	return reader, nil
+}
+
+func (r *ReplayReader) Header() ReplayHeader {
+	return r.header
+}
+
+// the next record, io.EOF after the last one.
+// a replay cut short by a crash ends in io.ErrUnexpectedEOF instead
+func (r *ReplayReader) Next() (ReplayRecord, error) {
+	var header replayRecordHeader
+	err := binary.Read(r.r, binary.BigEndian, &header)
+	if err != nil {
+		return ReplayRecord{}, err
+	}
+	if header.Size > REPLAY_MAX_RECORD {
+		return ReplayRecord{}, fmt.Errorf("record of %d bytes is larger than %d", header.Size, REPLAY_MAX_RECORD)
+	}
+	data := make([]byte, header.Size)
+	_, err = io.ReadFull(r.r, data)
+	if err != nil {
+		return ReplayRecord{}, io.ErrUnexpectedEOF
+	}
+
+	record := ReplayRecord{At: time.Duration(header.Offset) * time.Millisecond, Kind: header.Kind}
+	switch header.Kind {
+	case ReplayRecordPacket:
+		record.Packet, record.Data, err = shared.DeserializePacket(data)
+		if err != nil {
+			return record, err
+		}
+	case ReplayRecordState:
+		if len(data) != 2 {
+			return record, fmt.Errorf("state record of %d bytes", len(data))
+		}
+		record.From = ServerGameStateEnum(data[0])
+		record.To = ServerGameStateEnum(data[1])
+	default:
+		return record, fmt.Errorf("unknown record kind %d", header.Kind)
+	}
+	return record, nil
+}
@@ -0,0 +1,208 @@
+package sim
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestReplays(t *testing.T, max_kb, max_files int) *Replays {
+	config := DefaultServerConfig()
+	config.Replay_dir = t.TempDir()
+	config.Replay_max_kb = max_kb
+	config.Replay_max_files = max_files
+	return NewReplays(config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func replayPaths(t *testing.T, r *Replays) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*"+REPLAY_EXTENSION))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func openTestReplay(t *testing.T, path string) *ReplayReader {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	reader, err := OpenReplay(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func replayPacket(t *testing.T, data interface{}) []byte {
+	t.Helper()
+	raw, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypePlayerHit}, [16]byte{}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	replays := newTestReplays(t, REPLAY_MAX_KB, REPLAY_MAX_FILES)
+	replays.Start(ReplayHeader{Server: "test server", Match_ID: "match-id", Maps: []int{1, 2}, Level: 1,
+		Players: []ReplayPlayer{{Player_ID: "a", Name: "tester"}}})
+	replays.State(ServerGameStateStartingNewMatch, ServerGameStatePlaying)
+	replays.Packet(replayPacket(t, BulletHit{Player: "a", Shooter: "b", Bullet_ID: "3"}))
+	replays.State(ServerGameStateGameOver, ServerGameStateWaitingInLobby)
+
+	paths := replayPaths(t, replays)
+	if len(paths) != 1 {
+		t.Fatalf("expected one replay, found %v", paths)
+	}
+	reader := openTestReplay(t, paths[0])
+	header := reader.Header()
+	if header.Version != REPLAY_VERSION || header.Server != "test server" || header.Match_ID != "match-id" ||
+		header.Part != 1 || header.Level != 1 || len(header.Players) != 1 {
+		t.Fatalf("header was not read back: %+v", header)
+	}
+
+	record, err := reader.Next()
+	if err != nil || record.Kind != ReplayRecordState || record.From != ServerGameStateStartingNewMatch || record.To != ServerGameStatePlaying {
+		t.Fatalf("expected the match to start, got %+v, %v", record, err)
+	}
+	record, err = reader.Next()
+	if err != nil || record.Kind != ReplayRecordPacket || record.Packet.PacketType != shared.PacketTypePlayerHit {
+		t.Fatalf("expected the packet, got %+v, %v", record, err)
+	}
+	record, err = reader.Next()
+	if err != nil || record.To != ServerGameStateWaitingInLobby {
+		t.Fatalf("expected the match to end, got %+v, %v", record, err)
+	}
+	if _, err = reader.Next(); err != io.EOF {
+		t.Fatalf("expected the replay to end, got %v", err)
+	}
+}
+
+func TestReplayRotatesParts(t *testing.T) {
+	replays := newTestReplays(t, 1, REPLAY_MAX_FILES)
+	replays.Start(ReplayHeader{Server: "test", Match_ID: "match-id"})
+	// random data keeps gzip from shrinking it
+	noise := make([]byte, 1024)
+	for range 64 {
+		rand.Read(noise)
+		replays.Packet(replayPacket(t, noise))
+	}
+	replays.Close()
+
+	paths := replayPaths(t, replays)
+	if len(paths) < 2 {
+		t.Fatalf("expected the match to go on in more parts, found %v", paths)
+	}
+	parts := map[int]bool{}
+	for _, path := range paths {
+		reader := openTestReplay(t, path)
+		parts[reader.Header().Part] = true
+		for {
+			_, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+		}
+	}
+	for part := 1; part <= len(paths); part++ {
+		if !parts[part] {
+			t.Fatalf("part %d is missing, found %v", part, parts)
+		}
+	}
+}
+
+func TestReplaysArePruned(t *testing.T) {
+	replays := newTestReplays(t, REPLAY_MAX_KB, 2)
+	old := []string{"20000101-000000-test-a-1", "20000101-000000-test-b-1", "20000101-000000-test-c-1"}
+	for _, name := range old {
+		os.WriteFile(filepath.Join(replays.dir, name+REPLAY_EXTENSION), nil, 0o644)
+	}
+	os.WriteFile(filepath.Join(replays.dir, "notes.txt"), nil, 0o644)
+
+	replays.Start(ReplayHeader{Server: "test", Match_ID: "match-id"})
+	replays.Close()
+
+	paths := replayPaths(t, replays)
+	if len(paths) != 2 || filepath.Base(paths[0]) != old[2]+REPLAY_EXTENSION {
+		t.Fatalf("expected the newest old replay and the new one, found %v", paths)
+	}
+	if _, err := os.Stat(filepath.Join(replays.dir, "notes.txt")); err != nil {
+		t.Fatal("a file which is not a replay was removed")
+	}
+}
+
+func TestReadingTruncatedReplay(t *testing.T) {
+	replays := newTestReplays(t, REPLAY_MAX_KB, REPLAY_MAX_FILES)
+	replays.Start(ReplayHeader{Server: "test", Match_ID: "match-id"})
+	for i := range 10 {
+		replays.Packet(replayPacket(t, BulletHit{Bullet_ID: fmt.Sprint(i)}))
+	}
+	replays.Close()
+	path := replayPaths(t, replays)[0]
+	full, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened := 0
+	for _, size := range []int{0, 10, len(full) / 2, len(full) - 8} {
+		reader, err := OpenReplay(bytes.NewReader(full[:size]))
+		if err != nil {
+			// cut off within the header
+			continue
+		}
+		opened++
+		for {
+			_, err = reader.Next()
+			if err != nil {
+				break
+			}
+		}
+		if err == io.EOF {
+			t.Fatalf("replay cut to %d of %d bytes seemed complete", size, len(full))
+		}
+	}
+	if opened == 0 {
+		t.Fatal("no cut replay got past its header")
+	}
+}
+
+func TestReadingReplayWithHugeRecord(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	binary.Write(gz, binary.BigEndian, uint32(1<<31))
+	gz.Close()
+	_, err := OpenReplay(&buf)
+	if err == nil {
+		t.Fatal("a header of 2GB was read")
+	}
+
+	replays := newTestReplays(t, REPLAY_MAX_KB, REPLAY_MAX_FILES)
+	replays.Start(ReplayHeader{Server: "test", Match_ID: "match-id"})
+	replays.Lock()
+	binary.Write(replays.current.gz, binary.BigEndian, replayRecordHeader{Kind: ReplayRecordPacket, Size: 1 << 31})
+	replays.Unlock()
+	replays.Close()
+
+	reader := openTestReplay(t, replayPaths(t, replays)[0])
+	_, err = reader.Next()
+	if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected the record to be refused, got %v", err)
+	}
+}
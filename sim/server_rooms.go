@@ -0,0 +1,158 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"gotanks/shared"
+	"log"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// which room every player is in, keyed by auth
+type Sessions struct {
+	sync.RWMutex
+	m map[string]int
+}
+
+func (s *Sessions) Get(auth string) (int, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	room, ok := s.m[auth]
+	return room, ok
+}
+
+// returns the room auth was in before, if any
+func (s *Sessions) Set(auth string, room int) (previous int, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+	previous, ok = s.m[auth]
+	s.m[auth] = room
+	return previous, ok
+}
+
+// forgets auth, unless it has moved on to another room in the meantime
+func (s *Sessions) Remove(auth string, room int) {
+	s.Lock()
+	defer s.Unlock()
+	if s.m[auth] == room {
+		delete(s.m, auth)
+	}
+}
+
+// RoomHost runs every room of a server process, see ServerConfig.Rooms.
+// each room is a Server with its own players and state machine, they share
+// the socket, which the host reads from and hands every packet to its room
+type RoomHost struct {
+	conn     *net.UDPConn
+	rooms    []*Server
+	sessions Sessions
+	access   *Access
+	// shared by the stats managers of every room
+	stats       StatsStore
+	leaderboard LeaderboardCache
+	metrics     Metrics
+	log         *slog.Logger
+}
+
+func RoomName(name string, room int) string {
+	if room == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s %d", name, room+1)
+}
+
+// the room packet_data is meant for, nil if it should be dropped
+func (h *RoomHost) route(packet_data shared.PacketData) *Server {
+	dec := gob.NewDecoder(bytes.NewReader(packet_data.Data))
+	room := 0
+	switch packet_data.Packet.PacketType {
+	case shared.PacketTypeNegotiate:
+		negotiation := shared.NegotiateData{}
+		err := dec.Decode(&negotiation)
+		if err != nil {
+			h.log.Warn("error decoding negotiation", shared.LogAddr("addr", &packet_data.Addr), shared.LogErr(err))
+			h.metrics.DecodeError(packet_data.Packet.PacketType)
+			return nil
+		}
+		// a player switching rooms stays in theirs until the new one
+		// lets them in, see Server.HandleNegotiate
+		room = negotiation.Room
+	case shared.PacketTypeMatchHost, shared.PacketTypeUnknownHost:
+		// mediators tell us which room they mean
+		inner_data := shared.ReconcilliationData{}
+		err := dec.Decode(&inner_data)
+		if err != nil {
+			h.log.Warn("error decoding mediator packet", shared.LogAddr("addr", &packet_data.Addr), shared.LogErr(err))
+			h.metrics.DecodeError(packet_data.Packet.PacketType)
+			return nil
+		}
+		room = inner_data.Room
+	case shared.PacketTypePing:
+		// players answer our pings from their room,
+		// the server browser is not in any
+		session_room, ok := h.sessions.Get(shared.AuthToString(packet_data.Packet.Auth))
+		if ok {
+			room = session_room
+		}
+	case shared.PacketTypeLeaderboard:
+		// every room shares the stats, the host answers by itself
+		h.answerLeaderboard(packet_data)
+		return nil
+	case shared.PacketTypeMatchConnect:
+		// not about any room in particular
+	default:
+		session_room, ok := h.sessions.Get(shared.AuthToString(packet_data.Packet.Auth))
+		if ok {
+			room = session_room
+		} else if len(h.rooms) > 1 {
+			// with several rooms, players have to say which one they want
+			// by negotiating first
+			return nil
+		}
+	}
+
+	if room < 0 || room >= len(h.rooms) {
+		h.rooms[0].Reject(&packet_data.Addr, fmt.Sprintf("there is no room %d", room+1))
+		return nil
+	}
+	return h.rooms[room]
+}
+
+// reads packets until the connection is closed
+func (h *RoomHost) Listen(ctx context.Context) {
+	h.log.Info("server is listening", shared.LogAddr("addr", h.conn.LocalAddr()))
+	buf := make([]byte, BUFFER_SIZE)
+	for {
+		n, addr, err := h.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Panic("error reading from connection:", err)
+		}
+
+		packet, data, err := shared.DeserializePacket(buf[:n])
+		if err != nil {
+			// anyone can send us anything
+			h.log.Debug("dropped unreadable packet", shared.LogAddr("addr", addr), shared.LogErr(err))
+			h.metrics.DecodeError(packet.PacketType)
+			continue
+		}
+		h.metrics.Received(packet.PacketType, n)
+
+		packet_data := shared.PacketData{Packet: packet, Data: data, Addr: *addr}
+		room := h.route(packet_data)
+		if room == nil {
+			continue
+		}
+		select {
+		case room.packet_channel <- packet_data:
+		case <-ctx.Done():
+			// nobody handles packets anymore, wait for the connection to close
+		}
+	}
+}
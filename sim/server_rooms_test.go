@@ -0,0 +1,204 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"gotanks/shared"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestHost(t *testing.T, rooms int) *RoomHost {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	access, _ := LoadAccess("", false)
+	host := RoomHost{conn: conn, access: access, stats: NewMemoryStats(), log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	host.sessions.m = make(map[string]int)
+	for i := range rooms {
+		room := Server{conn: conn, host: &host, room: i, sessions: &host.sessions, access: access, metrics: &host.metrics, log: host.log}
+		room.connected_players.m = make(map[string]ConnectedPlayer)
+		room.challenges.m = make(map[string]PasswordChallenge)
+		room.admin_channel = make(chan func())
+		room.config = DefaultServerConfig()
+		room.accepts_new_connections.Store(true)
+		room.sm = newTestStatsManager(host.stats)
+		t.Cleanup(room.sm.DeInit)
+		room.publish()
+		host.rooms = append(host.rooms, &room)
+	}
+	return &host
+}
+
+// a player's end of the connection
+type testPlayer struct {
+	auth [16]byte
+	conn *net.UDPConn
+}
+
+func newTestPlayer(t *testing.T, auth byte) *testPlayer {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testPlayer{auth: [16]byte{auth}, conn: conn}
+}
+
+func (p *testPlayer) key() string {
+	return shared.AuthToString(p.auth)
+}
+
+// a packet from p as the server receives it
+func (p *testPlayer) packet(t *testing.T, packet_type shared.PacketType, data interface{}) shared.PacketData {
+	t.Helper()
+	raw, err := shared.SerializePacket(shared.Packet{PacketType: packet_type}, p.auth, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, inner, err := shared.DeserializePacket(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shared.PacketData{Packet: packet, Data: inner, Addr: *p.conn.LocalAddr().(*net.UDPAddr)}
+}
+
+func (p *testPlayer) negotiate(t *testing.T, room int, username string) shared.PacketData {
+	return p.packet(t, shared.PacketTypeNegotiate, shared.NegotiateData{Room: room, Username: username})
+}
+
+// the next packet sent to p, decoded into v, failing after a second
+func (p *testPlayer) expect(t *testing.T, packet_type shared.PacketType, v interface{}) {
+	t.Helper()
+	p.conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, BUFFER_SIZE)
+	for {
+		n, _, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("expected %v, got %v", packet_type, err)
+		}
+		packet, data, err := shared.DeserializePacket(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the state of the room is sent all the time
+		if packet.PacketType == shared.PacketTypeUpdatePlayers || packet.PacketType == shared.PacketTypePing {
+			continue
+		}
+		if packet.PacketType != packet_type {
+			t.Fatalf("expected %v, got %v", packet_type, packet.PacketType)
+		}
+		if v != nil {
+			err = gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+// fails if anything but updates is sent to p in a short while
+func (p *testPlayer) expectNothing(t *testing.T) {
+	t.Helper()
+	p.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	buf := make([]byte, BUFFER_SIZE)
+	for {
+		n, _, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		packet, _, err := shared.DeserializePacket(buf[:n])
+		if err == nil && packet.PacketType != shared.PacketTypeUpdatePlayers && packet.PacketType != shared.PacketTypePing {
+			t.Fatalf("expected nothing, got %v", packet.PacketType)
+		}
+	}
+}
+
+func negotiatePacket(t *testing.T, auth [16]byte, room int) shared.PacketData {
+	t.Helper()
+	raw, err := shared.SerializePacket(shared.Packet{PacketType: shared.PacketTypeNegotiate}, auth, shared.NegotiateData{Room: room, Username: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, data, err := shared.DeserializePacket(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shared.PacketData{Packet: packet, Data: data, Addr: net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 7707}}
+}
+
+func TestSwitchingRoomsLeavesTheOldOne(t *testing.T) {
+	host := newTestHost(t, 2)
+	player := newTestPlayer(t, 1)
+	join := func(room int) {
+		t.Helper()
+		packet := player.negotiate(t, room, "tester")
+		if routed := host.route(packet); routed != host.rooms[room] {
+			t.Fatalf("negotiation was not routed to room %d", room)
+		}
+		host.rooms[room].handle(packet)
+		player.expect(t, shared.PacketTypeNegotiate, nil)
+	}
+
+	join(0)
+	// negotiating again with the room they are in changes nothing
+	join(0)
+	if _, ok := host.rooms[0].connected_players.m[player.key()]; !ok {
+		t.Fatal("player left the room they negotiated with")
+	}
+
+	join(1)
+	if _, ok := host.rooms[0].connected_players.m[player.key()]; ok {
+		t.Fatal("player is still in the room they left")
+	}
+	if room, _ := host.sessions.Get(player.key()); room != 1 {
+		t.Fatalf("the session points at room %d", room)
+	}
+}
+
+func TestSwitchingIntoFullRoomKeepsPlayer(t *testing.T) {
+	host := newTestHost(t, 2)
+	host.rooms[1].config.Max_players = 2
+	for i := range 2 {
+		other := newTestPlayer(t, byte(10+i))
+		host.rooms[1].handle(other.negotiate(t, 1, fmt.Sprint("other", i)))
+		other.expect(t, shared.PacketTypeNegotiate, nil)
+	}
+
+	player := newTestPlayer(t, 1)
+	host.rooms[0].handle(player.negotiate(t, 0, "tester"))
+	player.expect(t, shared.PacketTypeNegotiate, nil)
+
+	packet := player.negotiate(t, 1, "tester")
+	host.route(packet).handle(packet)
+	player.expect(t, shared.PacketTypeConnectionRejected, nil)
+	if _, ok := host.rooms[0].connected_players.m[player.key()]; !ok {
+		t.Fatal("player lost their room by asking for a full one")
+	}
+	if room, ok := host.sessions.Get(player.key()); !ok || room != 0 {
+		t.Fatal("the session no longer points at their room")
+	}
+}
+
+func TestNegotiatingForMissingRoomKeepsPlayer(t *testing.T) {
+	host := newTestHost(t, 2)
+	auth := [16]byte{1}
+	key := shared.AuthToString(auth)
+	host.rooms[0].connected_players.m[key] = ConnectedPlayer{player: NewPlayer(key, "tester")}
+	host.sessions.Set(key, 0)
+
+	if room := host.route(negotiatePacket(t, auth, 5)); room != nil {
+		t.Fatal("a room that does not exist was routed to")
+	}
+	if room, ok := host.sessions.Get(key); !ok || room != 0 {
+		t.Fatal("player lost their room by asking for one that does not exist")
+	}
+}
@@ -0,0 +1,293 @@
+package sim
+
+import (
+	"database/sql"
+	"fmt"
+	"gotanks/shared"
+	"log"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Player struct {
+	Player_ID  string    `db:"player_id"`
+	Username   string    `db:"username"`
+	Created_at time.Time `db:"created_at"`
+	Updated_at time.Time `db:"updated_at"`
+	// only changed by StatsStore.SaveMatchResults, SavePlayer leaves it be
+	Rating float64 `db:"rating"`
+}
+
+type Match struct {
+	Match_ID   string         `db:"match_id"`
+	Start_time time.Time      `db:"start_time"`
+	End_time   time.Time      `db:"end_time"`
+	Winner_ID  sql.NullString `db:"winner_id"`
+}
+
+type Round struct {
+	Round_ID  string         `db:"round_id"`
+	Match_ID  string         `db:"match_id"`
+	Winner_ID sql.NullString `db:"winner_id"`
+	Level     LevelEnum      `db:"level"`
+}
+
+type KillEvent struct {
+	Kill_ID   string    `db:"kill_id"`
+	Round_ID  string    `db:"match_id"`
+	Killer_ID string    `db:"killer_id"`
+	Victim_ID string    `db:"victim_id"`
+	Timestamp time.Time `db:"time_stamp"`
+	// the killer's tank when the bullet hit, see Component
+	Killer_loadout uint32                 `db:"killer_loadout"`
+	Bullet_type    StandardBulletTypeEnum `db:"bullet_type"`
+}
+
+type ServerStats struct {
+	Matches    []*Match
+	KillEvents []*KillEvent
+	Rounds     []*Round
+}
+
+// where stats end up, see MemoryStats and SQLiteStats.
+// players are read while joining, everything else is only written.
+// saving a match or round again updates it
+type StatsStore interface {
+	// nil if the player has never played here
+	GetPlayer(id string) (*Player, error)
+	SavePlayer(p Player) error
+	SaveMatch(m Match) error
+	SaveRound(r Round) error
+	SaveKillEvent(k KillEvent) error
+	// records who played a match and moves their ratings,
+	// a match is only rated once
+	SaveMatchResults(results []MatchResult) error
+	// the best rated players who finished a match, at most limit of them
+	Leaderboard(limit int) ([]shared.LeaderboardEntry, error)
+	Close() error
+}
+
+// names of the stores ServerConfig.Stats_store can pick
+const (
+	STATS_STORE_MEMORY = "memory"
+	STATS_STORE_SQLITE = "sqlite"
+)
+
+// opens the store the config asks for, shared by every room
+func OpenStatsStore(config ServerConfig) (StatsStore, error) {
+	switch config.Stats_store {
+	case STATS_STORE_MEMORY:
+		return NewMemoryStats(), nil
+	case STATS_STORE_SQLITE:
+		return OpenSQLiteStats(config.Stats_path)
+	}
+	return nil, fmt.Errorf("unknown stats store '%s'", config.Stats_store)
+}
+
+// writes that can wait for the store, see ServerSyncManager.Go.
+// beyond this the store is too far behind and writes are dropped
+const STATS_QUEUE_SIZE = 8192
+
+// writes waiting for the writer, in order
+type StatsQueue struct {
+	sync.Mutex
+	writes []func()
+	// writes dropped because the queue was full
+	dropped uint64
+	// wakes the writer
+	ready chan struct{}
+}
+
+// keeps the stats of a room, writing them to the store in the background
+type ServerSyncManager struct {
+	stats ServerStats
+	store StatsStore
+
+	// writes run one at a time in order, so a round is never written
+	// before its match
+	queue   StatsQueue
+	pending sync.WaitGroup
+
+	log *slog.Logger
+}
+
+func InitStatsManager(store StatsStore) *ServerSyncManager {
+	sm := &ServerSyncManager{store: store, log: slog.Default()}
+	sm.queue.ready = make(chan struct{}, 1)
+	go sm.write()
+	return sm
+}
+
+// runs queued writes until DeInit
+func (sm *ServerSyncManager) write() {
+	for range sm.queue.ready {
+		for {
+			sm.queue.Lock()
+			writes := sm.queue.writes
+			sm.queue.writes = nil
+			sm.queue.Unlock()
+			if len(writes) == 0 {
+				break
+			}
+			for _, write := range writes {
+				write()
+				sm.pending.Done()
+			}
+		}
+	}
+}
+
+// stops the writer, expects nothing to be written after
+func (sm *ServerSyncManager) DeInit() {
+	sm.Flush()
+	close(sm.queue.ready)
+	sm.log.Debug("succesfully de-initing the sync manager")
+}
+
+// queues a write without holding up the game, Flush waits for it.
+// the write is dropped if the store has fallen too far behind
+func (sm *ServerSyncManager) Go(write func()) {
+	sm.queue.Lock()
+	if len(sm.queue.writes) >= STATS_QUEUE_SIZE {
+		sm.queue.dropped++
+		dropped := sm.queue.dropped
+		sm.queue.Unlock()
+		sm.log.Error("stats store is not keeping up, dropped a write", "dropped", dropped)
+		return
+	}
+	sm.queue.writes = append(sm.queue.writes, write)
+	sm.pending.Add(1)
+	sm.queue.Unlock()
+
+	select {
+	case sm.queue.ready <- struct{}{}:
+	default:
+		// the writer is already woken up
+	}
+}
+
+func (sm *ServerSyncManager) Flush() {
+	sm.pending.Wait()
+}
+
+// queues save for the store
+func (sm *ServerSyncManager) save(what string, save func(store StatsStore) error) {
+	sm.Go(func() {
+		err := save(sm.store)
+		if err != nil {
+			sm.log.Error("error saving stats", "what", what, shared.LogErr(err))
+		}
+	})
+}
+
+func NewPlayer(addr string, username string) Player {
+	p := Player{}
+	p.Player_ID = addr
+	p.Created_at = time.Now()
+	p.Updated_at = time.Now()
+	p.Username = username
+	p.Rating = INITIAL_RATING
+
+	return p
+}
+
+func NewKillEvent(round_id, victim_id, killer_id string) KillEvent {
+	k := KillEvent{}
+	k.Kill_ID = uuid.NewString()
+	k.Killer_ID = killer_id
+	k.Round_ID = round_id
+	k.Victim_ID = victim_id
+	k.Timestamp = time.Now()
+	return k
+}
+
+// saves a player who just joined as player.Username, keeping what is
+// stored about them if they played before. they are looked up by the
+// writer, so the game never waits for the store.
+// joined is called from the writer once they are saved
+func (sm *ServerSyncManager) SaveJoined(player Player, joined func(returning bool)) {
+	sm.Go(func() {
+		stored, err := sm.store.GetPlayer(player.Player_ID)
+		if err != nil {
+			sm.log.Error("error reading player", shared.LOG_PLAYER, player.Player_ID, shared.LogErr(err))
+			return
+		}
+		if stored != nil {
+			username := player.Username
+			player = *stored
+			player.Username = username
+		}
+		player.Updated_at = time.Now()
+		err = sm.store.SavePlayer(player)
+		if err != nil {
+			sm.log.Error("error saving stats", "what", "player", shared.LogErr(err))
+			return
+		}
+		joined(stored != nil)
+	})
+}
+
+func NewMatch(sm *ServerSyncManager) Match {
+	m := Match{}
+	m.Match_ID = uuid.NewString()
+	m.Start_time = time.Now()
+	sm.save("match", func(store StatsStore) error { return store.SaveMatch(m) })
+	return m
+}
+
+func NewRound(m Match, level LevelEnum, sm *ServerSyncManager) Round {
+	r := Round{}
+	r.Round_ID = uuid.NewString()
+	r.Match_ID = m.Match_ID
+	r.Level = level
+	sm.save("round", func(store StatsStore) error { return store.SaveRound(r) })
+	return r
+}
+
+func (k *KillEvent) Sync(sm *ServerSyncManager) {
+	kill := *k
+	sm.save("kill", func(store StatsStore) error { return store.SaveKillEvent(kill) })
+}
+
+func (p *Player) Update(sm *ServerSyncManager) {
+	p.Updated_at = time.Now()
+	player := *p
+	sm.save("player", func(store StatsStore) error { return store.SavePlayer(player) })
+}
+
+// a round nobody survived is saved without a winner
+func (r *Round) CompleteRound(sm *ServerSyncManager) {
+	round := *r
+	sm.save("round", func(store StatsStore) error { return store.SaveRound(round) })
+}
+
+// rates a finished match for everyone who played a round of it. ratings are
+// read in the writer, after the results of earlier matches were written
+func (sm *ServerSyncManager) RateMatch(m Match, participants []string) {
+	sm.save("ratings", func(store StatsStore) error {
+		ratings := map[string]float64{}
+		for _, id := range participants {
+			player, err := store.GetPlayer(id)
+			if err != nil {
+				return err
+			}
+			ratings[id] = INITIAL_RATING
+			if player != nil {
+				ratings[id] = player.Rating
+			}
+		}
+		return store.SaveMatchResults(RateMatch(m.Match_ID, ratings, m.Winner_ID.String))
+	})
+}
+
+func (m *Match) CompleteMatch(sm *ServerSyncManager) {
+	if !m.Winner_ID.Valid {
+		log.Panic("winner id can not be null")
+	}
+	m.End_time = time.Now()
+	match := *m
+	sm.save("match", func(store StatsStore) error { return store.SaveMatch(match) })
+}
@@ -0,0 +1,77 @@
+package sim
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func newTestStatsManager(store StatsStore) *ServerSyncManager {
+	sm := InitStatsManager(store)
+	sm.log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return sm
+}
+
+func TestStatsWritesDoNotWaitForTheStore(t *testing.T) {
+	sm := newTestStatsManager(NewMemoryStats())
+	defer sm.DeInit()
+
+	// the store is stuck on its first write
+	started, release := make(chan struct{}), make(chan struct{})
+	sm.Go(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	written := 0
+	queued := make(chan struct{})
+	go func() {
+		for range STATS_QUEUE_SIZE + 5 {
+			sm.Go(func() { written++ })
+		}
+		close(queued)
+	}()
+	select {
+	case <-queued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queueing a write waited for the store")
+	}
+
+	close(release)
+	sm.Flush()
+	if written != STATS_QUEUE_SIZE {
+		t.Fatalf("%d writes were written, expected the %d that fit in the queue", written, STATS_QUEUE_SIZE)
+	}
+	if sm.queue.dropped != 5 {
+		t.Fatalf("%d writes were dropped, expected 5", sm.queue.dropped)
+	}
+}
+
+func TestSaveJoined(t *testing.T) {
+	store := NewMemoryStats()
+	sm := newTestStatsManager(store)
+	defer sm.DeInit()
+
+	returning := make(chan bool, 2)
+	sm.SaveJoined(NewPlayer("a", "first"), func(r bool) { returning <- r })
+	sm.Flush()
+	if <-returning {
+		t.Fatal("a new player was returning")
+	}
+	first, _ := store.GetPlayer("a")
+
+	sm.SaveJoined(NewPlayer("a", "second"), func(r bool) { returning <- r })
+	sm.Flush()
+	if !<-returning {
+		t.Fatal("a player who played before was not returning")
+	}
+	player, _ := store.GetPlayer("a")
+	if player.Username != "second" {
+		t.Fatalf("the new name was not saved, got '%s'", player.Username)
+	}
+	if !player.Created_at.Equal(first.Created_at) {
+		t.Fatal("a returning player was saved as new")
+	}
+}
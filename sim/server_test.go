@@ -0,0 +1,316 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gotanks/shared"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswordChallenges(t *testing.T) {
+	challenges := PasswordChallenges{m: make(map[string]PasswordChallenge)}
+	now := time.Now()
+	ip := net.ParseIP("10.0.0.1")
+
+	challenge, ok, err := challenges.Issue("a", ip, now)
+	if err != nil || !ok {
+		t.Fatalf("first challenge: ok %v, err %v", ok, err)
+	}
+	answered, ok := challenges.Take("a", now.Add(CHALLENGE_TTL/2))
+	if !ok || !bytes.Equal(answered, challenge) {
+		t.Fatal("challenge answered in time was not found")
+	}
+	if _, ok := challenges.Take("a", now); ok {
+		t.Fatal("a challenge could be answered twice")
+	}
+
+	challenges.Issue("late", ip, now)
+	if _, ok := challenges.Take("late", now.Add(CHALLENGE_TTL+time.Second)); ok {
+		t.Fatal("an expired challenge could be answered")
+	}
+}
+
+func TestPasswordChallengesAreCapped(t *testing.T) {
+	challenges := PasswordChallenges{m: make(map[string]PasswordChallenge)}
+	now := time.Now()
+	ip := net.ParseIP("10.0.0.1")
+
+	for i := range MAX_CHALLENGES_PER_IP {
+		_, ok, _ := challenges.Issue(fmt.Sprint(i), ip, now)
+		if !ok {
+			t.Fatalf("challenge %d was refused", i)
+		}
+	}
+	if _, ok, _ := challenges.Issue("one too many", ip, now); ok {
+		t.Fatal("an ip got more challenges than MAX_CHALLENGES_PER_IP")
+	}
+	if _, ok, _ := challenges.Issue("0", ip, now); !ok {
+		t.Fatal("asking again for a challenge should replace the old one")
+	}
+
+	for i := 0; len(challenges.m) < MAX_CHALLENGES; i++ {
+		challenges.Issue(fmt.Sprint("flood", i), net.IPv4(10, 1, byte(i/256), byte(i%256)), now)
+	}
+	if _, ok, _ := challenges.Issue("one too many", net.ParseIP("10.2.0.1"), now); ok {
+		t.Fatal("more than MAX_CHALLENGES challenges were handed out")
+	}
+
+	challenges.Prune(now.Add(CHALLENGE_TTL + time.Second))
+	if len(challenges.m) != 0 {
+		t.Fatalf("%d expired challenges are left after pruning", len(challenges.m))
+	}
+}
+
+func TestStartServerStopsWhenCancelled(t *testing.T) {
+	// levels are loaded relative to the repository root
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// stands in for the mediator
+	probe, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer probe.Close()
+	// find a free port to host on
+	free, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("0.0.0.0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	free.Close()
+
+	config := DefaultServerConfig()
+	config.Port = free.LocalAddr().(*net.UDPAddr).Port
+	config.Mediators = []string{probe.LocalAddr().String()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- StartServer(ctx, config)
+	}()
+	defer cancel()
+
+	// the server registers with the mediator once it is up
+	probe.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	_, _, err = probe.ReadFromUDP(buf)
+	if err != nil {
+		select {
+		case err = <-done:
+		default:
+		}
+		t.Fatalf("server did not start: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server kept running after being cancelled")
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("0.0.0.0"), Port: config.Port})
+	if err != nil {
+		t.Fatalf("server did not let go of its port: %v", err)
+	}
+	conn.Close()
+}
+
+func TestPasswordServerIgnoresPlayersBeforeNegotiating(t *testing.T) {
+	room := newTestHost(t, 1).rooms[0]
+	room.config.Password = "secret"
+	player := newTestPlayer(t, 1)
+
+	// the lobby keeps the connection alive while negotiating
+	room.handle(player.packet(t, shared.PacketTypeKeepAlive, []byte{}))
+	player.expectNothing(t)
+
+	room.handle(player.negotiate(t, 0, "tester"))
+	var negotiation shared.NegotiateData
+	player.expect(t, shared.PacketTypeNegotiate, &negotiation)
+	if len(negotiation.Challenge) == 0 {
+		t.Fatal("expected a password challenge")
+	}
+
+	proof := shared.PasswordProof("secret", negotiation.Challenge, player.auth)
+	room.handle(player.packet(t, shared.PacketTypeNegotiate, shared.NegotiateData{Username: "tester", Proof: proof}))
+	player.expect(t, shared.PacketTypeNegotiate, &negotiation)
+	if !negotiation.Accepted {
+		t.Fatal("the right password was not accepted")
+	}
+}
+
+func TestNegotiatedNameIsUsed(t *testing.T) {
+	room := newTestHost(t, 1).rooms[0]
+	player := newTestPlayer(t, 1)
+
+	// the lobby sends keepalives before it negotiates
+	room.handle(player.packet(t, shared.PacketTypeKeepAlive, []byte{}))
+	if len(room.connected_players.m) != 0 {
+		t.Fatal("a keepalive let a player join")
+	}
+
+	room.handle(player.negotiate(t, 0, "chosen"))
+	var negotiation shared.NegotiateData
+	player.expect(t, shared.PacketTypeNegotiate, &negotiation)
+	if !negotiation.Accepted {
+		t.Fatal("negotiation was not accepted")
+	}
+	if name := room.connected_players.m[player.key()].player.Username; name != "chosen" {
+		t.Fatalf("player joined as '%s'", name)
+	}
+
+	// negotiating again under another name renames them
+	room.handle(player.negotiate(t, 0, "renamed"))
+	player.expect(t, shared.PacketTypeNegotiate, &negotiation)
+	if name := room.connected_players.m[player.key()].player.Username; name != "renamed" {
+		t.Fatalf("player is still called '%s'", name)
+	}
+	room.sm.Flush()
+	if stored, _ := room.sm.store.GetPlayer(player.key()); stored == nil || stored.Username != "renamed" {
+		t.Fatalf("the new name was not saved: %+v", stored)
+	}
+}
+
+func TestNegotiatingTakenName(t *testing.T) {
+	room := newTestHost(t, 1).rooms[0]
+	first, second := newTestPlayer(t, 1), newTestPlayer(t, 2)
+	room.handle(first.negotiate(t, 0, "tester"))
+	first.expect(t, shared.PacketTypeNegotiate, nil)
+	room.handle(second.negotiate(t, 0, "other"))
+	second.expect(t, shared.PacketTypeNegotiate, nil)
+
+	tests := []struct {
+		name     string
+		username string
+		reason   string
+	}{
+		{"same name", "tester", "taken"},
+		{"other case", "TESTER", "taken"},
+		{"invalid name", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newcomer := newTestPlayer(t, 3)
+			room.handle(newcomer.negotiate(t, 0, test.username))
+			var rejection shared.RejectionData
+			newcomer.expect(t, shared.PacketTypeConnectionRejected, &rejection)
+			if !strings.Contains(rejection.Reason, test.reason) {
+				t.Fatalf("unexpected reason '%s'", rejection.Reason)
+			}
+			if _, ok := room.connected_players.m[newcomer.key()]; ok {
+				t.Fatal("player joined anyway")
+			}
+
+			// renaming to it is no different
+			room.handle(second.negotiate(t, 0, test.username))
+			second.expect(t, shared.PacketTypeConnectionRejected, &rejection)
+			if name := room.connected_players.m[second.key()].player.Username; name != "other" {
+				t.Fatalf("player was renamed to '%s'", name)
+			}
+		})
+	}
+
+	// a player keeps their own name, in any case
+	room.handle(first.negotiate(t, 0, "Tester"))
+	first.expect(t, shared.PacketTypeNegotiate, nil)
+}
+
+func TestNegotiatingWhileTheLoopRuns(t *testing.T) {
+	room := newTestHost(t, 1).rooms[0]
+	room.levels = make([]Level, 2)
+	room.config.Maps = []int{1, 2}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		room.StartServerLogic(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	room.do(ctx, func() {
+		room.state = ServerGameStatePlaying
+		room.current_level = 1
+	})
+
+	// the loop keeps ticking while they join
+	for i := range 3 {
+		player := newTestPlayer(t, byte(i+1))
+		room.handle(player.negotiate(t, 0, fmt.Sprint("player", i)))
+
+		var spectate SpectateEvent
+		player.expect(t, shared.PacketTypeSpectate, &spectate)
+		if spectate.State != ServerGameStatePlaying || spectate.Level != LevelEnum(1) {
+			t.Fatalf("joined a match of %+v", spectate)
+		}
+		player.expect(t, shared.PacketTypeNegotiate, nil)
+	}
+}
+
+// runs the state machine of room once, as a tick does, expecting it to
+// move on to state
+func step(t *testing.T, room *Server, state ServerGameStateEnum) {
+	t.Helper()
+	prior := room.state
+	if next := room.CheckServerState(); next != state {
+		t.Fatalf("expected %v after %v, got %v", state, prior, next)
+	}
+	room.stateChanged(prior, state)
+}
+
+func TestRoundWithoutSurvivors(t *testing.T) {
+	room := newTestHost(t, 1).rooms[0]
+	level, err := LoadLevel("../assets/tiled/level_1.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	room.levels = []Level{level}
+	room.config.Maps = []int{1}
+	room.config.New_level_interval_s = 0
+	for i := range 2 {
+		player := newTestPlayer(t, byte(i+1))
+		room.connected_players.m[player.key()] = ConnectedPlayer{
+			addr:   player.conn.LocalAddr().(*net.UDPAddr),
+			player: NewPlayer(player.key(), fmt.Sprint("player", i)),
+			ready:  NetBoolTrue,
+		}
+	}
+	for _, state := range []ServerGameStateEnum{ServerGameStateStartingNewMatch, ServerGameStateStartingNewRound, ServerGameStatePlaying} {
+		room.wait_time = time.Time{}
+		step(t, room, state)
+	}
+
+	// both are shot in the same tick
+	for key, player := range room.connected_players.m {
+		player.tank.Kill()
+		room.connected_players.m[key] = player
+	}
+	room.wait_time = time.Time{}
+	step(t, room, ServerGameStateStartingNewRound)
+
+	round := room.sm.stats.Rounds[len(room.sm.stats.Rounds)-1]
+	if round.Winner_ID.Valid {
+		t.Fatalf("a round nobody survived was won by %s", round.Winner_ID.String)
+	}
+	if _, wins := room.GetHighestWinCount(); wins != 0 {
+		t.Fatalf("a drawn round counted as %d wins", wins)
+	}
+}
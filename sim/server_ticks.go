@@ -0,0 +1,144 @@
+package sim
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// how many ticks a server that fell behind runs back to back to catch up,
+	// beyond that the missed ticks are dropped
+	MAX_CATCH_UP_TICKS = 5
+	// how often a room that could not keep up logs it
+	TICK_REPORT_INTERVAL = time.Minute
+)
+
+// upper bounds of the tick durations counted in TickReport.Durations,
+// a tick at 60 per second has 16.6ms
+var TICK_DURATION_BUCKETS = [...]time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	2 * time.Millisecond,
+	4 * time.Millisecond,
+	8 * time.Millisecond,
+	16 * time.Millisecond,
+	32 * time.Millisecond,
+	64 * time.Millisecond,
+	128 * time.Millisecond,
+}
+
+type TickReport struct {
+	Ticks uint64
+	// ticks which took longer than the time they had
+	Overruns uint64
+	// ticks dropped because the server fell too far behind
+	Skipped uint64
+	// Durations[i] counts the ticks which took at most TICK_DURATION_BUCKETS[i]
+	// and longer than the bucket before, longer ticks are only in Ticks
+	Durations [len(TICK_DURATION_BUCKETS)]uint64
+	Total     time.Duration
+}
+
+// how well a room keeps up with its tick rate
+type TickStats struct {
+	sync.Mutex
+	report TickReport
+	// what was last logged
+	logged TickReport
+	// the longest tick since then
+	longest time.Duration
+}
+
+func (t *TickStats) record(took, budget time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	t.report.Ticks++
+	if took > budget {
+		t.report.Overruns++
+	}
+	t.longest = max(t.longest, took)
+	t.report.Total += took
+	for i, bucket := range TICK_DURATION_BUCKETS {
+		if took <= bucket {
+			t.report.Durations[i]++
+			break
+		}
+	}
+}
+
+func (t *TickStats) skip(ticks uint64) {
+	t.Lock()
+	defer t.Unlock()
+	t.report.Skipped += ticks
+}
+
+func (t *TickStats) Report() TickReport {
+	t.Lock()
+	defer t.Unlock()
+	return t.report
+}
+
+// logs the overruns and skips since the last call, if there were any,
+// with the longest tick in that time
+func (t *TickStats) logChanges(logger *slog.Logger) {
+	t.Lock()
+	defer t.Unlock()
+	overruns := t.report.Overruns - t.logged.Overruns
+	skipped := t.report.Skipped - t.logged.Skipped
+	longest := t.longest
+	t.logged = t.report
+	t.longest = 0
+	if overruns == 0 && skipped == 0 {
+		return
+	}
+	logger.Warn("room is not keeping up", "overruns", overruns, "skipped", skipped, "longest", longest)
+}
+
+// runs UpdateServerLogic Tick_rate times a second until ctx is cancelled.
+// ticks happen on a fixed schedule, a slow tick is made up for by running
+// the next ones back to back instead of slowing the game down
+func (s *Server) StartServerLogic(ctx context.Context) {
+	budget := s.config.tickDuration()
+	next_tick := time.Now()
+	last_report := time.Now()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f := <-s.admin_channel:
+			// the timer is still running
+			f()
+			s.publish()
+			continue
+		case <-timer.C:
+		}
+
+		caught_up := 0
+		for !time.Now().Before(next_tick) {
+			if caught_up == MAX_CATCH_UP_TICKS {
+				missed := time.Since(next_tick)/budget + 1
+				s.tick_stats.skip(uint64(missed))
+				next_tick = next_tick.Add(missed * budget)
+				break
+			}
+
+			start := time.Now()
+			s.UpdateServerLogic()
+			s.publish()
+			s.tick_stats.record(time.Since(start), budget)
+			next_tick = next_tick.Add(budget)
+			caught_up++
+		}
+
+		if time.Since(last_report) >= TICK_REPORT_INTERVAL {
+			s.tick_stats.logChanges(s.log)
+			last_report = time.Now()
+		}
+		timer.Reset(time.Until(next_tick))
+	}
+}
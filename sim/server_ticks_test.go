@@ -0,0 +1,60 @@
+package sim
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTickStatsLogChanges(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+	budget := 10 * time.Millisecond
+	stats := TickStats{}
+
+	stats.record(50*time.Millisecond, budget)
+	stats.record(time.Millisecond, budget)
+	stats.logChanges(logger)
+	if !strings.Contains(out.String(), "overruns=1") || !strings.Contains(out.String(), "longest=50ms") {
+		t.Fatalf("unexpected log line: %s", out.String())
+	}
+
+	out.Reset()
+	stats.record(time.Millisecond, budget)
+	stats.logChanges(logger)
+	if out.Len() != 0 {
+		t.Fatalf("logged without any overruns: %s", out.String())
+	}
+
+	// the longest tick is only about the time since the last line
+	stats.record(20*time.Millisecond, budget)
+	stats.logChanges(logger)
+	if !strings.Contains(out.String(), "overruns=1") || !strings.Contains(out.String(), "longest=20ms") {
+		t.Fatalf("unexpected log line: %s", out.String())
+	}
+
+	report := stats.Report()
+	if report.Ticks != 4 || report.Overruns != 2 {
+		t.Fatalf("the report counts from the start, got %+v", report)
+	}
+}
+
+func TestBulletsMoveTheSameAtAnyTickRate(t *testing.T) {
+	level := &Level{}
+	for _, rate := range TICK_RATES {
+		config := DefaultServerConfig()
+		config.Tick_rate = rate
+
+		bm := BulletManager{bullets: map[string]StandardBullet{}}
+		bm.AddBullet(StandardBullet{ID: "a", Velocity: 1.5, Num_bounces: 1})
+		for range rate {
+			bm.Update(level, config.physicsStep(), nil)
+		}
+		bullet := bm.bullets["a"]
+		if bullet.Y != 1.5*PHYSICS_TICK_RATE {
+			t.Errorf("at %d ticks per second a bullet moved %v in a second", rate, bullet.Y)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package sim
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// narrows down the history read from a SQLiteStats,
+// zero values match everything
+type HistoryFilter struct {
+	// From is inclusive, To is not
+	From time.Time
+	To   time.Time
+	// as in ServerConfig.Maps, starting at 1
+	Map int
+	// id or name of a player taking part
+	Player string
+}
+
+type MatchRecord struct {
+	Match_ID    string
+	Start_time  time.Time
+	End_time    *time.Time
+	Winner_ID   string
+	Winner_name string
+	// players rated for it, 0 for matches from before ratings
+	Players int
+	Rounds  int
+}
+
+type RoundRecord struct {
+	Round_ID    string
+	Match_ID    string
+	Map         int
+	Winner_ID   string
+	Winner_name string
+	Kills       int
+}
+
+type KillRecord struct {
+	Kill_ID     string
+	Round_ID    string
+	Match_ID    string
+	Map         int
+	Time        time.Time
+	Killer_ID   string
+	Killer_name string
+	Victim_ID   string
+	Victim_name string
+	// empty for kills from before loadouts were recorded, or when the
+	// killer had left
+	Killer_loadout Loadout
+	Bullet         string
+}
+
+// sql conditions and their arguments, joined with AND
+type conditions struct {
+	where []string
+	args  []any
+}
+
+func (c *conditions) add(condition string, args ...any) {
+	c.where = append(c.where, condition)
+	c.args = append(c.args, args...)
+}
+
+func (c *conditions) String() string {
+	if len(c.where) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(c.where, " AND ")
+}
+
+// the ids of everyone called player, or with player as their id
+func (s *SQLiteStats) playerIds(player string) ([]any, string, error) {
+	rows, err := s.db.Query("SELECT player_id FROM players WHERE player_id = ? OR username = ?", player, player)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	ids := []any{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(ids) == 0 {
+		return nil, "", fmt.Errorf("no player '%s'", player)
+	}
+	return ids, "(" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")", nil
+}
+
+// the conditions filter puts on a query over matches m and,
+// if round is set, rounds r
+func (s *SQLiteStats) matchConditions(filter HistoryFilter, round bool) (*conditions, error) {
+	c := &conditions{}
+	// julianday compares times written with different offsets
+	if !filter.From.IsZero() {
+		c.add("julianday(m.start_time) >= julianday(?)", filter.From)
+	}
+	if !filter.To.IsZero() {
+		c.add("julianday(m.start_time) < julianday(?)", filter.To)
+	}
+	if filter.Map != 0 {
+		if round {
+			c.add("r.level = ?", filter.Map-1)
+		} else {
+			c.add("EXISTS (SELECT 1 FROM rounds fr WHERE fr.match_id = m.match_id AND fr.level = ?)", filter.Map-1)
+		}
+	}
+	if filter.Player != "" {
+		ids, in, err := s.playerIds(filter.Player)
+		if err != nil {
+			return nil, err
+		}
+		c.add("(EXISTS (SELECT 1 FROM match_players fp WHERE fp.match_id = m.match_id AND fp.player_id IN "+in+") OR m.winner_id IN "+in+")",
+			append(ids, ids...)...)
+	}
+	return c, nil
+}
+
+func (s *SQLiteStats) MatchHistory(filter HistoryFilter) ([]MatchRecord, error) {
+	c, err := s.matchConditions(filter, false)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT m.match_id, m.start_time, m.end_time, COALESCE(m.winner_id, ''), COALESCE(p.username, ''),
+			(SELECT COUNT(*) FROM match_players mp WHERE mp.match_id = m.match_id),
+			(SELECT COUNT(*) FROM rounds r WHERE r.match_id = m.match_id)
+		FROM matches m
+		LEFT JOIN players p ON p.player_id = m.winner_id
+		`+c.String()+`
+		ORDER BY julianday(m.start_time)`, c.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []MatchRecord{}
+	for rows.Next() {
+		var record MatchRecord
+		var end_time sql.NullTime
+		err := rows.Scan(&record.Match_ID, &record.Start_time, &end_time, &record.Winner_ID, &record.Winner_name, &record.Players, &record.Rounds)
+		if err != nil {
+			return nil, err
+		}
+		if end_time.Valid {
+			record.End_time = &end_time.Time
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *SQLiteStats) RoundHistory(filter HistoryFilter) ([]RoundRecord, error) {
+	c, err := s.matchConditions(filter, true)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT r.round_id, r.match_id, r.level, COALESCE(r.winner_id, ''), COALESCE(p.username, ''),
+			(SELECT COUNT(*) FROM kill_events k WHERE k.round_id = r.round_id)
+		FROM rounds r
+		JOIN matches m ON m.match_id = r.match_id
+		LEFT JOIN players p ON p.player_id = r.winner_id
+		`+c.String()+`
+		ORDER BY julianday(m.start_time), r.rowid`, c.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []RoundRecord{}
+	for rows.Next() {
+		var record RoundRecord
+		var level LevelEnum
+		err := rows.Scan(&record.Round_ID, &record.Match_ID, &level, &record.Winner_ID, &record.Winner_name, &record.Kills)
+		if err != nil {
+			return nil, err
+		}
+		record.Map = int(level) + 1
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// kills are matched by their own time rather than their match's, and by
+// who killed or died instead of who played
+func (s *SQLiteStats) KillHistory(filter HistoryFilter) ([]KillRecord, error) {
+	c := &conditions{}
+	if !filter.From.IsZero() {
+		c.add("julianday(k.time_stamp) >= julianday(?)", filter.From)
+	}
+	if !filter.To.IsZero() {
+		c.add("julianday(k.time_stamp) < julianday(?)", filter.To)
+	}
+	if filter.Map != 0 {
+		c.add("r.level = ?", filter.Map-1)
+	}
+	if filter.Player != "" {
+		ids, in, err := s.playerIds(filter.Player)
+		if err != nil {
+			return nil, err
+		}
+		c.add("(k.killer_id IN "+in+" OR k.victim_id IN "+in+")", append(ids, ids...)...)
+	}
+
+	rows, err := s.db.Query(`SELECT k.kill_id, k.round_id, r.match_id, r.level, k.time_stamp,
+			k.killer_id, COALESCE(pk.username, ''), k.victim_id, COALESCE(pv.username, ''),
+			k.killer_loadout, k.bullet_type
+		FROM kill_events k
+		JOIN rounds r ON r.round_id = k.round_id
+		LEFT JOIN players pk ON pk.player_id = k.killer_id
+		LEFT JOIN players pv ON pv.player_id = k.victim_id
+		`+c.String()+`
+		ORDER BY julianday(k.time_stamp)`, c.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []KillRecord{}
+	for rows.Next() {
+		var record KillRecord
+		var level LevelEnum
+		var loadout uint32
+		var bullet_type StandardBulletTypeEnum
+		err := rows.Scan(&record.Kill_ID, &record.Round_ID, &record.Match_ID, &level, &record.Time,
+			&record.Killer_ID, &record.Killer_name, &record.Victim_ID, &record.Victim_name,
+			&loadout, &bullet_type)
+		if err != nil {
+			return nil, err
+		}
+		record.Map = int(level) + 1
+		if loadout != 0 {
+			record.Killer_loadout = Component{Config: loadout}.Loadout()
+		}
+		if bullet_type != 0 {
+			record.Bullet = DetermineBulletName(bullet_type)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,137 @@
+package sim
+
+import (
+	"cmp"
+	"gotanks/shared"
+	"math"
+	"slices"
+	"sync"
+)
+
+// stats kept in memory until the server stops, also handy for tests
+type MemoryStats struct {
+	sync.RWMutex
+	players map[string]Player
+	matches map[string]Match
+	rounds  map[string]Round
+	kills   []KillEvent
+	results []MatchResult
+}
+
+func NewMemoryStats() *MemoryStats {
+	return &MemoryStats{
+		players: make(map[string]Player),
+		matches: make(map[string]Match),
+		rounds:  make(map[string]Round),
+	}
+}
+
+func (s *MemoryStats) GetPlayer(id string) (*Player, error) {
+	s.RLock()
+	defer s.RUnlock()
+	player, ok := s.players[id]
+	if !ok {
+		return nil, nil
+	}
+	return &player, nil
+}
+
+func (s *MemoryStats) SavePlayer(p Player) error {
+	s.Lock()
+	defer s.Unlock()
+	// the first save decides when a player was created, like the sql store
+	if existing, ok := s.players[p.Player_ID]; ok {
+		p.Created_at = existing.Created_at
+		p.Rating = existing.Rating
+	}
+	s.players[p.Player_ID] = p
+	return nil
+}
+
+func (s *MemoryStats) SaveMatch(m Match) error {
+	s.Lock()
+	defer s.Unlock()
+	s.matches[m.Match_ID] = m
+	return nil
+}
+
+func (s *MemoryStats) SaveRound(r Round) error {
+	s.Lock()
+	defer s.Unlock()
+	s.rounds[r.Round_ID] = r
+	return nil
+}
+
+func (s *MemoryStats) SaveKillEvent(k KillEvent) error {
+	s.Lock()
+	defer s.Unlock()
+	if slices.ContainsFunc(s.kills, func(kill KillEvent) bool { return kill.Kill_ID == k.Kill_ID }) {
+		return nil
+	}
+	s.kills = append(s.kills, k)
+	return nil
+}
+
+func (s *MemoryStats) SaveMatchResults(results []MatchResult) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, result := range results {
+		rated := slices.ContainsFunc(s.results, func(r MatchResult) bool {
+			return r.Match_ID == result.Match_ID && r.Player_ID == result.Player_ID
+		})
+		if rated {
+			continue
+		}
+		s.results = append(s.results, result)
+		if player, ok := s.players[result.Player_ID]; ok {
+			player.Rating = result.Rating_after
+			s.players[result.Player_ID] = player
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStats) Leaderboard(limit int) ([]shared.LeaderboardEntry, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	entries := map[string]*shared.LeaderboardEntry{}
+	for _, result := range s.results {
+		player, ok := s.players[result.Player_ID]
+		if !ok {
+			continue
+		}
+		entry, ok := entries[result.Player_ID]
+		if !ok {
+			entry = &shared.LeaderboardEntry{Username: player.Username, Rating: int(math.Round(player.Rating))}
+			entries[result.Player_ID] = entry
+		}
+		entry.Matches++
+		if s.matches[result.Match_ID].Winner_ID.String == result.Player_ID {
+			entry.Wins++
+		}
+	}
+	for _, kill := range s.kills {
+		if entry, ok := entries[kill.Killer_ID]; ok && kill.Killer_ID != kill.Victim_ID {
+			entry.Kills++
+		}
+		if entry, ok := entries[kill.Victim_ID]; ok {
+			entry.Deaths++
+		}
+	}
+
+	board := []shared.LeaderboardEntry{}
+	for _, entry := range entries {
+		board = append(board, *entry)
+	}
+	slices.SortFunc(board, func(a, b shared.LeaderboardEntry) int {
+		return cmp.Compare(b.Rating, a.Rating)
+	})
+	return board[:min(limit, len(board))], nil
+}
+
+func (s *MemoryStats) Close() error {
+	return nil
+}
+
+var _ StatsStore = (*MemoryStats)(nil)
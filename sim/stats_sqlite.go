@@ -0,0 +1,272 @@
+package sim
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"gotanks/shared"
+	"math"
+	"os"
+
+	// pure go, servers build without cgo
+	_ "modernc.org/sqlite"
+)
+
+// every schema change is appended here, applied migrations are
+// tracked with sqlite's user_version
+var sqlite_migrations = []string{
+	`CREATE TABLE players (
+		player_id  TEXT PRIMARY KEY,
+		username   TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE TABLE matches (
+		match_id   TEXT PRIMARY KEY,
+		start_time DATETIME NOT NULL,
+		end_time   DATETIME,
+		winner_id  TEXT
+	);
+	CREATE TABLE rounds (
+		round_id  TEXT PRIMARY KEY,
+		match_id  TEXT NOT NULL REFERENCES matches (match_id),
+		winner_id TEXT,
+		level     INTEGER NOT NULL
+	);
+	CREATE TABLE kill_events (
+		kill_id    TEXT PRIMARY KEY,
+		round_id   TEXT NOT NULL REFERENCES rounds (round_id),
+		killer_id  TEXT NOT NULL,
+		victim_id  TEXT NOT NULL,
+		time_stamp DATETIME NOT NULL
+	);
+	CREATE INDEX rounds_match_id ON rounds (match_id);
+	CREATE INDEX kill_events_round_id ON kill_events (round_id);`,
+
+	`ALTER TABLE players ADD COLUMN rating REAL NOT NULL DEFAULT 1000;
+	CREATE TABLE match_players (
+		match_id      TEXT NOT NULL REFERENCES matches (match_id),
+		player_id     TEXT NOT NULL REFERENCES players (player_id),
+		rating_before REAL NOT NULL,
+		rating_after  REAL NOT NULL,
+		PRIMARY KEY (match_id, player_id)
+	);
+	CREATE INDEX match_players_player_id ON match_players (player_id);
+	CREATE INDEX kill_events_killer_id ON kill_events (killer_id);
+	CREATE INDEX kill_events_victim_id ON kill_events (victim_id);`,
+
+	`ALTER TABLE kill_events ADD COLUMN killer_loadout INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE kill_events ADD COLUMN bullet_type INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX matches_start_time ON matches (start_time);`,
+}
+
+// stats kept in a local sqlite database
+type SQLiteStats struct {
+	db *sql.DB
+}
+
+// opens the database at path, creating it if needed, and brings its
+// schema up to date
+func OpenSQLiteStats(path string) (*SQLiteStats, error) {
+	// waits on other writers instead of failing right away
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_time_format=sqlite", path))
+	if err != nil {
+		return nil, err
+	}
+	// sqlite only has one writer at a time anyway
+	db.SetMaxOpenConns(1)
+
+	stats := &SQLiteStats{db: db}
+	err = stats.migrate()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating %s: %w", path, err)
+	}
+	return stats, nil
+}
+
+// opens the database at path for reading only, leaving it as it is.
+// it has to have been brought up to date by a server of this version
+func OpenSQLiteStatsReadOnly(path string) (*SQLiteStats, error) {
+	// sqlite has no clear error for a missing file
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout(5000)&_time_format=sqlite", path))
+	if err != nil {
+		return nil, err
+	}
+
+	var version int
+	err = db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if version != len(sqlite_migrations) {
+		db.Close()
+		return nil, fmt.Errorf("%s is at version %d, expected %d, a server of this version migrates it when started on it", path, version, len(sqlite_migrations))
+	}
+	return &SQLiteStats{db: db}, nil
+}
+
+func (s *SQLiteStats) migrate() error {
+	var version int
+	err := s.db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version > len(sqlite_migrations) {
+		return fmt.Errorf("database is at version %d, this server only knows %d", version, len(sqlite_migrations))
+	}
+
+	for i := version; i < len(sqlite_migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(sqlite_migrations[i])
+		if err == nil {
+			// pragmas do not take parameters
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStats) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStats) GetPlayer(id string) (*Player, error) {
+	var player Player
+	row := s.db.QueryRow("SELECT player_id, username, created_at, updated_at, rating FROM players WHERE player_id = ?", id)
+	err := row.Scan(&player.Player_ID, &player.Username, &player.Created_at, &player.Updated_at, &player.Rating)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &player, nil
+}
+
+func (s *SQLiteStats) SavePlayer(p Player) error {
+	_, err := s.db.Exec(`INSERT INTO players (player_id, username, created_at, updated_at, rating) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (player_id) DO UPDATE SET username = excluded.username, updated_at = excluded.updated_at`,
+		p.Player_ID,
+		p.Username,
+		p.Created_at,
+		p.Updated_at,
+		p.Rating,
+	)
+	return err
+}
+
+func (s *SQLiteStats) SaveMatch(m Match) error {
+	end_time := sql.NullTime{Time: m.End_time, Valid: !m.End_time.IsZero()}
+	// rounds point at matches, replacing a row would break them
+	_, err := s.db.Exec(`INSERT INTO matches (match_id, start_time, end_time, winner_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (match_id) DO UPDATE SET end_time = excluded.end_time, winner_id = excluded.winner_id`,
+		m.Match_ID,
+		m.Start_time,
+		end_time,
+		m.Winner_ID,
+	)
+	return err
+}
+
+func (s *SQLiteStats) SaveRound(r Round) error {
+	_, err := s.db.Exec(`INSERT INTO rounds (round_id, match_id, winner_id, level) VALUES (?, ?, ?, ?)
+		ON CONFLICT (round_id) DO UPDATE SET winner_id = excluded.winner_id`,
+		r.Round_ID,
+		r.Match_ID,
+		r.Winner_ID,
+		r.Level,
+	)
+	return err
+}
+
+func (s *SQLiteStats) SaveKillEvent(k KillEvent) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO kill_events (kill_id, round_id, killer_id, victim_id, time_stamp, killer_loadout, bullet_type)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		k.Kill_ID,
+		k.Round_ID,
+		k.Killer_ID,
+		k.Victim_ID,
+		k.Timestamp,
+		k.Killer_loadout,
+		k.Bullet_type,
+	)
+	return err
+}
+
+func (s *SQLiteStats) SaveMatchResults(results []MatchResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, result := range results {
+		res, err := tx.Exec("INSERT OR IGNORE INTO match_players (match_id, player_id, rating_before, rating_after) VALUES (?, ?, ?, ?)",
+			result.Match_ID,
+			result.Player_ID,
+			result.Rating_before,
+			result.Rating_after,
+		)
+		if err != nil {
+			return err
+		}
+		// already rated
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		_, err = tx.Exec("UPDATE players SET rating = ? WHERE player_id = ?", result.Rating_after, result.Player_ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStats) Leaderboard(limit int) ([]shared.LeaderboardEntry, error) {
+	rows, err := s.db.Query(`SELECT p.username, p.rating,
+			(SELECT COUNT(*) FROM match_players mp WHERE mp.player_id = p.player_id),
+			(SELECT COUNT(*) FROM match_players mp JOIN matches m ON m.match_id = mp.match_id
+				WHERE mp.player_id = p.player_id AND m.winner_id = p.player_id),
+			(SELECT COUNT(*) FROM kill_events k WHERE k.killer_id = p.player_id AND k.victim_id != p.player_id),
+			(SELECT COUNT(*) FROM kill_events k WHERE k.victim_id = p.player_id)
+		FROM players p
+		WHERE EXISTS (SELECT 1 FROM match_players mp WHERE mp.player_id = p.player_id)
+		ORDER BY p.rating DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []shared.LeaderboardEntry{}
+	for rows.Next() {
+		var entry shared.LeaderboardEntry
+		var rating float64
+		err := rows.Scan(&entry.Username, &rating, &entry.Matches, &entry.Wins, &entry.Kills, &entry.Deaths)
+		if err != nil {
+			return nil, err
+		}
+		entry.Rating = int(math.Round(rating))
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+var _ StatsStore = (*SQLiteStats)(nil)
@@ -0,0 +1,63 @@
+package sim
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenSQLiteStatsReadOnly(t *testing.T) {
+	dir := t.TempDir()
+
+	missing := filepath.Join(dir, "missing.db")
+	if _, err := OpenSQLiteStatsReadOnly(missing); err == nil {
+		t.Fatal("a database that does not exist was opened")
+	}
+	if _, err := os.Stat(missing); err == nil {
+		t.Fatal("opening read only created the database")
+	}
+
+	path := filepath.Join(dir, "stats.db")
+	stats, err := OpenSQLiteStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must(t, stats.SavePlayer(NewPlayer("a", "first")))
+	stats.Close()
+
+	stats, err = OpenSQLiteStatsReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player, err := stats.GetPlayer("a")
+	if err != nil || player == nil {
+		t.Fatalf("could not read a player: %v", err)
+	}
+	if err := stats.SavePlayer(NewPlayer("b", "second")); err == nil {
+		t.Fatal("wrote to a database opened read only")
+	}
+	stats.Close()
+}
+
+func TestOpenSQLiteStatsReadOnlyNeedsCurrentVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	stats, err := OpenSQLiteStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stats.db.Exec("PRAGMA user_version = 1")
+	must(t, err)
+	stats.Close()
+
+	_, err = OpenSQLiteStatsReadOnly(path)
+	if err == nil {
+		t.Fatal("a database that is not up to date was opened")
+	}
+
+	// trying did not migrate it
+	stats, err = OpenSQLiteStatsReadOnly(path)
+	if err == nil {
+		stats.Close()
+		t.Fatal("opening read only migrated the database")
+	}
+}
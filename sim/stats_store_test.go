@@ -0,0 +1,168 @@
+package sim
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// runs test against every StatsStore, each gets an empty store
+func testStores(t *testing.T, test func(t *testing.T, store StatsStore)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStats())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		store, err := OpenSQLiteStats(filepath.Join(t.TempDir(), "stats.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		test(t, store)
+	})
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// saves a player and a finished match they played, rated as rating
+func playMatch(t *testing.T, store StatsStore, player Player, rating float64, won bool) Match {
+	t.Helper()
+	must(t, store.SavePlayer(player))
+	match := Match{Match_ID: uuid.NewString(), Start_time: time.Now(), End_time: time.Now()}
+	if won {
+		match.Winner_ID = sql.NullString{String: player.Player_ID, Valid: true}
+	}
+	must(t, store.SaveMatch(match))
+	must(t, store.SaveMatchResults([]MatchResult{{Match_ID: match.Match_ID, Player_ID: player.Player_ID, Rating_before: player.Rating, Rating_after: rating}}))
+	return match
+}
+
+func TestStatsStorePlayers(t *testing.T) {
+	testStores(t, func(t *testing.T, store StatsStore) {
+		player, err := store.GetPlayer("unknown")
+		if err != nil || player != nil {
+			t.Fatalf("expected no player, got %v, %v", player, err)
+		}
+
+		created := time.Now().Add(-time.Hour).Truncate(time.Second)
+		first := NewPlayer("a", "first")
+		first.Created_at = created
+		must(t, store.SavePlayer(first))
+
+		again := NewPlayer("a", "second")
+		again.Rating = 2000
+		must(t, store.SavePlayer(again))
+
+		player, err = store.GetPlayer("a")
+		if err != nil || player == nil {
+			t.Fatalf("saved player was not found: %v", err)
+		}
+		if player.Username != "second" {
+			t.Fatalf("the name was not updated, got '%s'", player.Username)
+		}
+		if !player.Created_at.Equal(created) {
+			t.Fatalf("saving again changed when the player was created to %v", player.Created_at)
+		}
+		if player.Rating != INITIAL_RATING {
+			t.Fatalf("saving a player changed their rating to %v", player.Rating)
+		}
+	})
+}
+
+func TestStatsStoreUpsertsMatchesAndRounds(t *testing.T) {
+	testStores(t, func(t *testing.T, store StatsStore) {
+		player := NewPlayer("a", "first")
+		must(t, store.SavePlayer(player))
+
+		match := Match{Match_ID: uuid.NewString(), Start_time: time.Now()}
+		must(t, store.SaveMatch(match))
+		round := Round{Round_ID: uuid.NewString(), Match_ID: match.Match_ID, Level: 1}
+		must(t, store.SaveRound(round))
+		kill := KillEvent{Kill_ID: uuid.NewString(), Round_ID: round.Round_ID, Killer_ID: "a", Victim_ID: "b", Timestamp: time.Now()}
+		must(t, store.SaveKillEvent(kill))
+		// saved again once they are over
+		round.Winner_ID = sql.NullString{String: "a", Valid: true}
+		must(t, store.SaveRound(round))
+		match.End_time = time.Now()
+		match.Winner_ID = sql.NullString{String: "a", Valid: true}
+		must(t, store.SaveMatch(match))
+		must(t, store.SaveKillEvent(kill))
+		must(t, store.SaveMatchResults([]MatchResult{{Match_ID: match.Match_ID, Player_ID: "a", Rating_before: INITIAL_RATING, Rating_after: INITIAL_RATING + 10}}))
+
+		board, err := store.Leaderboard(10)
+		must(t, err)
+		if len(board) != 1 {
+			t.Fatalf("expected one player on the leaderboard, got %+v", board)
+		}
+		entry := board[0]
+		if entry.Matches != 1 || entry.Wins != 1 {
+			t.Fatalf("the match was not updated, got %+v", entry)
+		}
+		if entry.Kills != 1 {
+			t.Fatalf("a kill saved twice counted %d times", entry.Kills)
+		}
+	})
+}
+
+func TestStatsStoreRatesMatchOnce(t *testing.T) {
+	testStores(t, func(t *testing.T, store StatsStore) {
+		player := NewPlayer("a", "first")
+		match := playMatch(t, store, player, INITIAL_RATING+20, false)
+
+		// the same results again, as after a restart of the writer
+		must(t, store.SaveMatchResults([]MatchResult{{Match_ID: match.Match_ID, Player_ID: "a", Rating_before: INITIAL_RATING + 20, Rating_after: INITIAL_RATING + 40}}))
+
+		stored, err := store.GetPlayer("a")
+		must(t, err)
+		if stored.Rating != INITIAL_RATING+20 {
+			t.Fatalf("expected a rating of %v, got %v", INITIAL_RATING+20, stored.Rating)
+		}
+		board, err := store.Leaderboard(10)
+		must(t, err)
+		if len(board) != 1 || board[0].Matches != 1 {
+			t.Fatalf("a match rated twice was counted twice: %+v", board)
+		}
+	})
+}
+
+func TestStatsStoreLeaderboard(t *testing.T) {
+	testStores(t, func(t *testing.T, store StatsStore) {
+		board, err := store.Leaderboard(10)
+		must(t, err)
+		if len(board) != 0 {
+			t.Fatalf("expected an empty leaderboard, got %+v", board)
+		}
+
+		playMatch(t, store, NewPlayer("low", "low"), 900, false)
+		playMatch(t, store, NewPlayer("high", "high"), 1200, true)
+		playMatch(t, store, NewPlayer("middle", "middle"), 1050, false)
+		// players who never finished a match are left out
+		must(t, store.SavePlayer(NewPlayer("idle", "idle")))
+
+		board, err = store.Leaderboard(10)
+		must(t, err)
+		names := []string{}
+		for _, entry := range board {
+			names = append(names, entry.Username)
+		}
+		if len(names) != 3 || names[0] != "high" || names[1] != "middle" || names[2] != "low" {
+			t.Fatalf("expected high, middle, low, got %v", names)
+		}
+		if board[0].Rating != 1200 || board[0].Wins != 1 || board[2].Wins != 0 {
+			t.Fatalf("unexpected entries %+v", board)
+		}
+
+		board, err = store.Leaderboard(2)
+		must(t, err)
+		if len(board) != 2 || board[0].Username != "high" {
+			t.Fatalf("the limit was not applied: %+v", board)
+		}
+	})
+}
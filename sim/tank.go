@@ -0,0 +1,31 @@
+package sim
+
+const (
+	// we need this because GOB fails to decode values which are '0'
+	// so we need to do some tech to fix it
+	TANK_DEAD_VALUE = -1
+)
+
+// NOTE it's going to be annoing with gob not writing
+// 'nil' values i.e (0, 0.0, and worst of all 'false')
+
+// perhaps look for some way to deal with this in the future.
+// but for now we just try to avoid values being 0
+
+// a minimal struct for representing a tank.
+// this is used for sending over the network
+type TankMinimal struct {
+	Position
+	Component
+	Rotation        float64
+	Turret_rotation float64
+	Life            int
+}
+
+func (t *TankMinimal) Alive() bool {
+	return t.Life != -1
+}
+
+func (t *TankMinimal) Kill() {
+	t.Life = -1
+}
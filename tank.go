@@ -16,10 +16,6 @@ const (
 	TRACK_LIFETIME = 80
 	TRACK_INTERVAL = 3
 	TURRET_HEIGHT  = 4
-
-	// we need this because GOB fails to decode values which are '0'
-	// so we need to do some tech to fix it
-	TANK_DEAD_VALUE = -1
 )
 
 type Turret struct {
@@ -33,22 +29,6 @@ type Track struct {
 	lifetime int
 }
 
-// NOTE it's going to be annoing with gob not writing
-// 'nil' values i.e (0, 0.0, and worst of all 'false')
-
-// perhaps look for some way to deal with this in the future.
-// but for now we just try to avoid values being 0
-
-// a minimal struct for representing a tank.
-// this is used for sending over the network
-type TankMinimal struct {
-	Position
-	Component
-	Rotation        float64
-	Turret_rotation float64
-	Life            int
-}
-
 type Tank struct {
 	TankMinimal
 	sprites_path string
@@ -63,14 +43,6 @@ type Tank struct {
 	IsReloading          bool
 }
 
-func (t *TankMinimal) Alive() bool {
-	return t.Life != -1
-}
-
-func (t *TankMinimal) Kill() {
-	t.Life = -1
-}
-
 const RADIUS = 40
 
 var RADI_SPRITE = ebiten.NewImage(RADIUS, RADIUS)
@@ -85,17 +57,17 @@ func (t *Tank) GetDrawData(screen *ebiten.Image, g *Game, camera Camera, clr col
 	if t.Alive() {
 		g.context.draw_data = append(g.context.draw_data, DrawData{
 			path:      t.sprites_path,
-			position:  Position{x, y},
+			position:  Position{X: x, Y: y},
 			rotation:  t.Rotation - camera.rotation,
 			intensity: 1,
 			opacity:   1},
 		)
 		g.context.draw_data = append(g.context.draw_data, DrawData{
 			path:      t.turret.sprites_path,
-			position:  Position{x, y + 1},
+			position:  Position{X: x, Y: y + 1},
 			rotation:  *t.turret.rotation,
 			intensity: 1,
-			offset:    Position{0, -TURRET_HEIGHT},
+			offset:    Position{X: 0, Y: -TURRET_HEIGHT},
 			opacity:   1},
 		)
 		if int(g.time*100)%TRACK_INTERVAL == 0 {
@@ -148,7 +120,7 @@ func (t *Tank) GetDrawData(screen *ebiten.Image, g *Game, camera Camera, clr col
 	} else {
 		g.context.draw_data = append(g.context.draw_data, DrawData{
 			path:      t.dead_sprites_path,
-			position:  Position{x, y},
+			position:  Position{X: x, Y: y},
 			rotation:  t.Rotation - camera.rotation,
 			intensity: 1,
 			opacity:   1},
@@ -157,10 +129,10 @@ func (t *Tank) GetDrawData(screen *ebiten.Image, g *Game, camera Camera, clr col
 	}
 	g.context.draw_data = append(g.context.draw_data, DrawData{
 		sprite:    RADI_SPRITE,
-		position:  Position{x, y - 1},
+		position:  Position{X: x, Y: y - 1},
 		rotation:  0,
 		intensity: 1,
-		offset:    Position{0, 1},
+		offset:    Position{X: 0, Y: 1},
 		opacity:   1})
 
 }
@@ -185,7 +157,8 @@ func (t *Tank) TryMove(g *Game, speed float64) {
 
 }
 
-func (t *TankMinimal) TryAddSmoke(g *Game) {
+// puffs smoke out of a dead tank every few frames
+func TryAddSmoke(g *Game, t TankMinimal) {
 	if int(g.time*100)%9 == 0 {
 		offset := 4.
 		pos := t.Position
@@ -219,7 +192,7 @@ func (t *Tank) Update(g *Game) {
 			t.Rotation += ROTATION_SPEED
 		}
 	} else {
-		t.TryAddSmoke(g)
+		TryAddSmoke(g, t.TankMinimal)
 	}
 
 	g.CurrentLevel().gm.ApplyForce(t.X, t.Y)
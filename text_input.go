@@ -0,0 +1,47 @@
+package game
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+type TextInput struct {
+	value      []rune
+	max_length int
+	// hides what is typed, for passwords
+	masked bool
+}
+
+// reads this frame's typing, returns true once enter is pressed
+func (t *TextInput) Update() (submitted bool) {
+	t.value = ebiten.AppendInputChars(t.value)
+	if t.max_length > 0 && len(t.value) > t.max_length {
+		t.value = t.value[:t.max_length]
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(t.value) > 0 {
+		t.value = t.value[:len(t.value)-1]
+	}
+
+	return inpututil.IsKeyJustPressed(ebiten.KeyEnter)
+}
+
+func (t *TextInput) Reset() {
+	t.value = t.value[:0]
+}
+
+func (t *TextInput) String() string {
+	return string(t.value)
+}
+
+// what should be drawn, with a cursor at the end
+func (t *TextInput) Display() string {
+	if t.masked {
+		masked := make([]rune, len(t.value))
+		for i := range masked {
+			masked[i] = '*'
+		}
+		return string(masked) + "_"
+	}
+	return string(t.value) + "_"
+}